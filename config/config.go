@@ -1,9 +1,13 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
 	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	yaml "gopkg.in/yaml.v2"
 )
@@ -11,12 +15,34 @@ import (
 const ConfigFile = "config.yaml"
 const BuildVersion = "BUILD_VERSION"
 
+const (
+	DefaultMixinAPIBase   = "https://api.mixin.one"
+	DefaultMixinBlazeBase = "wss://blaze.mixin.one"
+)
+
 type PaymentAsset struct {
 	Symbol  string `yaml:"symbol" json:"symbol"`
 	AssetId string `yaml:"asset_id" json:"asset_id"`
 	Amount  string `yaml:"amount" json:"amount"`
 }
 
+// MembershipPlan is a priced membership option, a zero Duration never expires.
+// EstimateBase is the CNY value of the auto amounts, it defaults to CNYPrice.
+type MembershipPlan struct {
+	Name         string         `yaml:"name" json:"name"`
+	LabelEn      string         `yaml:"label_en" json:"label_en"`
+	LabelZh      string         `yaml:"label_zh" json:"label_zh"`
+	Assets       []PaymentAsset `yaml:"assets" json:"assets"`
+	CNYPrice     string         `yaml:"cny_price" json:"cny_price"`
+	EstimateBase string         `yaml:"estimate_base" json:"estimate_base"`
+	Duration     time.Duration  `yaml:"duration" json:"-"`
+}
+
+type ExportedMembershipPlan struct {
+	MembershipPlan
+	Duration int64 `json:"duration"`
+}
+
 type Shortcut struct {
 	Icon    string `yaml:"icon" json:"icon"`
 	LabelEn string `yaml:"label_en" json:"label_en"`
@@ -30,12 +56,50 @@ type ShortcutGroup struct {
 	Items   []Shortcut `yaml:"shortcuts" json:"shortcuts"`
 }
 
+type RateLimitPolicy struct {
+	Role     string        `yaml:"role"`
+	Category string        `yaml:"category"`
+	Every    time.Duration `yaml:"every"`
+	Burst    int           `yaml:"burst"`
+}
+
+type InterceptorConfig struct {
+	Name        string   `yaml:"name"`
+	Categories  []string `yaml:"categories"`
+	ExemptRoles []string `yaml:"exempt_roles"`
+	OnError     string   `yaml:"on_error"`
+}
+
+type ImageClassifierConfig struct {
+	Backend    string             `yaml:"backend"`
+	Fallback   string             `yaml:"fallback"`
+	Endpoint   string             `yaml:"endpoint"`
+	Timeout    time.Duration      `yaml:"timeout"`
+	Threshold  float64            `yaml:"threshold"`
+	Thresholds map[string]float64 `yaml:"thresholds"`
+	MinPixels  int                `yaml:"min_pixels"`
+	MaxPixels  int                `yaml:"max_pixels"`
+}
+
+// ThresholdOf returns the threshold of the backend, the backends missing in
+// thresholds use threshold.
+func (c ImageClassifierConfig) ThresholdOf(backend string) float64 {
+	if t := c.Thresholds[backend]; t > 0 {
+		return t
+	}
+	return c.Threshold
+}
+
 type Config struct {
 	Service struct {
-		Name             string `yaml:"name"`
-		Environment      string `yaml:"enviroment"`
-		HTTPListenPort   int    `yaml:"port"`
-		HTTPResourceHost string `yaml:"host"`
+		Name             string        `yaml:"name"`
+		Environment      string        `yaml:"enviroment"`
+		HTTPListenPort   int           `yaml:"port"`
+		HTTPResourceHost string        `yaml:"host"`
+		LogLevel         string        `yaml:"log_level"`
+		LogOutput        string        `yaml:"log_output"`
+		ShutdownTimeout  time.Duration `yaml:"shutdown_timeout"`
+		MetricsHost      string        `yaml:"metrics_host"`
 	} `yaml:"service"`
 	Database struct {
 		DatebaseUser     string `yaml:"username"`
@@ -45,18 +109,46 @@ type Config struct {
 		DatabaseName     string `yaml:"database_name"`
 	} `yaml:"database"`
 	System struct {
-		MessageShardModifier     string   `yaml:"message_shard_modifier"`
-		MessageShardSize         int64    `yaml:"message_shard_size"`
-		PriceAssetsEnable        bool     `yaml:"price_asset_enable"`
-		AudioMessageEnable       bool     `yaml:"audio_message_enable"`
-		ImageMessageEnable       bool     `yaml:"image_message_enable"`
-		VideoMessageEnable       bool     `yaml:"video_message_enable"`
-		ContactMessageEnable     bool     `yaml:"contact_message_enable"`
-		LimitMessageFrequency    bool     `yaml:"limit_message_frequency"`
-		OperatorList             []string `yaml:"operator_list"`
-		Operators                map[string]bool
-		DetectQRCodeEnabled      bool           `yaml:"detect_image"`
-		DetectLinkEnabled        bool           `yaml:"detect_link"`
+		MessageShardModifier  string `yaml:"message_shard_modifier"`
+		MessageShardSize      int64  `yaml:"message_shard_size"`
+		PriceAssetsEnable     bool   `yaml:"price_asset_enable"`
+		AudioMessageEnable    bool   `yaml:"audio_message_enable"`
+		ImageMessageEnable    bool   `yaml:"image_message_enable"`
+		VideoMessageEnable    bool   `yaml:"video_message_enable"`
+		ContactMessageEnable  bool   `yaml:"contact_message_enable"`
+		LimitMessageFrequency bool   `yaml:"limit_message_frequency"`
+		MessageRateLimit      struct {
+			Store    string            `yaml:"store"`
+			Policies []RateLimitPolicy `yaml:"policies"`
+		} `yaml:"message_rate_limit"`
+		OperatorList        []string `yaml:"operator_list"`
+		Operators           map[string]bool
+		DetectQRCodeEnabled bool                  `yaml:"detect_image"`
+		DetectLinkEnabled   bool                  `yaml:"detect_link"`
+		Interceptors        []InterceptorConfig   `yaml:"interceptors"`
+		ImageClassifier     ImageClassifierConfig `yaml:"image_classifier"`
+		Backfill            struct {
+			Count          int           `yaml:"count"`
+			Window         time.Duration `yaml:"window"`
+			Categories     []string      `yaml:"categories"`
+			PreserveQuotes bool          `yaml:"preserve_quotes"`
+			MaxAttempts    int           `yaml:"max_attempts"`
+		} `yaml:"backfill"`
+		DeliveryRetry struct {
+			MaxAttempts int64         `yaml:"max_attempts"`
+			BackoffBase time.Duration `yaml:"backoff_base"`
+			BackoffMax  time.Duration `yaml:"backoff_max"`
+		} `yaml:"delivery_retry"`
+		MembershipPlans []MembershipPlan `yaml:"membership_plans"`
+		Quote           struct {
+			TTL        time.Duration `yaml:"ttl"`
+			Tolerance  string        `yaml:"tolerance"`
+			USDCNYRate string        `yaml:"usd_cny_rate"`
+		} `yaml:"quote"`
+		Membership struct {
+			Duration     time.Duration `yaml:"duration"`
+			RemindBefore time.Duration `yaml:"remind_before"`
+		} `yaml:"membership"`
 		ProhibitedMessageEnabled bool           `yaml:"prohibited_message"`
 		PaymentAssetId           string         `yaml:"payment_asset_id"`
 		PaymentAmount            string         `yaml:"payment_amount"`
@@ -74,21 +166,39 @@ type Config struct {
 		HomeShortcutGroups []ShortcutGroup `yaml:"home_shortcut_groups"`
 	} `yaml:"appearance"`
 	MessageTemplate struct {
-		WelcomeMessage          string `yaml:"welcome_message"`
-		GroupRedPacket          string `yaml:"group_redpacket"`
-		GroupRedPacketShortDesc string `yaml:"group_redpacket_short_desc"`
-		GroupRedPacketDesc      string `yaml:"group_redpacket_desc"`
-		GroupOpenedRedPacket    string `yaml:"group_opened_redpacket"`
-		MessageTipsGuest        string `yaml:"message_tips_guest"`
-		MessageProhibit         string `yaml:"message_prohibit"`
-		MessageAllow            string `yaml:"message_allow"`
-		MessageTipsJoin         string `yaml:"message_tips_join"`
-		MessageTipsHelp         string `yaml:"message_tips_help"`
-		MessageTipsHelpBtn      string `yaml:"message_tips_help_btn"`
-		MessageTipsUnsubscribe  string `yaml:"message_tips_unsubscribe"`
-		MessageTipsTooMany      string `yaml:"message_tips_too_many"`
-		MessageCommandsInfo     string `yaml:"message_commands_info"`
-		MessageCommandsInfoResp string `yaml:"message_commands_info_resp"`
+		WelcomeMessage          string            `yaml:"welcome_message"`
+		GroupRedPacket          string            `yaml:"group_redpacket"`
+		GroupRedPacketShortDesc string            `yaml:"group_redpacket_short_desc"`
+		GroupRedPacketDesc      string            `yaml:"group_redpacket_desc"`
+		GroupOpenedRedPacket    string            `yaml:"group_opened_redpacket"`
+		MessageTipsGuest        string            `yaml:"message_tips_guest"`
+		MessageProhibit         string            `yaml:"message_prohibit"`
+		MessageAllow            string            `yaml:"message_allow"`
+		MessageTipsJoin         string            `yaml:"message_tips_join"`
+		MessageTipsHelp         string            `yaml:"message_tips_help"`
+		MessageTipsHelpBtn      string            `yaml:"message_tips_help_btn"`
+		MessageTipsUnsubscribe  string            `yaml:"message_tips_unsubscribe"`
+		MessageTipsTooMany      string            `yaml:"message_tips_too_many"`
+		MessageTipsMuted        string            `yaml:"message_tips_muted"`
+		MessageTipsExpiring     string            `yaml:"message_tips_expiring"`
+		MessageTipsExpired      string            `yaml:"message_tips_expired"`
+		MessageCommandsInfo     string            `yaml:"message_commands_info"`
+		MessageCommandsInfoResp string            `yaml:"message_commands_info_resp"`
+		CommandPrefix           string            `yaml:"command_prefix"`
+		CommandDescriptions     map[string]string `yaml:"command_descriptions"`
+		MessageCommandsHelp     string            `yaml:"message_commands_help"`
+		MessageCommandsUsage    string            `yaml:"message_commands_usage"`
+		MessageCommandsDenied   string            `yaml:"message_commands_denied"`
+		MessageCommandsRules    string            `yaml:"message_commands_rules"`
+		MessageCommandsMeResp   string            `yaml:"message_commands_me_resp"`
+		MessageCommandsNotFound string            `yaml:"message_commands_not_found"`
+		MessageCommandsInvalid  string            `yaml:"message_commands_invalid"`
+		MessageCommandsBanResp  string            `yaml:"message_commands_ban_resp"`
+		MessageCommandsKickResp string            `yaml:"message_commands_kick_resp"`
+		MessageCommandsRecalled string            `yaml:"message_commands_recalled"`
+		MessageCommandsPinned   string            `yaml:"message_commands_pinned"`
+		MessageCommandsUnpinned string            `yaml:"message_commands_unpinned"`
+		MessageCommandsNoPins   string            `yaml:"message_commands_no_pins"`
 	} `yaml:"message_template"`
 	Wechat struct {
 		AppId          string `yaml:"app_id"`
@@ -106,21 +216,24 @@ type Config struct {
 		PinToken        string `yaml:"pin_token"`
 		SessionId       string `yaml:"session_id"`
 		SessionKey      string `yaml:"session_key"`
+		APIBase         string `yaml:"api_base"`
+		BlazeBase       string `yaml:"blaze_base"`
 	} `yaml:"mixin"`
 }
 
 type ExportedConfig struct {
-	MixinClientId          string          `json:"mixin_client_id"`
-	HTTPResourceHost       string          `json:"host"`
-	AutoEstimate           bool            `json:"auto_estimate"`
-	AutoEstimateCurrency   string          `json:"auto_estimate_currency"`
-	AutoEstimateBase       string          `json:"auto_estimate_base"`
-	AccpetPaymentAssetList []PaymentAsset  `json:"accept_asset_list"`
-	AccpetWeChatPayment    bool            `json:"accept_wechat_payment"`
-	WeChatPaymentAmount    string          `json:"wechat_payment_amount"`
-	AccpetCouponPayment    bool            `json:"accept_coupon_payment"`
-	HomeWelcomeMessage     string          `json:"home_welcome_message"`
-	HomeShortcutGroups     []ShortcutGroup `json:"home_shortcut_groups"`
+	MixinClientId          string                   `json:"mixin_client_id"`
+	HTTPResourceHost       string                   `json:"host"`
+	AutoEstimate           bool                     `json:"auto_estimate"`
+	AutoEstimateCurrency   string                   `json:"auto_estimate_currency"`
+	AutoEstimateBase       string                   `json:"auto_estimate_base"`
+	AccpetPaymentAssetList []PaymentAsset           `json:"accept_asset_list"`
+	AccpetWeChatPayment    bool                     `json:"accept_wechat_payment"`
+	WeChatPaymentAmount    string                   `json:"wechat_payment_amount"`
+	AccpetCouponPayment    bool                     `json:"accept_coupon_payment"`
+	MembershipPlans        []ExportedMembershipPlan `json:"membership_plans"`
+	HomeWelcomeMessage     string                   `json:"home_welcome_message"`
+	HomeShortcutGroups     []ShortcutGroup          `json:"home_shortcut_groups"`
 }
 
 var AppConfig *Config
@@ -139,6 +252,157 @@ func LoadConfig(dir string) {
 	for _, op := range AppConfig.System.OperatorList {
 		AppConfig.System.Operators[op] = true
 	}
+	if len(AppConfig.System.MessageRateLimit.Policies) == 0 {
+		AppConfig.System.MessageRateLimit.Policies = []RateLimitPolicy{
+			{Role: "user", Category: "*", Every: 3 * time.Minute, Burst: 1},
+		}
+	}
+	if len(AppConfig.System.Interceptors) == 0 {
+		AppConfig.System.Interceptors = legacyInterceptors()
+	}
+	if AppConfig.System.ImageClassifier.Backend == "" {
+		AppConfig.System.ImageClassifier.Backend = "vision"
+	}
+	if AppConfig.System.ImageClassifier.Threshold <= 0 {
+		AppConfig.System.ImageClassifier.Threshold = 0.7
+	}
+	if AppConfig.System.ImageClassifier.MaxPixels <= 0 {
+		AppConfig.System.ImageClassifier.MaxPixels = 40000000
+	}
+	if AppConfig.System.Backfill.Count == 0 && AppConfig.System.Backfill.Window == 0 {
+		AppConfig.System.Backfill.Count = 10
+	}
+	if AppConfig.System.Backfill.MaxAttempts <= 0 {
+		AppConfig.System.Backfill.MaxAttempts = 5
+	}
+	if AppConfig.System.DeliveryRetry.MaxAttempts <= 0 {
+		AppConfig.System.DeliveryRetry.MaxAttempts = 10
+	}
+	if AppConfig.System.DeliveryRetry.BackoffBase <= 0 {
+		AppConfig.System.DeliveryRetry.BackoffBase = time.Second
+	}
+	if AppConfig.System.DeliveryRetry.BackoffMax <= 0 {
+		AppConfig.System.DeliveryRetry.BackoffMax = 10 * time.Minute
+	}
+	if AppConfig.System.Membership.RemindBefore <= 0 {
+		AppConfig.System.Membership.RemindBefore = 72 * time.Hour
+	}
+	if AppConfig.System.Quote.TTL <= 0 {
+		AppConfig.System.Quote.TTL = 15 * time.Minute
+	}
+	if AppConfig.System.Quote.Tolerance == "" {
+		AppConfig.System.Quote.Tolerance = "0.02"
+	}
+	if len(AppConfig.System.MembershipPlans) == 0 {
+		AppConfig.System.MembershipPlans = []MembershipPlan{legacyMembershipPlan()}
+	}
+	if err := validateMembershipPlans(); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	if err := validateQuote(); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	if AppConfig.Service.ShutdownTimeout <= 0 {
+		AppConfig.Service.ShutdownTimeout = 20 * time.Second
+	}
+	if AppConfig.Service.MetricsHost == "" {
+		AppConfig.Service.MetricsHost = "127.0.0.1"
+	}
+	if AppConfig.MessageTemplate.CommandPrefix == "" {
+		AppConfig.MessageTemplate.CommandPrefix = "/"
+	}
+	if AppConfig.Mixin.APIBase == "" {
+		AppConfig.Mixin.APIBase = DefaultMixinAPIBase
+	}
+	if AppConfig.Mixin.BlazeBase == "" {
+		AppConfig.Mixin.BlazeBase = DefaultMixinBlazeBase
+	}
+}
+
+// legacyMembershipPlan builds the only plan implied by payment_asset_id,
+// accept_asset_list, wechat_payment_amount and membership.duration.
+func legacyMembershipPlan() MembershipPlan {
+	system := AppConfig.System
+	plan := MembershipPlan{
+		Name:         "default",
+		CNYPrice:     system.WeChatPaymentAmount,
+		EstimateBase: system.AutoEstimateBase,
+		Duration:     system.Membership.Duration,
+	}
+	if system.PaymentAssetId != "" && system.PaymentAmount != "" {
+		plan.Assets = append(plan.Assets, PaymentAsset{AssetId: system.PaymentAssetId, Amount: system.PaymentAmount})
+	}
+	plan.Assets = append(plan.Assets, system.AccpetPaymentAssetList...)
+	return plan
+}
+
+// validateMembershipPlans requires a positive cny_price in yuan with at most
+// 2 decimals, WeChat Pay charges whole fen.
+func validateMembershipPlans() error {
+	for _, plan := range AppConfig.System.MembershipPlans {
+		if plan.CNYPrice == "" {
+			continue
+		}
+		price, err := strconv.ParseFloat(plan.CNYPrice, 64)
+		if err != nil || price <= 0 {
+			return fmt.Errorf("cny_price %s of plan %s must be positive", plan.CNYPrice, plan.Name)
+		}
+		if i := strings.Index(plan.CNYPrice, "."); i >= 0 && len(plan.CNYPrice)-i-1 > 2 {
+			return fmt.Errorf("cny_price %s of plan %s has more than 2 decimals", plan.CNYPrice, plan.Name)
+		}
+	}
+	return nil
+}
+
+// validateQuote requires the usd_cny_rate when any plan asset is quoted
+// automatically, and a tolerance which still rejects empty transfers.
+func validateQuote() error {
+	quote := AppConfig.System.Quote
+	tolerance, err := strconv.ParseFloat(quote.Tolerance, 64)
+	if err != nil || tolerance < 0 || tolerance >= 1 {
+		return fmt.Errorf("quote tolerance %s must be in [0,1)", quote.Tolerance)
+	}
+	for _, plan := range AppConfig.System.MembershipPlans {
+		for _, asset := range plan.Assets {
+			if asset.Amount != "auto" {
+				continue
+			}
+			rate, err := strconv.ParseFloat(quote.USDCNYRate, 64)
+			if err != nil || rate <= 0 {
+				return fmt.Errorf("quote usd_cny_rate %s is required by the auto amount of plan %s", quote.USDCNYRate, plan.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// FindMembershipPlan returns the named plan, an empty name is the first plan.
+func FindMembershipPlan(name string) *MembershipPlan {
+	plans := AppConfig.System.MembershipPlans
+	if name == "" && len(plans) > 0 {
+		return &plans[0]
+	}
+	for i := range plans {
+		if plans[i].Name == name {
+			return &plans[i]
+		}
+	}
+	return nil
+}
+
+// legacyInterceptors builds the chain implied by detect_link and
+// detect_image for configs without an interceptors section.
+func legacyInterceptors() []InterceptorConfig {
+	var chain []InterceptorConfig
+	exempt := []string{"admin"}
+	if AppConfig.System.DetectLinkEnabled {
+		chain = append(chain, InterceptorConfig{Name: "link", Categories: []string{"PLAIN_TEXT"}, ExemptRoles: exempt})
+	}
+	if AppConfig.System.DetectQRCodeEnabled {
+		chain = append(chain, InterceptorConfig{Name: "qrcode", Categories: []string{"PLAIN_IMAGE"}, ExemptRoles: exempt})
+		chain = append(chain, InterceptorConfig{Name: "nsfw", Categories: []string{"PLAIN_IMAGE"}, ExemptRoles: exempt})
+	}
+	return chain
 }
 
 func GetExported() ExportedConfig {
@@ -152,6 +416,9 @@ func GetExported() ExportedConfig {
 	exc.AccpetWeChatPayment = AppConfig.System.AccpetWeChatPayment
 	exc.WeChatPaymentAmount = AppConfig.System.WeChatPaymentAmount
 	exc.AccpetCouponPayment = AppConfig.System.AccpetCouponPayment
+	for _, plan := range AppConfig.System.MembershipPlans {
+		exc.MembershipPlans = append(exc.MembershipPlans, ExportedMembershipPlan{MembershipPlan: plan, Duration: int64(plan.Duration / time.Second)})
+	}
 	exc.HomeWelcomeMessage = AppConfig.Appearance.HomeWelcomeMessage
 	exc.HomeShortcutGroups = AppConfig.Appearance.HomeShortcutGroups
 	return exc
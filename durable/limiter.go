@@ -1,23 +1,42 @@
 package durable
 
 import (
+	"context"
+	"sync"
 	"time"
 
-	"github.com/MixinNetwork/supergroup.mixin.one/config"
 	"golang.org/x/time/rate"
 )
 
-var limiters map[string]*rate.Limiter = make(map[string]*rate.Limiter, 0)
+type RateLimit struct {
+	Every time.Duration
+	Burst int
+}
 
-func Allow(key string) bool {
-	if config.AppConfig.Service.Environment == "test" {
-		return true
-	}
-	if !config.AppConfig.System.LimitMessageFrequency {
-		return true
-	}
-	if limiters[key] == nil {
-		limiters[key] = rate.NewLimiter(rate.Every(3*time.Minute), 1)
+// Limiter takes one token from the bucket identified by key, refilled one
+// token every limit.Every up to limit.Burst tokens.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit RateLimit) (bool, error)
+}
+
+type memoryLimiter struct {
+	mutex    sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+// NewMemoryLimiter keeps buckets in the process, so they reset on restart
+// and are not shared between instances.
+func NewMemoryLimiter() Limiter {
+	return &memoryLimiter{limiters: make(map[string]*rate.Limiter)}
+}
+
+func (m *memoryLimiter) Allow(ctx context.Context, key string, limit RateLimit) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	l := m.limiters[key]
+	if l == nil {
+		l = rate.NewLimiter(rate.Every(limit.Every), limit.Burst)
+		m.limiters[key] = l
 	}
-	return limiters[key].Allow()
+	return l.Allow(), nil
 }
@@ -0,0 +1,51 @@
+package durable
+
+import (
+	"context"
+	"database/sql"
+	"hash/fnv"
+)
+
+// AdvisoryLock is a PostgreSQL session advisory lock. It is held by a
+// dedicated connection, and released by PostgreSQL as soon as that
+// connection is gone, so a crashed holder can't keep it.
+type AdvisoryLock struct {
+	key  int64
+	conn *sql.Conn
+}
+
+func AdvisoryLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// TryAdvisoryLock returns nil without error when the lock is held by another
+// session.
+func (d *Database) TryAdvisoryLock(ctx context.Context, name string) (*AdvisoryLock, error) {
+	conn, err := d.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := AdvisoryLockKey(name)
+	var locked bool
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&locked)
+	if err != nil || !locked {
+		conn.Close()
+		return nil, err
+	}
+	return &AdvisoryLock{key: key, conn: conn}, nil
+}
+
+// Check returns an error when the connection holding the lock is lost, the
+// lock lives as long as the session.
+func (l *AdvisoryLock) Check(ctx context.Context) error {
+	var one int
+	return l.conn.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+}
+
+func (l *AdvisoryLock) Release(ctx context.Context) error {
+	defer l.conn.Close()
+	_, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.key)
+	return err
+}
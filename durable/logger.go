@@ -1,45 +1,147 @@
 package durable
 
 import (
-	"log"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
 )
 
-type LoggerClient struct{}
+const (
+	LogLevelDebug = iota
+	LogLevelInfo
+	LogLevelError
+)
+
+var logLevels = map[string]int{
+	"debug": LogLevelDebug,
+	"info":  LogLevelInfo,
+	"error": LogLevelError,
+}
+
+var levelNames = []string{"debug", "info", "error"}
+
+// LoggerClient writes the lines of all its loggers as JSON objects, one per
+// line, to a single output.
+type LoggerClient struct {
+	mutex sync.Mutex
+	out   io.Writer
+	level int
+}
+
+type Logger struct {
+	client *LoggerClient
+	fields map[string]interface{}
+}
+
+var defaultLoggerClient = &LoggerClient{out: os.Stderr, level: LogLevelInfo}
+
+// NewLoggerClient accepts debug, info or error as level, and stdout, stderr
+// or a file path as output.
+func NewLoggerClient(level, output string) (*LoggerClient, error) {
+	client := &LoggerClient{level: LogLevelInfo, out: os.Stderr}
+	if level != "" {
+		l, found := logLevels[strings.ToLower(level)]
+		if !found {
+			return nil, fmt.Errorf("invalid log level %s", level)
+		}
+		client.level = l
+	}
+	switch output {
+	case "", "stderr":
+	case "stdout":
+		client.out = os.Stdout
+	default:
+		f, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		client.out = f
+	}
+	return client, nil
+}
 
-type Logger struct{}
+// SetDefaultLoggerClient sets the client used by BuildLogger.
+func SetDefaultLoggerClient(client *LoggerClient) {
+	defaultLoggerClient = client
+}
 
-func NewLoggerClient() *LoggerClient {
-	return &LoggerClient{}
+func DefaultLoggerClient() *LoggerClient {
+	return defaultLoggerClient
 }
 
 func BuildLogger() *Logger {
-	return &Logger{}
+	return defaultLoggerClient.BuildLogger()
+}
+
+func (client *LoggerClient) BuildLogger() *Logger {
+	return &Logger{client: client}
+}
+
+// With returns a copy of the logger adding the field to every line.
+func (logger *Logger) With(key string, value interface{}) *Logger {
+	fields := make(map[string]interface{}, len(logger.fields)+1)
+	for k, v := range logger.fields {
+		fields[k] = v
+	}
+	fields[key] = value
+	return &Logger{client: logger.client, fields: fields}
 }
 
 func (logger *Logger) Debug(v ...interface{}) {
-	log.Println(v...)
+	logger.write(LogLevelDebug, sprintln(v...))
 }
 
 func (logger *Logger) Debugf(format string, v ...interface{}) {
-	log.Printf(format, v...)
+	logger.write(LogLevelDebug, fmt.Sprintf(format, v...))
 }
 
 func (logger *Logger) Info(v ...interface{}) {
-	log.Println(v...)
+	logger.write(LogLevelInfo, sprintln(v...))
 }
 
 func (logger *Logger) Infof(format string, v ...interface{}) {
-	log.Printf(format, v...)
+	logger.write(LogLevelInfo, fmt.Sprintf(format, v...))
 }
 
 func (logger *Logger) Error(v ...interface{}) {
-	log.Println(v...)
+	logger.write(LogLevelError, sprintln(v...))
 }
 
 func (logger *Logger) Errorf(format string, v ...interface{}) {
-	log.Printf(format, v...)
+	logger.write(LogLevelError, fmt.Sprintf(format, v...))
 }
 
 func (logger *Logger) Panicln(v ...interface{}) {
-	log.Panicln(v...)
+	msg := sprintln(v...)
+	logger.write(LogLevelError, msg)
+	panic(msg)
+}
+
+func (logger *Logger) write(level int, msg string) {
+	client := logger.client
+	if level < client.level {
+		return
+	}
+	line := make(map[string]interface{}, len(logger.fields)+3)
+	for k, v := range logger.fields {
+		line[k] = v
+	}
+	line["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	line["level"] = levelNames[level]
+	line["msg"] = msg
+	data, err := json.Marshal(line)
+	if err != nil {
+		data, _ = json.Marshal(map[string]interface{}{"level": levelNames[level], "msg": msg, "error": err.Error()})
+	}
+	client.mutex.Lock()
+	client.out.Write(append(data, '\n'))
+	client.mutex.Unlock()
+}
+
+func sprintln(v ...interface{}) string {
+	return strings.TrimSuffix(fmt.Sprintln(v...), "\n")
 }
@@ -0,0 +1,50 @@
+package durable
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const mixinAPIHost = "api.mixin.one"
+
+type mixinTransport struct {
+	base *url.URL
+	next http.RoundTripper
+}
+
+// RouteMixinAPI sends the requests to https://api.mixin.one made through
+// http.DefaultTransport to base instead. bot-api-go-client has the host
+// hardcoded, so this is how mixin.api_base reaches its calls.
+func RouteMixinAPI(base string) error {
+	next := http.DefaultTransport
+	if t, ok := next.(*mixinTransport); ok {
+		next = t.next
+	}
+	u, err := url.Parse(base)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid mixin api base %s", base)
+	}
+	if u.Scheme == "https" && u.Host == mixinAPIHost && strings.TrimRight(u.Path, "/") == "" {
+		http.DefaultTransport = next
+		return nil
+	}
+	http.DefaultTransport = &mixinTransport{base: u, next: next}
+	return nil
+}
+
+func (t *mixinTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != mixinAPIHost {
+		return t.next.RoundTrip(req)
+	}
+	r := new(http.Request)
+	*r = *req
+	u := *req.URL
+	u.Scheme = t.base.Scheme
+	u.Host = t.base.Host
+	u.Path = strings.TrimRight(t.base.Path, "/") + u.Path
+	r.URL = &u
+	r.Host = t.base.Host
+	return t.next.RoundTrip(r)
+}
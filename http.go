@@ -8,15 +8,14 @@ import (
 	"github.com/MixinNetwork/supergroup.mixin.one/durable"
 	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
 	"github.com/MixinNetwork/supergroup.mixin.one/routes"
-	"github.com/dimfeld/httptreemux"
 	"github.com/facebookgo/grace/gracehttp"
 	"github.com/gorilla/handlers"
 	"github.com/unrolled/render"
 )
 
 func StartServer(database *durable.Database) error {
-	logger := durable.NewLoggerClient()
-	router := httptreemux.New()
+	logger := durable.DefaultLoggerClient()
+	router := middlewares.NewRouter()
 	routes.RegisterHanders(router)
 	routes.RegisterRoutes(router)
 	handler := middlewares.Authenticate(router)
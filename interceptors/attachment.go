@@ -0,0 +1,86 @@
+package interceptors
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+// attachmentMaxBytes caps the download, members upload the attachments.
+const attachmentMaxBytes = 20 * 1024 * 1024
+
+type attachmentView struct {
+	AttachmentId string `json:"attachment_id"`
+}
+
+// readAttachment downloads the attachment of the message once and keeps it
+// for the following interceptors in the chain.
+func (message *Message) readAttachment(ctx context.Context) ([]byte, error) {
+	if message.attachment != nil {
+		return message.attachment, nil
+	}
+	src, err := base64.StdEncoding.DecodeString(message.Data)
+	if err != nil {
+		return nil, err
+	}
+	var a attachmentView
+	err = json.Unmarshal(src, &a)
+	if err != nil {
+		return nil, err
+	}
+	attachment, err := bot.AttachemntShow(ctx, config.AppConfig.Mixin.ClientId, config.AppConfig.Mixin.SessionId, config.AppConfig.Mixin.SessionKey, a.AttachmentId)
+	if err != nil {
+		return nil, fmt.Errorf("bot.AttachemntShow error: %+v, id: %s", err, a.AttachmentId)
+	}
+
+	url := strings.Replace(attachment.ViewURL, "assets.zeromesh.net", "s3.cn-north-1.amazonaws.com.cn", 0)
+	session.Logger(ctx).Infof("readAttachment ViewURL %s", url)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	tctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	resp, err := http.DefaultClient.Do(req.WithContext(tctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if !(resp.StatusCode >= 200 && resp.StatusCode < 300) {
+		return nil, fmt.Errorf("readAttachment StatusCode %d", resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, attachmentMaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > attachmentMaxBytes {
+		return nil, fmt.Errorf("readAttachment larger than %d bytes", attachmentMaxBytes)
+	}
+	message.attachment = data
+	return data, nil
+}
+
+// checkImageSize reads only the header of the image, so an image with huge
+// dimensions is refused before its pixels are allocated by image.Decode.
+func checkImageSize(data []byte, maxPixels int) error {
+	conf, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if pixels := int64(conf.Width) * int64(conf.Height); maxPixels > 0 && pixels > int64(maxPixels) {
+		return fmt.Errorf("image %dx%d is larger than %d pixels", conf.Width, conf.Height, maxPixels)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package interceptors
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const (
+	ClassifierVision    = "vision"
+	ClassifierHTTP      = "http"
+	ClassifierHeuristic = "heuristic"
+)
+
+// ImageClassifier scores how likely an image is adult content, from 0 to 1.
+type ImageClassifier interface {
+	Classify(ctx context.Context, data []byte) (float64, error)
+}
+
+func NewImageClassifier(backend string, conf config.ImageClassifierConfig) (ImageClassifier, error) {
+	switch backend {
+	case ClassifierVision:
+		return &visionClassifier{}, nil
+	case ClassifierHTTP:
+		if conf.Endpoint == "" {
+			return nil, fmt.Errorf("image classifier %s requires an endpoint", backend)
+		}
+		return newHTTPClassifier(conf.Endpoint, conf.Timeout), nil
+	case ClassifierHeuristic:
+		return &heuristicClassifier{minPixels: conf.MinPixels, maxPixels: conf.MaxPixels}, nil
+	}
+	return nil, fmt.Errorf("unknown image classifier %s", backend)
+}
+
+func init() {
+	Register("nsfw", newClassifierInterceptor)
+	Register("vision", newClassifierInterceptor)
+}
+
+type classifierInterceptor struct {
+	classifier        ImageClassifier
+	threshold         float64
+	fallback          ImageClassifier
+	fallbackThreshold float64
+}
+
+func newClassifierInterceptor() (Interceptor, error) {
+	conf := config.AppConfig.System.ImageClassifier
+	classifier, err := NewImageClassifier(conf.Backend, conf)
+	if err != nil {
+		return nil, err
+	}
+	i := &classifierInterceptor{classifier: classifier, threshold: conf.ThresholdOf(conf.Backend)}
+	if conf.Fallback != "" {
+		i.fallback, err = NewImageClassifier(conf.Fallback, conf)
+		if err != nil {
+			return nil, err
+		}
+		i.fallbackThreshold = conf.ThresholdOf(conf.Fallback)
+	}
+	return i, nil
+}
+
+func (i *classifierInterceptor) Intercept(ctx context.Context, message *Message) (Result, error) {
+	data, err := message.readAttachment(ctx)
+	if err != nil {
+		return Allow(), err
+	}
+	return i.classify(ctx, data)
+}
+
+// classify compares the score with the threshold of the backend which
+// produced it, the fallback is only asked when the backend fails.
+func (i *classifierInterceptor) classify(ctx context.Context, data []byte) (Result, error) {
+	score, err := i.classifier.Classify(ctx, data)
+	threshold := i.threshold
+	if err != nil && i.fallback != nil {
+		session.Logger(ctx).Errorf("ImageClassifier ERROR: %+v, using fallback", err)
+		score, err = i.fallback.Classify(ctx, data)
+		threshold = i.fallbackThreshold
+	}
+	if err != nil {
+		return Allow(), err
+	}
+	session.Logger(ctx).Infof("ImageClassifier score: %f, threshold: %f", score, threshold)
+	if score >= threshold {
+		return Reject(fmt.Sprintf("Image classified as adult content: %.2f", score)), nil
+	}
+	return Allow(), nil
+}
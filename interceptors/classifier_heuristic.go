@@ -0,0 +1,67 @@
+package interceptors
+
+import (
+	"bytes"
+	"context"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+const heuristicMaxSamples = 160000
+
+// heuristicClassifier scores an image by the ratio of skin colored pixels.
+// It is crude, but needs nothing besides the image itself.
+type heuristicClassifier struct {
+	minPixels int
+	maxPixels int
+}
+
+func (c *heuristicClassifier) Classify(ctx context.Context, data []byte) (float64, error) {
+	err := checkImageSize(data, c.maxPixels)
+	if err != nil {
+		return 0, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	bounds := img.Bounds()
+	pixels := bounds.Dx() * bounds.Dy()
+	if pixels == 0 || pixels < c.minPixels {
+		return 0, nil
+	}
+	step := 1
+	for pixels/(step*step) > heuristicMaxSamples {
+		step++
+	}
+	var total, skin int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			r, g, b, _ := img.At(x, y).RGBA()
+			total++
+			if isSkin(int(r>>8), int(g>>8), int(b>>8)) {
+				skin++
+			}
+		}
+	}
+	return float64(skin) / float64(total), nil
+}
+
+func isSkin(r, g, b int) bool {
+	max, min := r, r
+	for _, c := range []int{g, b} {
+		if c > max {
+			max = c
+		}
+		if c < min {
+			min = c
+		}
+	}
+	d := r - g
+	if d < 0 {
+		d = -d
+	}
+	return r > 95 && g > 40 && b > 20 && max-min > 15 && d > 15 && r > g && r > b
+}
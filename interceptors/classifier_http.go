@@ -0,0 +1,64 @@
+package interceptors
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// httpClassifier posts {"image": "<base64>"} to a local inference service,
+// which answers {"score": 0.93} or {"error": "reason"} with a non 2xx status.
+type httpClassifier struct {
+	endpoint string
+	client   *http.Client
+}
+
+type httpClassifierRequest struct {
+	Image string `json:"image"`
+}
+
+type httpClassifierResponse struct {
+	Score *float64 `json:"score"`
+	Error string   `json:"error"`
+}
+
+func newHTTPClassifier(endpoint string, timeout time.Duration) *httpClassifier {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &httpClassifier{endpoint: endpoint, client: &http.Client{Timeout: timeout}}
+}
+
+func (c *httpClassifier) Classify(ctx context.Context, data []byte) (float64, error) {
+	body, err := json.Marshal(httpClassifierRequest{Image: base64.StdEncoding.EncodeToString(data)})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result httpClassifierResponse
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if !(resp.StatusCode >= 200 && resp.StatusCode < 300) {
+		return 0, fmt.Errorf("image classifier StatusCode %d: %s", resp.StatusCode, result.Error)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if result.Score == nil {
+		return 0, fmt.Errorf("image classifier response without score")
+	}
+	return *result.Score, nil
+}
@@ -0,0 +1,203 @@
+package interceptors
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubClassifier struct {
+	score float64
+	err   error
+}
+
+func (c *stubClassifier) Classify(ctx context.Context, data []byte) (float64, error) {
+	return c.score, c.err
+}
+
+func TestHTTPClassifier(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	data := []byte("image bytes")
+	tests := []struct {
+		status int
+		body   string
+		score  float64
+		err    string
+	}{
+		{http.StatusOK, `{"score": 0.93}`, 0.93, ""},
+		{http.StatusOK, `{"score": 0}`, 0, ""},
+		{http.StatusOK, `{}`, 0, "image classifier response without score"},
+		{http.StatusOK, `not json`, 0, "invalid character"},
+		{http.StatusBadRequest, `{"error": "unsupported image"}`, 0, "image classifier StatusCode 400: unsupported image"},
+		{http.StatusBadGateway, `bad gateway`, 0, "image classifier StatusCode 502: "},
+	}
+	for _, tc := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(http.MethodPost, r.Method)
+			assert.Equal("application/json", r.Header.Get("Content-Type"))
+			var req httpClassifierRequest
+			assert.Nil(json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(base64.StdEncoding.EncodeToString(data), req.Image)
+			w.WriteHeader(tc.status)
+			w.Write([]byte(tc.body))
+		}))
+		score, err := newHTTPClassifier(server.URL, time.Second).Classify(ctx, data)
+		server.Close()
+		if tc.err != "" {
+			if assert.NotNil(err, tc.body) {
+				assert.Contains(err.Error(), tc.err, tc.body)
+			}
+			continue
+		}
+		assert.Nil(err, tc.body)
+		assert.Equal(tc.score, score, tc.body)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte(`{"score": 0.5}`))
+	}))
+	defer server.Close()
+	_, err := newHTTPClassifier(server.URL, 50*time.Millisecond).Classify(ctx, data)
+	assert.NotNil(err)
+}
+
+func testImage(width, height int, fill func(x, y int) color.Color) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, fill(x, y))
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+// hugeImage is a tiny PNG whose header claims width x height, decoding its
+// pixels would allocate gigabytes.
+func hugeImage(width, height uint32) []byte {
+	data := testImage(1, 1, func(x, y int) color.Color { return color.White })
+	ihdr := data[12:29]
+	binary.BigEndian.PutUint32(ihdr[4:8], width)
+	binary.BigEndian.PutUint32(ihdr[8:12], height)
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(ihdr))
+	return data
+}
+
+func TestHeuristicClassifier(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	skin := color.RGBA{220, 170, 140, 255}
+	sky := color.RGBA{60, 120, 220, 255}
+	tests := []struct {
+		name      string
+		data      []byte
+		minPixels int
+		maxPixels int
+		score     float64
+		err       bool
+	}{
+		{"skin", testImage(100, 100, func(x, y int) color.Color { return skin }), 0, 0, 1, false},
+		{"sky", testImage(100, 100, func(x, y int) color.Color { return sky }), 0, 0, 0, false},
+		{"half", testImage(100, 100, func(x, y int) color.Color {
+			if x < 50 {
+				return skin
+			}
+			return sky
+		}), 0, 0, 0.5, false},
+		{"small", testImage(50, 50, func(x, y int) color.Color { return skin }), 10000, 0, 0, false},
+		{"sampled", testImage(800, 800, func(x, y int) color.Color { return skin }), 10000, 1000000, 1, false},
+		{"large", testImage(200, 200, func(x, y int) color.Color { return skin }), 0, 10000, 0, true},
+		{"huge", hugeImage(100000, 100000), 0, 40000000, 0, true},
+		{"invalid", []byte("not an image"), 0, 0, 0, true},
+	}
+	for _, tc := range tests {
+		score, err := (&heuristicClassifier{minPixels: tc.minPixels, maxPixels: tc.maxPixels}).Classify(ctx, tc.data)
+		if tc.err {
+			if assert.NotNil(err, tc.name) && tc.maxPixels > 0 {
+				assert.Contains(err.Error(), "larger than", tc.name)
+			}
+			continue
+		}
+		assert.Nil(err, tc.name)
+		assert.InDelta(tc.score, score, 0.001, tc.name)
+	}
+}
+
+func TestIsSkin(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		r, g, b int
+		skin    bool
+	}{
+		{220, 170, 140, true},
+		{180, 120, 90, true},
+		{90, 60, 40, false},
+		{200, 195, 190, false},
+		{60, 120, 220, false},
+		{150, 160, 100, false},
+		{255, 255, 255, false},
+	}
+	for _, tc := range tests {
+		assert.Equal(tc.skin, isSkin(tc.r, tc.g, tc.b), "%d,%d,%d", tc.r, tc.g, tc.b)
+	}
+}
+
+func TestClassifierThresholds(t *testing.T) {
+	assert := assert.New(t)
+	ctx := session.WithLogger(context.Background(), durable.BuildLogger())
+
+	config.AppConfig = &config.Config{}
+	config.AppConfig.System.ImageClassifier = config.ImageClassifierConfig{
+		Backend:    ClassifierHTTP,
+		Fallback:   ClassifierHeuristic,
+		Endpoint:   "http://127.0.0.1:8000/classify",
+		Threshold:  0.7,
+		Thresholds: map[string]float64{ClassifierHeuristic: 0.4},
+	}
+	interceptor, err := newClassifierInterceptor()
+	assert.Nil(err)
+	i := interceptor.(*classifierInterceptor)
+	assert.Equal(0.7, i.threshold)
+	assert.Equal(0.4, i.fallbackThreshold)
+
+	tests := []struct {
+		primary  *stubClassifier
+		fallback *stubClassifier
+		verdict  string
+		err      bool
+	}{
+		{&stubClassifier{score: 0.5}, &stubClassifier{score: 0.9}, VerdictAllow, false},
+		{&stubClassifier{score: 0.7}, &stubClassifier{score: 0}, VerdictReject, false},
+		{&stubClassifier{err: errors.New("timeout")}, &stubClassifier{score: 0.5}, VerdictReject, false},
+		{&stubClassifier{err: errors.New("timeout")}, &stubClassifier{score: 0.3}, VerdictAllow, false},
+		{&stubClassifier{err: errors.New("timeout")}, &stubClassifier{err: errors.New("not an image")}, VerdictAllow, true},
+	}
+	for n, tc := range tests {
+		i.classifier, i.fallback = tc.primary, tc.fallback
+		result, err := i.classify(ctx, nil)
+		assert.Equal(tc.err, err != nil, n)
+		assert.Equal(tc.verdict, result.Verdict, n)
+	}
+}
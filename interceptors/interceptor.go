@@ -0,0 +1,137 @@
+package interceptors
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const (
+	VerdictAllow  = "allow"
+	VerdictReject = "reject"
+	VerdictHold   = "hold"
+)
+
+type Result struct {
+	Verdict     string
+	Reason      string
+	Interceptor string
+}
+
+type Message struct {
+	MessageId string
+	UserId    string
+	Category  string
+	Data      string
+
+	attachment []byte
+}
+
+// Interceptor inspects a pending message before it is distributed. An error
+// is logged and turned into the on_error verdict of the chain entry, reject
+// by default, so a message that can't be checked is never let through.
+type Interceptor interface {
+	Intercept(ctx context.Context, message *Message) (Result, error)
+}
+
+var builders = make(map[string]func() (Interceptor, error))
+
+// Register adds an interceptor, build reports invalid configs so NewChain
+// fails at startup.
+func Register(name string, build func() (Interceptor, error)) {
+	builders[name] = build
+}
+
+func Allow() Result {
+	return Result{Verdict: VerdictAllow}
+}
+
+func Reject(reason string) Result {
+	return Result{Verdict: VerdictReject, Reason: reason}
+}
+
+func Hold(reason string) Result {
+	return Result{Verdict: VerdictHold, Reason: reason}
+}
+
+type chainEntry struct {
+	name        string
+	interceptor Interceptor
+	categories  map[string]bool
+	exemptRoles map[string]bool
+	onError     string
+}
+
+type Chain struct {
+	entries []*chainEntry
+}
+
+func NewChain(configs []config.InterceptorConfig) (*Chain, error) {
+	chain := &Chain{}
+	for _, c := range configs {
+		build := builders[c.Name]
+		if build == nil {
+			return nil, fmt.Errorf("unknown interceptor %s", c.Name)
+		}
+		interceptor, err := build()
+		if err != nil {
+			return nil, fmt.Errorf("interceptor %s: %v", c.Name, err)
+		}
+		entry := &chainEntry{
+			name:        c.Name,
+			interceptor: interceptor,
+			categories:  make(map[string]bool),
+			exemptRoles: make(map[string]bool),
+			onError:     c.OnError,
+		}
+		switch entry.onError {
+		case "":
+			entry.onError = VerdictReject
+		case VerdictReject, VerdictHold:
+		default:
+			return nil, fmt.Errorf("interceptor %s: on_error must be reject or hold, got %s", c.Name, c.OnError)
+		}
+		for _, category := range c.Categories {
+			entry.categories[category] = true
+		}
+		for _, role := range c.ExemptRoles {
+			entry.exemptRoles[role] = true
+		}
+		chain.entries = append(chain.entries, entry)
+	}
+	return chain, nil
+}
+
+// Run stops at the first interceptor that does not allow the message.
+func (chain *Chain) Run(ctx context.Context, message *Message, role string) Result {
+	for _, entry := range chain.entries {
+		if entry.exemptRoles[role] {
+			continue
+		}
+		if len(entry.categories) > 0 && !entry.categories[message.Category] {
+			continue
+		}
+		result, err := entry.interceptor.Intercept(ctx, message)
+		if err != nil {
+			session.Logger(ctx).Errorf("Interceptor %s ERROR: %+v", entry.name, err)
+			return Result{Verdict: entry.onError, Reason: errorReason(err), Interceptor: entry.name}
+		}
+		if result.Verdict == VerdictAllow || result.Verdict == "" {
+			continue
+		}
+		result.Interceptor = entry.name
+		return result
+	}
+	return Allow()
+}
+
+// errorReason keeps the reason within the moderations column.
+func errorReason(err error) string {
+	reason := []rune("Interceptor error: " + err.Error())
+	if len(reason) > 512 {
+		reason = reason[:512]
+	}
+	return string(reason)
+}
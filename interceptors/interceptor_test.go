@@ -0,0 +1,65 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubInterceptor struct {
+	result Result
+	err    error
+	calls  int
+}
+
+func (i *stubInterceptor) Intercept(ctx context.Context, message *Message) (Result, error) {
+	i.calls++
+	return i.result, i.err
+}
+
+func TestChain(t *testing.T) {
+	assert := assert.New(t)
+	ctx := session.WithLogger(context.Background(), durable.BuildLogger())
+
+	broken := &stubInterceptor{result: Allow(), err: errors.New("attachment unreadable")}
+	clean := &stubInterceptor{result: Allow()}
+	Register("test-broken", func() (Interceptor, error) { return broken, nil })
+	Register("test-clean", func() (Interceptor, error) { return clean, nil })
+	Register("test-invalid", func() (Interceptor, error) { return nil, errors.New("endpoint required") })
+
+	_, err := NewChain([]config.InterceptorConfig{{Name: "test-missing"}})
+	assert.NotNil(err)
+	_, err = NewChain([]config.InterceptorConfig{{Name: "test-clean", OnError: "allow"}})
+	assert.NotNil(err)
+	_, err = NewChain([]config.InterceptorConfig{{Name: "test-clean"}, {Name: "test-invalid"}})
+	assert.EqualError(err, "interceptor test-invalid: endpoint required")
+
+	image := &Message{MessageId: "m", Category: "PLAIN_IMAGE"}
+	chain, err := NewChain([]config.InterceptorConfig{{Name: "test-broken"}, {Name: "test-clean"}})
+	assert.Nil(err)
+	result := chain.Run(ctx, image, "user")
+	assert.Equal(VerdictReject, result.Verdict)
+	assert.Equal("test-broken", result.Interceptor)
+	assert.Equal("Interceptor error: attachment unreadable", result.Reason)
+	assert.Equal(0, clean.calls)
+
+	chain, err = NewChain([]config.InterceptorConfig{{Name: "test-broken", OnError: "hold"}, {Name: "test-clean"}})
+	assert.Nil(err)
+	result = chain.Run(ctx, image, "user")
+	assert.Equal(VerdictHold, result.Verdict)
+
+	chain, err = NewChain([]config.InterceptorConfig{
+		{Name: "test-broken", Categories: []string{"PLAIN_TEXT"}},
+		{Name: "test-broken", ExemptRoles: []string{"admin"}},
+		{Name: "test-clean"},
+	})
+	assert.Nil(err)
+	result = chain.Run(ctx, image, "admin")
+	assert.Equal(VerdictAllow, result.Verdict)
+	assert.Equal(1, clean.calls)
+}
@@ -0,0 +1,28 @@
+package interceptors
+
+import (
+	"context"
+	"encoding/base64"
+	"regexp"
+
+	"mvdan.cc/xurls"
+)
+
+func init() {
+	Register("link", func() (Interceptor, error) { return &linkInterceptor{re: xurls.Relaxed()}, nil })
+}
+
+type linkInterceptor struct {
+	re *regexp.Regexp
+}
+
+func (i *linkInterceptor) Intercept(ctx context.Context, message *Message) (Result, error) {
+	data, err := base64.StdEncoding.DecodeString(message.Data)
+	if err != nil {
+		return Allow(), err
+	}
+	if i.re.Match(data) {
+		return Reject("Message contains link"), nil
+	}
+	return Allow(), nil
+}
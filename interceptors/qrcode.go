@@ -4,11 +4,17 @@ import (
 	"bytes"
 	"context"
 
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 	"github.com/tuotoo/qrcode"
 )
 
 func CheckQRCode(ctx context.Context, data []byte) (bool, error) {
+	err := checkImageSize(data, config.AppConfig.System.ImageClassifier.MaxPixels)
+	if err != nil {
+		session.Logger(ctx).Errorf("CheckQRCode ERROR: %+v", err)
+		return false, err
+	}
 	qrmatrix, err := qrcode.Decode(bytes.NewReader(data))
 	if err != nil {
 		session.Logger(ctx).Errorf("CheckQRCode Decode ERROR: %+v", err)
@@ -20,3 +26,20 @@ func CheckQRCode(ctx context.Context, data []byte) (bool, error) {
 	}
 	return false, nil
 }
+
+func init() {
+	Register("qrcode", func() (Interceptor, error) { return qrcodeInterceptor{}, nil })
+}
+
+type qrcodeInterceptor struct{}
+
+func (qrcodeInterceptor) Intercept(ctx context.Context, message *Message) (Result, error) {
+	data, err := message.readAttachment(ctx)
+	if err != nil {
+		return Allow(), err
+	}
+	if b, err := CheckQRCode(ctx, data); b && err == nil {
+		return Reject("Image contains QR Code"), nil
+	}
+	return Allow(), nil
+}
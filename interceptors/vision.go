@@ -3,33 +3,56 @@ package interceptors
 import (
 	"bytes"
 	"context"
-	"errors"
-	"fmt"
+	"sync"
 
 	vision "cloud.google.com/go/vision/apiv1"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 	pp "google.golang.org/genproto/googleapis/cloud/vision/v1"
 )
 
-func CheckSex(ctx context.Context, data []byte) (bool, error) {
-	client, err := vision.NewImageAnnotatorClient(ctx)
+var visionLikelihoodScores = map[pp.Likelihood]float64{
+	pp.Likelihood_UNKNOWN:       0,
+	pp.Likelihood_VERY_UNLIKELY: 0.1,
+	pp.Likelihood_UNLIKELY:      0.3,
+	pp.Likelihood_POSSIBLE:      0.5,
+	pp.Likelihood_LIKELY:        0.7,
+	pp.Likelihood_VERY_LIKELY:   0.9,
+}
+
+// visionClassifier asks Google Cloud Vision SafeSearch. The client is
+// created on first use and shared by all the following images.
+type visionClassifier struct {
+	mutex  sync.Mutex
+	client *vision.ImageAnnotatorClient
+}
+
+func (c *visionClassifier) annotator() (*vision.ImageAnnotatorClient, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.client != nil {
+		return c.client, nil
+	}
+	client, err := vision.NewImageAnnotatorClient(context.Background())
 	if err != nil {
-		session.Logger(ctx).Errorf("CheckSex NewImageAnnotatorClient ERROR: %+v", err)
-		return false, nil
+		return nil, err
+	}
+	c.client = client
+	return client, nil
+}
+
+func (c *visionClassifier) Classify(ctx context.Context, data []byte) (float64, error) {
+	client, err := c.annotator()
+	if err != nil {
+		return 0, err
 	}
 	image, err := vision.NewImageFromReader(bytes.NewReader(data))
 	if err != nil {
-		session.Logger(ctx).Errorf("CheckSex NewImageFromReader ERROR: %+v", err)
-		return false, nil
+		return 0, err
 	}
 	safe, err := client.DetectSafeSearch(ctx, image, nil)
 	if err != nil {
-		session.Logger(ctx).Errorf("CheckSex DetectSafeSearch ERROR: %+v", err)
-		return false, nil
-	}
-	session.Logger(ctx).Infof("CheckSex DetectSafeSearch Adult: %s", safe.Adult)
-	if safe.Adult >= pp.Likelihood_LIKELY {
-		return true, errors.New(fmt.Sprintf("Adult level %s", safe.Adult))
+		return 0, err
 	}
-	return false, nil
+	session.Logger(ctx).Infof("DetectSafeSearch Adult: %s", safe.Adult)
+	return visionLikelihoodScores[safe.Adult], nil
 }
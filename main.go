@@ -8,10 +8,14 @@ import (
 	"log"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/MixinNetwork/supergroup.mixin.one/config"
 	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/metrics"
 	"github.com/MixinNetwork/supergroup.mixin.one/services"
 )
 
@@ -21,6 +25,14 @@ func main() {
 	flag.Parse()
 
 	config.LoadConfig(*dir)
+	logger, err := durable.NewLoggerClient(config.AppConfig.Service.LogLevel, config.AppConfig.Service.LogOutput)
+	if err != nil {
+		log.Panicln(err)
+	}
+	durable.SetDefaultLoggerClient(logger)
+	if err := durable.RouteMixinAPI(config.AppConfig.Mixin.APIBase); err != nil {
+		log.Panicln(err)
+	}
 	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
 		config.AppConfig.Database.DatebaseUser,
 		config.AppConfig.Database.DatabasePassword,
@@ -43,6 +55,7 @@ func main() {
 
 	switch *service {
 	case "http":
+		go serveMetrics(config.AppConfig.Service.HTTPListenPort + 1000)
 		if config.AppConfig.System.AccpetWeChatPayment {
 			go services.StartWxPaymentWatch(*service, database)
 		}
@@ -51,13 +64,30 @@ func main() {
 			log.Println(err)
 		}
 	default:
+		go serveMetrics(config.AppConfig.Service.HTTPListenPort + 3000)
+		go http.ListenAndServe(fmt.Sprintf(":%d", config.AppConfig.Service.HTTPListenPort+2000), http.DefaultServeMux)
+		ctx, cancel := context.WithCancel(context.Background())
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
 		go func() {
-			hub := services.NewHub(database)
-			err := hub.StartService(*service)
-			if err != nil {
-				log.Println(err)
-			}
+			sig := <-signals
+			log.Printf("received %s, shutting down", sig)
+			cancel()
 		}()
-		http.ListenAndServe(fmt.Sprintf(":%d", config.AppConfig.Service.HTTPListenPort+2000), http.DefaultServeMux)
+		hub := services.NewHub(database)
+		err := hub.StartService(ctx, *service)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// serveMetrics exposes only /metrics, pprof stays on the default mux.
+func serveMetrics(port int) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	addr := fmt.Sprintf("%s:%d", config.AppConfig.Service.MetricsHost, port)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Println("metrics", addr, err)
 	}
 }
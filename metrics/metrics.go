@@ -0,0 +1,195 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the histogram buckets in seconds for latencies.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var registry struct {
+	sync.Mutex
+	vecs []*vec
+}
+
+type series struct {
+	labels  []string
+	value   float64
+	buckets []uint64
+	count   uint64
+}
+
+type vec struct {
+	sync.Mutex
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+}
+
+func newVec(name, help, kind string, buckets []float64, labels []string) *vec {
+	v := &vec{name: name, help: help, kind: kind, labels: labels, buckets: buckets, series: make(map[string]*series)}
+	if len(labels) == 0 {
+		v.with(nil)
+	}
+	registry.Lock()
+	registry.vecs = append(registry.vecs, v)
+	registry.Unlock()
+	return v
+}
+
+func (v *vec) with(values []string) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s := v.series[key]
+	if s == nil {
+		s = &series{labels: append([]string(nil), values...), buckets: make([]uint64, len(v.buckets))}
+		v.series[key] = s
+	}
+	return s
+}
+
+type Counter struct{ v *vec }
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{newVec(name, help, "counter", nil, labels)}
+}
+
+func (c *Counter) Add(delta float64, values ...string) {
+	c.v.Lock()
+	defer c.v.Unlock()
+	c.v.with(values).value += delta
+}
+
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+type Gauge struct{ v *vec }
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{newVec(name, help, "gauge", nil, labels)}
+}
+
+func (g *Gauge) Set(value float64, values ...string) {
+	g.v.Lock()
+	defer g.v.Unlock()
+	g.v.with(values).value = value
+}
+
+// Reset drops all the series, so label values no longer reported disappear
+// from the output.
+func (g *Gauge) Reset() {
+	g.v.Lock()
+	g.v.series = make(map[string]*series)
+	g.v.Unlock()
+}
+
+type Histogram struct{ v *vec }
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{newVec(name, help, "histogram", buckets, labels)}
+}
+
+func (h *Histogram) Observe(value float64, values ...string) {
+	h.v.Lock()
+	defer h.v.Unlock()
+	s := h.v.with(values)
+	for i, upper := range h.v.buckets {
+		if value <= upper {
+			s.buckets[i]++
+		}
+	}
+	s.count++
+	s.value += value
+}
+
+// WriteTo writes all the registered metrics in the Prometheus text format.
+func WriteTo(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	registry.Lock()
+	vecs := append([]*vec(nil), registry.vecs...)
+	registry.Unlock()
+	for _, v := range vecs {
+		v.write(buf)
+	}
+	return buf.Flush()
+}
+
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteTo(w)
+	})
+}
+
+func (v *vec) write(w *bufio.Writer) {
+	v.Lock()
+	defer v.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escape(v.help, false))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.kind)
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := v.series[k]
+		if v.kind != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", v.name, v.labelPairs(s.labels, ""), formatFloat(s.value))
+			continue
+		}
+		for i, upper := range v.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, v.labelPairs(s.labels, formatFloat(upper)), s.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, v.labelPairs(s.labels, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, v.labelPairs(s.labels, ""), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, v.labelPairs(s.labels, ""), s.count)
+	}
+}
+
+func (v *vec) labelPairs(values []string, le string) string {
+	var pairs []string
+	for i, name := range v.labels {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escape(values[i], true)))
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf("le=\"%s\"", le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escape(s string, quote bool) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if quote {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+	return s
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func exposition(v *vec) string {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	v.write(w)
+	w.Flush()
+	return buf.String()
+}
+
+func TestCounterExposition(t *testing.T) {
+	assert := assert.New(t)
+
+	c := NewCounter("test_counter_total", "Help with \\ and\nnewline.", "kind", "path")
+	c.Inc("b", `say "hi"`)
+	c.Add(2.5, "a", "back\\slash\nline")
+	c.Inc("b", `say "hi"`)
+	assert.Equal(`# HELP test_counter_total Help with \\ and\nnewline.
+# TYPE test_counter_total counter
+test_counter_total{kind="a",path="back\\slash\nline"} 2.5
+test_counter_total{kind="b",path="say \"hi\""} 2
+`, exposition(c.v))
+	assert.Panics(func() { c.Inc("a") })
+
+	plain := NewCounter("test_plain_total", "No labels.")
+	assert.Equal("# HELP test_plain_total No labels.\n# TYPE test_plain_total counter\ntest_plain_total 0\n", exposition(plain.v))
+	plain.Inc()
+	assert.Contains(exposition(plain.v), "test_plain_total 1\n")
+}
+
+func TestGaugeExposition(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGauge("test_gauge", "A gauge.", "shard")
+	g.Set(3, "1")
+	g.Set(1e21, "2")
+	g.Set(0.25, "1")
+	assert.Equal(`# HELP test_gauge A gauge.
+# TYPE test_gauge gauge
+test_gauge{shard="1"} 0.25
+test_gauge{shard="2"} 1e+21
+`, exposition(g.v))
+	g.Reset()
+	assert.Equal("# HELP test_gauge A gauge.\n# TYPE test_gauge gauge\n", exposition(g.v))
+}
+
+func TestHistogramExposition(t *testing.T) {
+	assert := assert.New(t)
+
+	h := NewHistogram("test_duration_seconds", "A histogram.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "/a")
+	h.Observe(0.1, "/a")
+	h.Observe(0.5, "/a")
+	h.Observe(3, "/a")
+	assert.Equal(`# HELP test_duration_seconds A histogram.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{route="/a",le="0.1"} 2
+test_duration_seconds_bucket{route="/a",le="1"} 3
+test_duration_seconds_bucket{route="/a",le="+Inf"} 4
+test_duration_seconds_sum{route="/a"} 3.65
+test_duration_seconds_count{route="/a"} 4
+`, exposition(h.v))
+
+	var buf bytes.Buffer
+	assert.Nil(WriteTo(&buf))
+	assert.Contains(buf.String(), "# TYPE test_duration_seconds histogram\n")
+	assert.Contains(buf.String(), "# TYPE supergroup_pending_messages gauge\n")
+}
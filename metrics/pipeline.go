@@ -0,0 +1,14 @@
+package metrics
+
+var (
+	PendingMessages       = NewGauge("supergroup_pending_messages", "Messages waiting to be checked and distributed.")
+	DistributedBacklog    = NewGauge("supergroup_distributed_messages_backlog", "Distributed messages waiting to be sent.", "shard")
+	DistributedOldestAge  = NewGauge("supergroup_distributed_messages_oldest_age_seconds", "Age of the oldest distributed message waiting to be sent.", "shard")
+	DeliveryBatchDuration = NewHistogram("supergroup_delivery_batch_duration_seconds", "Latency of the batch message requests to the Mixin API.", DefBuckets)
+	DeliveryBatchErrors   = NewCounter("supergroup_delivery_batch_errors_total", "Failed batch message requests to the Mixin API.", "kind")
+	BlazeReconnects       = NewCounter("supergroup_blaze_reconnects_total", "Reconnections of the Blaze websocket.")
+	BlazeAcksReceived     = NewCounter("supergroup_blaze_acks_received_total", "Message receipts received from Blaze.", "status")
+	BlazeAcksSent         = NewCounter("supergroup_blaze_acks_sent_total", "Message receipts acknowledged to Blaze.")
+	InterceptorVerdicts   = NewCounter("supergroup_interceptor_verdicts_total", "Messages rejected or held by the interceptors.", "interceptor", "verdict")
+	HTTPRequestDuration   = NewHistogram("supergroup_http_request_duration_seconds", "Latency of the HTTP requests.", DefBuckets, "method", "route", "code")
+)
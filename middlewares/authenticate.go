@@ -46,6 +46,7 @@ func Authenticate(handler http.Handler) http.Handler {
 			handleUnauthorized(handler, w, r)
 		} else {
 			ctx := context.WithValue(r.Context(), keyCurrentUser, user)
+			ctx = session.WithLogger(ctx, session.Logger(ctx).With("user_id", user.UserId))
 			handler.ServeHTTP(w, r.WithContext(ctx))
 		}
 	})
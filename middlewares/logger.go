@@ -13,7 +13,7 @@ func Log(handler http.Handler, client *durable.LoggerClient, service string) htt
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		id := strings.ToUpper(bot.UuidNewV4().String())
 		r.Header["X-Request-Id"] = []string{id}
-		logger := durable.BuildLogger()
+		logger := client.BuildLogger().With("service", service).With("request_id", id)
 		ctx := session.WithLogger(r.Context(), logger)
 		handler.ServeHTTP(w, r.WithContext(ctx))
 	})
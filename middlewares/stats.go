@@ -2,20 +2,72 @@ package middlewares
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"runtime"
+	"strconv"
 	"time"
 
+	"github.com/MixinNetwork/supergroup.mixin.one/metrics"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 	"github.com/MixinNetwork/supergroup.mixin.one/views"
+	"github.com/dimfeld/httptreemux"
 )
 
+var keyRouteLabel = contextValueKey{1001}
+
+// routeLabel is set by the handler of the matched route, Stats reads it once
+// the request is served.
+type routeLabel struct {
+	pattern string
+}
+
+// Router registers the handlers together with their route pattern, which
+// Stats reports as the route label of the requests they serve.
+type Router struct {
+	*httptreemux.TreeMux
+}
+
+func NewRouter() *Router {
+	return &Router{TreeMux: httptreemux.New()}
+}
+
+func (router *Router) GET(path string, handler httptreemux.HandlerFunc) {
+	router.TreeMux.GET(path, routeHandler(path, handler))
+}
+
+func (router *Router) POST(path string, handler httptreemux.HandlerFunc) {
+	router.TreeMux.POST(path, routeHandler(path, handler))
+}
+
+func (router *Router) PUT(path string, handler httptreemux.HandlerFunc) {
+	router.TreeMux.PUT(path, routeHandler(path, handler))
+}
+
+func (router *Router) DELETE(path string, handler httptreemux.HandlerFunc) {
+	router.TreeMux.DELETE(path, routeHandler(path, handler))
+}
+
+func routeHandler(pattern string, handler httptreemux.HandlerFunc) httptreemux.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		if label, ok := r.Context().Value(keyRouteLabel).(*routeLabel); ok {
+			label.pattern = pattern
+		}
+		r = r.WithContext(session.WithLogger(r.Context(), session.Logger(r.Context()).With("route", pattern)))
+		handler(w, r, params)
+	}
+}
+
+// Stats reports the requests by the pattern of the route which served them,
+// the requests served by no route are reported together as unmatched.
 func Stats(handler http.Handler, service string, logRequestBody bool, buildVersion string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		startAt := time.Now()
+		label := &routeLabel{pattern: "unmatched"}
+		r = r.WithContext(context.WithValue(r.Context(), keyRouteLabel, label))
 
 		if r.ContentLength > 0 && r.Body != nil {
 			p, err := ioutil.ReadAll(r.Body)
@@ -43,6 +95,7 @@ func Stats(handler http.Handler, service string, logRequestBody bool, buildVersi
 		w.Header().Set("X-Runtime", fmt.Sprintf("%f", spent.Seconds()))
 		w.WriteHeader(rec.Code)
 		contentLength, _ := rec.Body.WriteTo(w)
-		session.Logger(r.Context()).Infof("{%s %s RESPOND %d bytes FINISHED %d IN %f seconds}", r.Method, r.URL, contentLength, rec.Code, spent.Seconds())
+		metrics.HTTPRequestDuration.Observe(spent.Seconds(), r.Method, label.pattern, strconv.Itoa(rec.Code))
+		session.Logger(r.Context()).With("route", label.pattern).Infof("{%s %s RESPOND %d bytes FINISHED %d IN %f seconds}", r.Method, r.URL, contentLength, rec.Code, spent.Seconds())
 	})
 }
@@ -0,0 +1,45 @@
+package middlewares
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/metrics"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsRouteLabel(t *testing.T) {
+	assert := assert.New(t)
+
+	router := NewRouter()
+	router.GET("/packets/:id/claim", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		w.WriteHeader(http.StatusOK)
+	})
+	router.POST("/coupons/:code", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	handler := Stats(router, "http", false, "test")
+
+	serve := func(method, path string) int {
+		r := httptest.NewRequest(method, path, nil)
+		r = r.WithContext(session.WithLogger(r.Context(), durable.BuildLogger()))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	assert.Equal(http.StatusOK, serve("GET", "/packets/claim/claim"))
+	assert.Equal(http.StatusAccepted, serve("POST", "/coupons/SUMMER"))
+	assert.Equal(http.StatusNotFound, serve("GET", "/missing/42"))
+
+	var buf bytes.Buffer
+	assert.Nil(metrics.WriteTo(&buf))
+	out := buf.String()
+	assert.Contains(out, `supergroup_http_request_duration_seconds_count{method="GET",route="/packets/:id/claim",code="200"} 1`)
+	assert.Contains(out, `supergroup_http_request_duration_seconds_count{method="POST",route="/coupons/:code",code="202"} 1`)
+	assert.Contains(out, `supergroup_http_request_duration_seconds_count{method="GET",route="unmatched",code="404"} 1`)
+	assert.NotContains(out, "/missing/42")
+}
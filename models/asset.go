@@ -22,7 +22,8 @@ CREATE TABLE IF NOT EXISTS assets (
 	name             VARCHAR(512) NOT NULL,
 	icon_url         VARCHAR(1024) NOT NULL,
 	price_btc        VARCHAR(128) NOT NULL,
-	price_usd        VARCHAR(128) NOT NULL
+	price_usd        VARCHAR(128) NOT NULL,
+	updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
 `
 
@@ -131,7 +132,7 @@ func upsertAssets(ctx context.Context, assets []*Asset) error {
 		}
 		values.WriteString(fmt.Sprintf("('%s','%s','%s','%s','%s','%s')", a.AssetId, a.Symbol, a.Name, a.IconURL, a.PriceBTC, a.PriceUSD))
 	}
-	query := fmt.Sprintf("INSERT INTO assets (%s) VALUES %s ON CONFLICT (asset_id) DO UPDATE SET (icon_url,price_btc,price_usd)=(EXCLUDED.icon_url, EXCLUDED.price_btc, EXCLUDED.price_usd)", strings.Join(assetsColumns, ","), values.String())
+	query := fmt.Sprintf("INSERT INTO assets (%s) VALUES %s ON CONFLICT (asset_id) DO UPDATE SET (icon_url,price_btc,price_usd,updated_at)=(EXCLUDED.icon_url, EXCLUDED.price_btc, EXCLUDED.price_usd, EXCLUDED.updated_at)", strings.Join(assetsColumns, ","), values.String())
 	_, err := session.Database(ctx).ExecContext(ctx, query)
 	return err
 }
@@ -0,0 +1,206 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/lib/pq"
+)
+
+const (
+	BackfillMaxMessages = 1000
+
+	BackfillBackoffBase = 10 * time.Second
+	BackfillBackoffMax  = 10 * time.Minute
+)
+
+const backfills_DDL = `
+CREATE TABLE IF NOT EXISTS backfills (
+	user_id           VARCHAR(36) PRIMARY KEY CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+	created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	attempts          INTEGER NOT NULL DEFAULT 0,
+	last_error        VARCHAR(1024) NOT NULL DEFAULT '',
+	next_attempt_at   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS backfills_createdx ON backfills(created_at);
+`
+
+// queueBackfillInTx schedules the history and the pinned messages of the
+// group for a new member, the messages are copied later by ProcessBackfill
+// outside the join transaction.
+func queueBackfillInTx(ctx context.Context, tx *sql.Tx, userId string) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO backfills (user_id,created_at) VALUES ($1,$2) ON CONFLICT (user_id) DO NOTHING", userId, time.Now())
+	return err
+}
+
+// ListPendingBackfills skips the backfills waiting for their next attempt and
+// the ones which have used up backfill.max_attempts.
+func ListPendingBackfills(ctx context.Context, limit int) ([]string, error) {
+	query := "SELECT user_id FROM backfills WHERE attempts<$1 AND next_attempt_at<=$2 ORDER BY created_at LIMIT $3"
+	rows, err := session.Database(ctx).QueryContext(ctx, query, config.AppConfig.System.Backfill.MaxAttempts, time.Now(), limit)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// FailBackfill schedules the next attempt with exponential backoff, the
+// backfill is kept with its last error once max_attempts is reached.
+func FailBackfill(ctx context.Context, userId, reason string) error {
+	if r := []rune(reason); len(r) > 1024 {
+		reason = string(r[:1024])
+	}
+	query := `UPDATE backfills SET
+		attempts=attempts+1,
+		last_error=$1,
+		next_attempt_at=$2::TIMESTAMPTZ + LEAST($3 * POWER(2, LEAST(attempts, 30)), $4) * INTERVAL '1 millisecond'
+		WHERE user_id=$5`
+	_, err := session.Database(ctx).ExecContext(ctx, query, reason, time.Now(), BackfillBackoffBase.Seconds()*1000, BackfillBackoffMax.Seconds()*1000, userId)
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+func ProcessBackfill(ctx context.Context, userId string) error {
+	messages, err := readBackfillMessages(ctx)
+	if err != nil {
+		return err
+	}
+	pins, err := ListPins(ctx)
+	if err != nil {
+		return err
+	}
+	messages = mergePinnedMessages(messages, pins)
+	preserveQuotes := config.AppConfig.System.Backfill.PreserveQuotes
+	var values bytes.Buffer
+	for _, msg := range messages {
+		if msg.Category == MessageCategoryMessageRecall {
+			// a malformed recall can't be replayed for anyone, skip it.
+			var recallMessage RecallMessage
+			data, err := base64.StdEncoding.DecodeString(msg.Data)
+			if err != nil {
+				continue
+			}
+			err = json.Unmarshal(data, &recallMessage)
+			if err != nil {
+				continue
+			}
+
+			r := RecallMessage{
+				MessageId: UniqueConversationId(userId, recallMessage.MessageId),
+			}
+			data, err = json.Marshal(r)
+			if err != nil {
+				return session.BadDataError(ctx)
+			}
+			msg.Data = base64.StdEncoding.EncodeToString(data)
+		}
+
+		quoteMessageId := ""
+		if preserveQuotes && msg.QuoteMessageId != "" {
+			quoteMessageId = UniqueConversationId(userId, msg.QuoteMessageId)
+		}
+		messageId := UniqueConversationId(userId, msg.MessageId)
+		dm, err := createDistributeMessage(ctx, messageId, msg.MessageId, quoteMessageId, msg.UserId, userId, msg.Category, msg.Data)
+		if err != nil {
+			return session.TransactionError(ctx, err)
+		}
+		if values.Len() > 0 {
+			values.WriteString(",")
+		}
+		values.WriteString(distributedMessageValuesString(dm.MessageId, dm.ConversationId, dm.RecipientId, dm.UserId, dm.ParentId, dm.QuoteMessageId, dm.Shard, dm.Category, dm.Data, dm.Status))
+	}
+	err = session.Database(ctx).RunInTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if v := values.String(); v != "" {
+			query := fmt.Sprintf("INSERT INTO distributed_messages (%s) VALUES %s ON CONFLICT (message_id) DO NOTHING", strings.Join(distributedMessagesCols, ","), v)
+			_, err := tx.ExecContext(ctx, query)
+			if err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM backfills WHERE user_id=$1", userId)
+		return err
+	})
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+// mergePinnedMessages adds the pinned messages missing from the history, so
+// new members always get them, then keeps the result oldest first.
+func mergePinnedMessages(messages []*Message, pins []*Pin) []*Message {
+	set := make(map[string]bool)
+	for _, m := range messages {
+		set[m.MessageId] = true
+	}
+	for _, pin := range pins {
+		if !set[pin.MessageId] {
+			messages = append(messages, pin.Message)
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].CreatedAt.Before(messages[j].CreatedAt) })
+	return messages
+}
+
+// readBackfillMessages returns the messages picked by the backfill policy,
+// oldest first.
+func readBackfillMessages(ctx context.Context) ([]*Message, error) {
+	policy := config.AppConfig.System.Backfill
+	if policy.Count < 0 {
+		return nil, nil
+	}
+	filters := []string{"state=$1"}
+	args := []interface{}{MessageStateSuccess}
+	if policy.Window > 0 {
+		args = append(args, time.Now().Add(-policy.Window))
+		filters = append(filters, fmt.Sprintf("updated_at>=$%d", len(args)))
+	}
+	if len(policy.Categories) > 0 {
+		args = append(args, pq.Array(policy.Categories))
+		filters = append(filters, fmt.Sprintf("category=ANY($%d)", len(args)))
+	}
+	limit := int64(policy.Count)
+	if limit <= 0 || limit > BackfillMaxMessages {
+		limit = BackfillMaxMessages
+	}
+	args = append(args, limit)
+	query := fmt.Sprintf("SELECT %s FROM messages WHERE %s ORDER BY updated_at DESC LIMIT $%d", strings.Join(messagesCols, ","), strings.Join(filters, " AND "), len(args))
+	rows, err := session.Database(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var messages []*Message
+	for rows.Next() {
+		m, err := messageFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		messages = append(messages, m)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].CreatedAt.Before(messages[j].CreatedAt) })
+	return messages, nil
+}
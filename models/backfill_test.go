@@ -0,0 +1,113 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackfillPolicy(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	sender := &User{UserId: bot.UuidNewV4().String(), ActiveAt: time.Now()}
+	var first *Message
+	for i, category := range []string{MessageCategoryPlainText, MessageCategoryPlainSticker, MessageCategoryPlainText} {
+		t := time.Now().Add(time.Duration(i-3) * time.Hour)
+		quote := ""
+		if first != nil {
+			quote = first.MessageId
+		}
+		data := base64.StdEncoding.EncodeToString([]byte("hello"))
+		message, err := CreateMessage(ctx, sender, bot.UuidNewV4().String(), category, quote, data, t, t)
+		assert.Nil(err)
+		assert.NotNil(message)
+		err = message.Distribute(ctx)
+		assert.Nil(err)
+		if first == nil {
+			first = message
+		}
+	}
+
+	policy := &config.AppConfig.System.Backfill
+	policy.Count = 2
+	messages, err := readBackfillMessages(ctx)
+	assert.Nil(err)
+	assert.Len(messages, 2)
+	assert.True(messages[0].CreatedAt.Before(messages[1].CreatedAt))
+	assert.Equal(MessageCategoryPlainSticker, messages[0].Category)
+
+	policy.Count = 0
+	policy.Categories = []string{MessageCategoryPlainText}
+	messages, err = readBackfillMessages(ctx)
+	assert.Nil(err)
+	assert.Len(messages, 2)
+
+	policy.Window = 90 * time.Minute
+	messages, err = readBackfillMessages(ctx)
+	assert.Nil(err)
+	assert.Len(messages, 1)
+	assert.Equal(first.MessageId, messages[0].QuoteMessageId)
+
+	policy.PreserveQuotes = true
+	li := &User{UserId: bot.UuidNewV4().String()}
+	err = ProcessBackfill(ctx, li.UserId)
+	assert.Nil(err)
+	dms, err := testReadDistributedMessages(ctx)
+	assert.Nil(err)
+	assert.Len(dms, 1)
+	assert.Equal(li.UserId, dms[0].RecipientId)
+	assert.Equal(UniqueConversationId(li.UserId, first.MessageId), dms[0].QuoteMessageId)
+}
+
+func TestFailBackfill(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	policy := &config.AppConfig.System.Backfill
+	policy.MaxAttempts = 2
+	userId := bot.UuidNewV4().String()
+	_, err := session.Database(ctx).ExecContext(ctx, "INSERT INTO backfills (user_id) VALUES ($1)", userId)
+	assert.Nil(err)
+	ids, err := ListPendingBackfills(ctx, 10)
+	assert.Nil(err)
+	assert.Equal([]string{userId}, ids)
+
+	err = FailBackfill(ctx, userId, "bad data")
+	assert.Nil(err)
+	ids, err = ListPendingBackfills(ctx, 10)
+	assert.Nil(err)
+	assert.Len(ids, 0)
+
+	_, err = session.Database(ctx).ExecContext(ctx, "UPDATE backfills SET next_attempt_at=$1 WHERE user_id=$2", time.Now().Add(-time.Second), userId)
+	assert.Nil(err)
+	ids, err = ListPendingBackfills(ctx, 10)
+	assert.Nil(err)
+	assert.Equal([]string{userId}, ids)
+
+	err = FailBackfill(ctx, userId, "bad data")
+	assert.Nil(err)
+	_, err = session.Database(ctx).ExecContext(ctx, "UPDATE backfills SET next_attempt_at=$1 WHERE user_id=$2", time.Now().Add(-time.Second), userId)
+	assert.Nil(err)
+	ids, err = ListPendingBackfills(ctx, 10)
+	assert.Nil(err)
+	assert.Len(ids, 0)
+
+	sender := &User{UserId: bot.UuidNewV4().String(), ActiveAt: time.Now()}
+	data := base64.StdEncoding.EncodeToString([]byte("malformed"))
+	recall, err := CreateMessage(ctx, sender, bot.UuidNewV4().String(), MessageCategoryMessageRecall, "", data, time.Now(), time.Now())
+	assert.Nil(err)
+	assert.NotNil(recall)
+	_, err = session.Database(ctx).ExecContext(ctx, "UPDATE messages SET state=$1 WHERE message_id=$2", MessageStateSuccess, recall.MessageId)
+	assert.Nil(err)
+	policy.Count, policy.Window, policy.Categories = 0, 0, nil
+	err = ProcessBackfill(ctx, bot.UuidNewV4().String())
+	assert.Nil(err)
+}
@@ -18,6 +18,17 @@ const (
 )
 
 const (
+	dropTransfersDDL           = `DROP TABLE IF EXISTS transfers;`
+	dropQuotesDDL              = `DROP TABLE IF EXISTS quotes;`
+	dropOrdersDDL              = `DROP TABLE IF EXISTS orders;`
+	dropScheduledMessagesDDL   = `DROP TABLE IF EXISTS scheduled_messages;`
+	dropPinsDDL                = `DROP TABLE IF EXISTS pins;`
+	dropBackfillsDDL           = `DROP TABLE IF EXISTS backfills;`
+	dropMessageReceiptsDDL     = `DROP TABLE IF EXISTS message_receipts;`
+	dropMessageStatsDDL        = `DROP TABLE IF EXISTS message_stats;`
+	dropModerationsDDL         = `DROP TABLE IF EXISTS moderations;`
+	dropRateLimitsDDL          = `DROP TABLE IF EXISTS rate_limits;`
+	dropMutesDDL               = `DROP TABLE IF EXISTS mutes;`
 	dropCouponsDDL             = `DROP TABLE IF EXISTS coupons;`
 	dropPropertiesDDL          = `DROP TABLE IF EXISTS properties;`
 	dropParticipantsDDL        = `DROP TABLE IF EXISTS participants;`
@@ -46,6 +57,17 @@ func teardownTestContext(ctx context.Context) {
 		dropPacketsDDL,
 		dropPropertiesDDL,
 		dropCouponsDDL,
+		dropMutesDDL,
+		dropRateLimitsDDL,
+		dropModerationsDDL,
+		dropMessageStatsDDL,
+		dropMessageReceiptsDDL,
+		dropBackfillsDDL,
+		dropPinsDDL,
+		dropScheduledMessagesDDL,
+		dropOrdersDDL,
+		dropQuotesDDL,
+		dropTransfersDDL,
 	}
 	for _, q := range tables {
 		if _, err := db.Exec(q); err != nil {
@@ -75,6 +97,17 @@ func setupTestContext() context.Context {
 		participants_DDL,
 		properties_DDL,
 		coupons_DDL,
+		mutes_DDL,
+		rate_limits_DDL,
+		moderations_DDL,
+		message_stats_DDL,
+		message_receipts_DDL,
+		backfills_DDL,
+		pins_DDL,
+		scheduled_messages_DDL,
+		order_DDL,
+		quotes_DDL,
+		transfers_DDL,
 	}
 	for _, q := range tables {
 		if _, err := db.Exec(q); err != nil {
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
 	"github.com/MixinNetwork/supergroup.mixin.one/durable"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 	"github.com/lib/pq"
@@ -164,7 +165,7 @@ func (user *User) Coupons(ctx context.Context) ([]*Coupon, error) {
 }
 
 func Occupied(ctx context.Context, code string, user *User) (*Coupon, error) {
-	if user.State != PaymentStatePending {
+	if !user.CanPay() {
 		return nil, session.ForbiddenError(ctx)
 	}
 	var coupon *Coupon
@@ -186,7 +187,7 @@ func Occupied(ctx context.Context, code string, user *User) (*Coupon, error) {
 		if err != nil {
 			return err
 		}
-		return user.paymentInTx(ctx, tx, PayMethodCoupon)
+		return user.paymentInTx(ctx, tx, PayMethodCoupon, config.FindMembershipPlan(""))
 	})
 	if err != nil {
 		if sessionErr, ok := err.(session.Error); ok {
@@ -28,6 +28,7 @@ const (
 
 	MessageStatusSent      = "SENT"
 	MessageStatusDelivered = "DELIVERED"
+	MessageStatusFailed    = "FAILED"
 )
 
 const distributed_messages_DDL = `
@@ -42,16 +43,19 @@ CREATE TABLE IF NOT EXISTS distributed_messages (
 	category              VARCHAR(512) NOT NULL,
 	data                  TEXT NOT NULL,
 	status                VARCHAR(512) NOT NULL,
-	created_at            TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	created_at            TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	attempts              INTEGER NOT NULL DEFAULT 0,
+	last_error            VARCHAR(1024) NOT NULL DEFAULT '',
+	next_attempt_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
 
 CREATE INDEX IF NOT EXISTS message_shard_statusx ON distributed_messages(shard, status, created_at);
 `
 
-var distributedMessagesCols = []string{"message_id", "conversation_id", "recipient_id", "user_id", "parent_id", "quote_message_id", "shard", "category", "data", "status", "created_at"}
+var distributedMessagesCols = []string{"message_id", "conversation_id", "recipient_id", "user_id", "parent_id", "quote_message_id", "shard", "category", "data", "status", "created_at", "attempts", "last_error", "next_attempt_at"}
 
 func (dm *DistributedMessage) values() []interface{} {
-	return []interface{}{dm.MessageId, dm.ConversationId, dm.RecipientId, dm.UserId, dm.ParentId, dm.QuoteMessageId, dm.Shard, dm.Category, dm.Data, dm.Status, dm.CreatedAt}
+	return []interface{}{dm.MessageId, dm.ConversationId, dm.RecipientId, dm.UserId, dm.ParentId, dm.QuoteMessageId, dm.Shard, dm.Category, dm.Data, dm.Status, dm.CreatedAt, dm.Attempts, dm.LastError, dm.NextAttemptAt}
 }
 
 type DistributedMessage struct {
@@ -66,6 +70,9 @@ type DistributedMessage struct {
 	Data           string
 	Status         string
 	CreatedAt      time.Time
+	Attempts       int64
+	LastError      string
+	NextAttemptAt  time.Time
 }
 
 func createDistributeMessage(ctx context.Context, messageId, parentId, quoteMessageId, userId, recipientId, category, data string) (*DistributedMessage, error) {
@@ -80,6 +87,7 @@ func createDistributeMessage(ctx context.Context, messageId, parentId, quoteMess
 		Data:           data,
 		Status:         MessageStatusSent,
 		CreatedAt:      time.Now(),
+		NextAttemptAt:  time.Now(),
 	}
 	shard, err := shardId(dm.ConversationId, dm.RecipientId)
 	if err != nil {
@@ -116,6 +124,7 @@ func (message *Message) Distribute(ctx context.Context) error {
 		}
 		var last time.Time
 		var values bytes.Buffer
+		var count int
 		if len(users) > 0 {
 			messageIds := make([]string, len(users))
 			for i, user := range users {
@@ -163,6 +172,7 @@ func (message *Message) Distribute(ctx context.Context) error {
 				values.WriteString(distributedMessageValuesString(dm.MessageId, dm.ConversationId, dm.RecipientId, dm.UserId, dm.ParentId, dm.QuoteMessageId, dm.Shard, dm.Category, dm.Data, dm.Status))
 			}
 			message.LastDistributeAt = last
+			count = i
 		}
 		if len(users) < DistributeSubscriberLimit {
 			message.LastDistributeAt = time.Now()
@@ -173,6 +183,10 @@ func (message *Message) Distribute(ctx context.Context) error {
 			if err != nil {
 				return err
 			}
+			err = incrementMessageSentCount(ctx, tx, message.MessageId, count)
+			if err != nil {
+				return err
+			}
 			v := values.String()
 			if v != "" {
 				query := fmt.Sprintf("INSERT INTO distributed_messages (%s) VALUES %s", strings.Join(distributedMessagesCols, ","), values.String())
@@ -237,6 +251,9 @@ func (message *Message) Leapfrog(ctx context.Context, reason string) error {
 		if err != nil {
 			return err
 		}
+		if values.Len() == 0 {
+			return nil
+		}
 		query := fmt.Sprintf("INSERT INTO distributed_messages (%s) VALUES %s", strings.Join(distributedMessagesCols, ","), values.String())
 		_, err = tx.ExecContext(ctx, query)
 		return err
@@ -261,8 +278,8 @@ func createSystemDistributedMessage(ctx context.Context, user *User, category, d
 
 func PendingActiveDistributedMessages(ctx context.Context, shard string, limit int64) ([]*DistributedMessage, error) {
 	var messages []*DistributedMessage
-	query := fmt.Sprintf("SELECT %s FROM distributed_messages WHERE shard=$1 AND status=$2 ORDER BY shard,status,created_at LIMIT $3", strings.Join(distributedMessagesCols, ","))
-	rows, err := session.Database(ctx).QueryContext(ctx, query, shard, MessageStatusSent, limit)
+	query := fmt.Sprintf("SELECT %s FROM distributed_messages WHERE shard=$1 AND status=$2 AND next_attempt_at<=$3 ORDER BY shard,status,created_at LIMIT $4", strings.Join(distributedMessagesCols, ","))
+	rows, err := session.Database(ctx).QueryContext(ctx, query, shard, MessageStatusSent, time.Now(), limit)
 	if err != nil {
 		return messages, session.TransactionError(ctx, err)
 	}
@@ -289,9 +306,108 @@ func UpdateMessagesStatus(ctx context.Context, messages []*DistributedMessage) e
 	return nil
 }
 
-func CleanUpExpiredDistributedMessages(ctx context.Context, shard string) (int64, error) {
-	query := fmt.Sprintf("DELETE FROM distributed_messages WHERE shard=$1 AND status=$2 AND created_at<$3")
-	r, err := session.Database(ctx).ExecContext(ctx, query, shard, MessageStatusDelivered, time.Now().Add(-1*time.Hour))
+// FailDistributedMessages schedules the next attempt with exponential
+// backoff, or marks the messages FAILED once the retry budget is spent.
+func FailDistributedMessages(ctx context.Context, messages []*DistributedMessage, reason string) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	retry := config.AppConfig.System.DeliveryRetry
+	if r := []rune(reason); len(r) > 1024 {
+		reason = string(r[:1024])
+	}
+	ids := make([]string, len(messages))
+	for i, m := range messages {
+		ids[i] = m.MessageId
+	}
+	query := fmt.Sprintf(`UPDATE distributed_messages SET
+		attempts=attempts+1,
+		last_error=$1,
+		next_attempt_at=$2::TIMESTAMPTZ + LEAST($3 * POWER(2, LEAST(attempts, 30)), $4) * INTERVAL '1 millisecond',
+		status=CASE WHEN attempts+1>=$5 THEN $6 ELSE status END
+		WHERE message_id IN ('%s') AND status=$7`, strings.Join(ids, "','"))
+	_, err := session.Database(ctx).ExecContext(ctx, query, reason, time.Now(), retry.BackoffBase.Seconds()*1000, retry.BackoffMax.Seconds()*1000, retry.MaxAttempts, MessageStatusFailed, MessageStatusSent)
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+// DeadLetterRecipientMessages marks every pending delivery to the recipient
+// FAILED at once, for errors that no retry can fix.
+func DeadLetterRecipientMessages(ctx context.Context, recipientId, reason string) error {
+	if r := []rune(reason); len(r) > 1024 {
+		reason = string(r[:1024])
+	}
+	query := "UPDATE distributed_messages SET (status,attempts,last_error)=($1,attempts+1,$2) WHERE recipient_id=$3 AND status=$4"
+	_, err := session.Database(ctx).ExecContext(ctx, query, MessageStatusFailed, reason, recipientId, MessageStatusSent)
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+type ShardBacklog struct {
+	Shard    string
+	Count    int64
+	OldestAt time.Time
+}
+
+// ListShardBacklogs returns the count and the oldest of the messages still
+// to be sent for each shard with any.
+func ListShardBacklogs(ctx context.Context) ([]*ShardBacklog, error) {
+	rows, err := session.Database(ctx).QueryContext(ctx, "SELECT shard,COUNT(*),MIN(created_at) FROM distributed_messages WHERE status=$1 GROUP BY shard", MessageStatusSent)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var backlogs []*ShardBacklog
+	for rows.Next() {
+		var b ShardBacklog
+		err := rows.Scan(&b.Shard, &b.Count, &b.OldestAt)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		backlogs = append(backlogs, &b)
+	}
+	return backlogs, nil
+}
+
+func ListFailedDistributedMessages(ctx context.Context, limit int64) ([]*DistributedMessage, error) {
+	var messages []*DistributedMessage
+	query := fmt.Sprintf("SELECT %s FROM distributed_messages WHERE status=$1 ORDER BY created_at DESC LIMIT $2", strings.Join(distributedMessagesCols, ","))
+	rows, err := session.Database(ctx).QueryContext(ctx, query, MessageStatusFailed, limit)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		m, err := distributedMessageFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
+
+// RequeueDistributedMessages resets the retry budget of FAILED deliveries,
+// all of them when ids is empty, and returns how many were requeued.
+func (user *User) RequeueDistributedMessages(ctx context.Context, ids []string) (int64, error) {
+	if !user.isAdmin() {
+		return 0, session.ForbiddenError(ctx)
+	}
+	for _, id := range ids {
+		if _, err := bot.UuidFromString(id); err != nil {
+			return 0, session.BadDataError(ctx)
+		}
+	}
+	query := "UPDATE distributed_messages SET (status,attempts,last_error,next_attempt_at)=($1,0,'',$2) WHERE status=$3"
+	if len(ids) > 0 {
+		query = query + fmt.Sprintf(" AND message_id IN ('%s')", strings.Join(ids, "','"))
+	}
+	r, err := session.Database(ctx).ExecContext(ctx, query, MessageStatusSent, time.Now(), MessageStatusFailed)
 	if err != nil {
 		return 0, session.TransactionError(ctx, err)
 	}
@@ -302,6 +418,41 @@ func CleanUpExpiredDistributedMessages(ctx context.Context, shard string) (int64
 	return count, nil
 }
 
+// CleanUpExpiredDistributedMessages keeps the group message of the deleted
+// deliveries in message_receipts, for the acks which arrive later.
+func CleanUpExpiredDistributedMessages(ctx context.Context, shard string) (int64, error) {
+	query := `WITH d AS (DELETE FROM distributed_messages WHERE shard=$1 AND status=$2 AND created_at<$3 RETURNING message_id,parent_id),
+		r AS (INSERT INTO message_receipts (message_id,parent_id,status,updated_at) SELECT message_id,parent_id,'',$4::TIMESTAMP WITH TIME ZONE FROM d WHERE parent_id IN (SELECT parent_id FROM message_stats) ON CONFLICT (message_id) DO NOTHING)
+		SELECT COUNT(*) FROM d`
+	var count int64
+	err := session.Database(ctx).QueryRowContext(ctx, query, shard, MessageStatusDelivered, time.Now().Add(-1*time.Hour), time.Now()).Scan(&count)
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	return count, nil
+}
+
+// FindDistributedMessageRecipientIds returns the distinct recipients of the
+// distributed messages which still exist.
+func FindDistributedMessageRecipientIds(ctx context.Context, ids []string) ([]string, error) {
+	query := "SELECT DISTINCT recipient_id FROM distributed_messages WHERE message_id=ANY($1)"
+	rows, err := session.Database(ctx).QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var recipients []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		recipients = append(recipients, id)
+	}
+	return recipients, nil
+}
+
 func FindDistributedMessageRecipientId(ctx context.Context, id string) (string, error) {
 	query := "SELECT recipient_id FROM distributed_messages WHERE message_id=$1"
 	var recipient string
@@ -345,12 +496,13 @@ func readDistributedMessagesByIds(ctx context.Context, ids []string) (map[string
 
 func distributedMessageFromRow(row durable.Row) (*DistributedMessage, error) {
 	var m DistributedMessage
-	err := row.Scan(&m.MessageId, &m.ConversationId, &m.RecipientId, &m.UserId, &m.ParentId, &m.QuoteMessageId, &m.Shard, &m.Category, &m.Data, &m.Status, &m.CreatedAt)
+	err := row.Scan(&m.MessageId, &m.ConversationId, &m.RecipientId, &m.UserId, &m.ParentId, &m.QuoteMessageId, &m.Shard, &m.Category, &m.Data, &m.Status, &m.CreatedAt, &m.Attempts, &m.LastError, &m.NextAttemptAt)
 	return &m, err
 }
 
 func distributedMessageValuesString(id, conversationId, recipientId, userId, parentId, quoteMessageId, shard, category, data, status string) string {
-	return fmt.Sprintf("('%s','%s','%s','%s','%s', '%s','%s','%s','%s','%s', '%s')", id, conversationId, recipientId, userId, parentId, quoteMessageId, shard, category, data, status, string(pq.FormatTimestamp(time.Now())))
+	now := string(pq.FormatTimestamp(time.Now()))
+	return fmt.Sprintf("('%s','%s','%s','%s','%s', '%s','%s','%s','%s','%s', '%s', 0, '', '%s')", id, conversationId, recipientId, userId, parentId, quoteMessageId, shard, category, data, status, now, now)
 }
 
 func shardId(cid, uid string) (string, error) {
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistributedMessageRetry(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	config.AppConfig.System.DeliveryRetry.MaxAttempts = 2
+	admin := &User{UserId: "e9a5b807-fa8b-455a-8dfa-b189d28310ff"}
+	li := &User{UserId: bot.UuidNewV4().String()}
+	data := base64.StdEncoding.EncodeToString([]byte("hello"))
+	err := createSystemDistributedMessage(ctx, li, MessageCategoryPlainText, data)
+	assert.Nil(err)
+	dms, err := testReadDistributedMessages(ctx)
+	assert.Nil(err)
+	assert.Len(dms, 1)
+
+	err = FailDistributedMessages(ctx, dms, "Server Error")
+	assert.Nil(err)
+	dms, err = testReadDistributedMessages(ctx)
+	assert.Nil(err)
+	assert.Len(dms, 0)
+	_, err = session.Database(ctx).ExecContext(ctx, "UPDATE distributed_messages SET next_attempt_at=$1", time.Now().Add(-time.Second))
+	assert.Nil(err)
+	dms, err = testReadDistributedMessages(ctx)
+	assert.Nil(err)
+	assert.Len(dms, 1)
+	assert.Equal(int64(1), dms[0].Attempts)
+	assert.Equal("Server Error", dms[0].LastError)
+	assert.True(dms[0].NextAttemptAt.Before(time.Now()))
+
+	err = FailDistributedMessages(ctx, dms, "Server Error")
+	assert.Nil(err)
+	failed, err := ListFailedDistributedMessages(ctx, 100)
+	assert.Nil(err)
+	assert.Len(failed, 1)
+	assert.Equal(MessageStatusFailed, failed[0].Status)
+	assert.Equal(int64(2), failed[0].Attempts)
+
+	count, err := li.RequeueDistributedMessages(ctx, nil)
+	assert.NotNil(err)
+	assert.Equal(int64(0), count)
+	count, err = admin.RequeueDistributedMessages(ctx, []string{"invalid"})
+	assert.NotNil(err)
+	count, err = admin.RequeueDistributedMessages(ctx, []string{failed[0].MessageId})
+	assert.Nil(err)
+	assert.Equal(int64(1), count)
+	dms, err = testReadDistributedMessages(ctx)
+	assert.Nil(err)
+	assert.Len(dms, 1)
+	assert.Equal(int64(0), dms[0].Attempts)
+	failed, err = ListFailedDistributedMessages(ctx, 100)
+	assert.Nil(err)
+	assert.Len(failed, 0)
+}
+
+func TestDeadLetterRecipientMessages(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	li := &User{UserId: bot.UuidNewV4().String()}
+	lu := &User{UserId: bot.UuidNewV4().String()}
+	data := base64.StdEncoding.EncodeToString([]byte("hello"))
+	for _, u := range []*User{li, li, lu} {
+		err := createSystemDistributedMessage(ctx, u, MessageCategoryPlainText, data)
+		assert.Nil(err)
+	}
+	dms, err := testReadDistributedMessages(ctx)
+	assert.Nil(err)
+	assert.Len(dms, 3)
+
+	err = DeadLetterRecipientMessages(ctx, li.UserId, "Forbidden")
+	assert.Nil(err)
+	dms, err = testReadDistributedMessages(ctx)
+	assert.Nil(err)
+	assert.Len(dms, 1)
+	assert.Equal(lu.UserId, dms[0].RecipientId)
+	failed, err := ListFailedDistributedMessages(ctx, 100)
+	assert.Nil(err)
+	assert.Len(failed, 2)
+	assert.Equal("Forbidden", failed[0].LastError)
+}
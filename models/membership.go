@@ -0,0 +1,110 @@
+package models
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	number "github.com/MixinNetwork/go-number"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/lib/pq"
+)
+
+// PlanTraceId is the transfer trace to buy the plan, the first plan keeps the
+// user trace id so that clients unaware of plans still work.
+func (user *User) PlanTraceId(plan *config.MembershipPlan) string {
+	if plan.Name == config.FindMembershipPlan("").Name {
+		return user.TraceId
+	}
+	return bot.UniqueConversationId(user.TraceId, "plan:"+plan.Name)
+}
+
+func (user *User) PlanTraceIds() map[string]string {
+	traces := make(map[string]string)
+	for i := range config.AppConfig.System.MembershipPlans {
+		plan := &config.AppConfig.System.MembershipPlans[i]
+		traces[plan.Name] = user.PlanTraceId(plan)
+	}
+	return traces
+}
+
+func (user *User) MembershipPlanByTrace(traceId string) *config.MembershipPlan {
+	for i := range config.AppConfig.System.MembershipPlans {
+		plan := &config.AppConfig.System.MembershipPlans[i]
+		if user.PlanTraceId(plan) == traceId {
+			return plan
+		}
+	}
+	return nil
+}
+
+func MembershipPlanAccepts(plan *config.MembershipPlan, assetId, amount string) bool {
+	for _, asset := range plan.Assets {
+		if asset.AssetId == assetId && number.FromString(amount).Equal(number.FromString(asset.Amount).RoundFloor(8)) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemindExpiringMemberships tells the members whose membership expires
+// within the remind window to renew, each membership term is reminded once.
+func RemindExpiringMemberships(ctx context.Context, limit int64) (int, error) {
+	query := fmt.Sprintf("UPDATE users SET reminded_at=$1 WHERE user_id IN (SELECT user_id FROM users WHERE state=$2 AND expires_at>$1 AND expires_at<$3 AND reminded_at IS NULL LIMIT $4) RETURNING %s", strings.Join(usersCols, ","))
+	remindAt := time.Now().Add(config.AppConfig.System.Membership.RemindBefore)
+	users, err := updateMembershipUsers(ctx, query, time.Now(), PaymentStatePaid, remindAt, limit)
+	if err != nil {
+		return 0, err
+	}
+	for _, user := range users {
+		tips := fmt.Sprintf(config.AppConfig.MessageTemplate.MessageTipsExpiring, user.ExpiresAt.Time.Format("2006-01-02 15:04:05"))
+		text := base64.StdEncoding.EncodeToString([]byte(tips))
+		if err := createSystemDistributedMessage(ctx, user, MessageCategoryPlainText, text); err != nil {
+			return 0, session.TransactionError(ctx, err)
+		}
+	}
+	return len(users), nil
+}
+
+// ExpireMemberships downgrades the expired members back to pending, and drops
+// their subscription so that messages are no longer distributed to them.
+func ExpireMemberships(ctx context.Context, limit int64) (int, error) {
+	operators := config.AppConfig.System.OperatorList
+	if operators == nil {
+		operators = []string{}
+	}
+	query := fmt.Sprintf("UPDATE users SET (state,subscribed_at)=($1,$2) WHERE user_id IN (SELECT user_id FROM users WHERE state=$3 AND expires_at<$4 AND user_id<>ALL($5) LIMIT $6) RETURNING %s", strings.Join(usersCols, ","))
+	users, err := updateMembershipUsers(ctx, query, PaymentStatePending, time.Time{}, PaymentStatePaid, time.Now(), pq.Array(operators), limit)
+	if err != nil {
+		return 0, err
+	}
+	text := base64.StdEncoding.EncodeToString([]byte(config.AppConfig.MessageTemplate.MessageTipsExpired))
+	for _, user := range users {
+		if err := createSystemDistributedMessage(ctx, user, MessageCategoryPlainText, text); err != nil {
+			return 0, session.TransactionError(ctx, err)
+		}
+	}
+	return len(users), nil
+}
+
+func updateMembershipUsers(ctx context.Context, query string, args ...interface{}) ([]*User, error) {
+	rows, err := session.Database(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		user, err := userFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
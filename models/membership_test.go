@@ -0,0 +1,134 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMembershipExpiry(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	system := &config.AppConfig.System
+	payToJoin, membership, plans := system.PayToJoin, system.Membership, system.MembershipPlans
+	defer func() { system.PayToJoin, system.Membership, system.MembershipPlans = payToJoin, membership, plans }()
+	system.PayToJoin = true
+	system.Membership.RemindBefore = 72 * time.Hour
+	system.MembershipPlans = []config.MembershipPlan{
+		{Name: "monthly", Duration: 30 * 24 * time.Hour},
+		{Name: "lifetime"},
+	}
+	monthly, lifetime := config.FindMembershipPlan("monthly"), config.FindMembershipPlan("lifetime")
+
+	li, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "name", "http://localhost")
+	assert.Nil(err)
+	assert.Equal(PaymentStatePending, li.State)
+	assert.True(li.CanPay())
+	traceId := li.TraceId
+
+	err = li.Payment(ctx, monthly)
+	assert.Nil(err)
+	li, err = FindUser(ctx, li.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePaid, li.State)
+	assert.True(li.ExpiresAt.Valid)
+	assert.True(li.CanPay())
+	assert.NotEqual(traceId, li.TraceId)
+	expiresAt := li.ExpiresAt.Time
+
+	err = li.Payment(ctx, monthly)
+	assert.Nil(err)
+	li, err = FindUser(ctx, li.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePaid, li.State)
+	assert.True(li.ExpiresAt.Time.Sub(expiresAt) > 29*24*time.Hour)
+
+	count, err := RemindExpiringMemberships(ctx, 100)
+	assert.Nil(err)
+	assert.Equal(0, count)
+	_, err = session.Database(ctx).ExecContext(ctx, "UPDATE users SET expires_at=$1 WHERE user_id=$2", time.Now().Add(time.Hour), li.UserId)
+	assert.Nil(err)
+	count, err = RemindExpiringMemberships(ctx, 100)
+	assert.Nil(err)
+	assert.Equal(1, count)
+	count, err = RemindExpiringMemberships(ctx, 100)
+	assert.Nil(err)
+	assert.Equal(0, count)
+
+	count, err = ExpireMemberships(ctx, 100)
+	assert.Nil(err)
+	assert.Equal(0, count)
+	_, err = session.Database(ctx).ExecContext(ctx, "UPDATE users SET expires_at=$1 WHERE user_id=$2", time.Now().Add(-time.Minute), li.UserId)
+	assert.Nil(err)
+	count, err = ExpireMemberships(ctx, 100)
+	assert.Nil(err)
+	assert.Equal(1, count)
+	li, err = FindUser(ctx, li.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePending, li.State)
+	assert.True(li.SubscribedAt.IsZero())
+	users, err := subscribedUsers(ctx, genesisStartedAt(), 100)
+	assert.Nil(err)
+	assert.Len(users, 0)
+
+	err = li.Payment(ctx, monthly)
+	assert.Nil(err)
+	li, err = FindUser(ctx, li.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePaid, li.State)
+	assert.True(li.ExpiresAt.Time.After(time.Now().Add(29 * 24 * time.Hour)))
+	assert.False(li.RemindedAt.Valid)
+
+	offer, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1002", "name", "http://localhost")
+	assert.Nil(err)
+	err = offer.Payment(ctx, lifetime)
+	assert.Nil(err)
+	offer, err = FindUser(ctx, offer.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePaid, offer.State)
+	assert.False(offer.ExpiresAt.Valid)
+	assert.False(offer.CanPay())
+
+	err = li.Payment(ctx, lifetime)
+	assert.Nil(err)
+	li, err = FindUser(ctx, li.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePaid, li.State)
+	assert.False(li.ExpiresAt.Valid)
+}
+
+func TestMembershipPlans(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	system := &config.AppConfig.System
+	plans := system.MembershipPlans
+	defer func() { system.MembershipPlans = plans }()
+	system.MembershipPlans = []config.MembershipPlan{
+		{Name: "monthly", Assets: []config.PaymentAsset{{AssetId: "965e5c6e-434c-3fa9-b780-c50f43cd955c", Amount: "1000"}}},
+		{Name: "yearly", Assets: []config.PaymentAsset{{AssetId: "965e5c6e-434c-3fa9-b780-c50f43cd955c", Amount: "10000.123456789"}}},
+	}
+	monthly, yearly := config.FindMembershipPlan("monthly"), config.FindMembershipPlan("yearly")
+	assert.Equal(monthly, config.FindMembershipPlan(""))
+	assert.Nil(config.FindMembershipPlan("weekly"))
+
+	user := &User{TraceId: bot.UuidNewV4().String()}
+	assert.Equal(user.TraceId, user.PlanTraceId(monthly))
+	assert.NotEqual(user.TraceId, user.PlanTraceId(yearly))
+	assert.Equal(monthly, user.MembershipPlanByTrace(user.TraceId))
+	assert.Equal(yearly, user.MembershipPlanByTrace(user.PlanTraceId(yearly)))
+	assert.Nil(user.MembershipPlanByTrace(bot.UuidNewV4().String()))
+	assert.Len(user.PlanTraceIds(), 2)
+
+	assert.True(MembershipPlanAccepts(monthly, "965e5c6e-434c-3fa9-b780-c50f43cd955c", "1000.00"))
+	assert.False(MembershipPlanAccepts(monthly, "965e5c6e-434c-3fa9-b780-c50f43cd955c", "999"))
+	assert.False(MembershipPlanAccepts(monthly, "c94ac88f-4671-3976-b60a-09064f1811e8", "1000"))
+	assert.True(MembershipPlanAccepts(yearly, "965e5c6e-434c-3fa9-b780-c50f43cd955c", "10000.12345678"))
+}
@@ -19,6 +19,7 @@ import (
 const (
 	MessageStatePending = "pending"
 	MessageStateSuccess = "success"
+	MessageStateHeld    = "held"
 
 	MessageCategoryMessageRecall = "MESSAGE_RECALL"
 	MessageCategoryPlainText     = "PLAIN_TEXT"
@@ -32,6 +33,8 @@ const (
 )
 
 const messages_DDL = `
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
 CREATE TABLE IF NOT EXISTS messages (
 	message_id            VARCHAR(36) PRIMARY KEY CHECK (message_id ~* '^[0-9a-f-]{36,36}$'),
 	user_id	              VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
@@ -41,10 +44,13 @@ CREATE TABLE IF NOT EXISTS messages (
 	created_at            TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
 	updated_at            TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
 	state                 VARCHAR(128) NOT NULL,
-	last_distribute_at    TIMESTAMP WITH TIME ZONE NOT NULL
+	last_distribute_at    TIMESTAMP WITH TIME ZONE NOT NULL,
+	search_text           TEXT NOT NULL DEFAULT ''
 );
 
 CREATE INDEX IF NOT EXISTS messages_state_updatedx ON messages(state, updated_at);
+CREATE INDEX IF NOT EXISTS messages_created_messagex ON messages(created_at, message_id);
+CREATE INDEX IF NOT EXISTS messages_search_textx ON messages USING GIN (search_text gin_trgm_ops);
 `
 
 var messagesCols = []string{"message_id", "user_id", "category", "quote_message_id", "data", "created_at", "updated_at", "state", "last_distribute_at"}
@@ -77,8 +83,26 @@ func CreateMessage(ctx context.Context, user *User, messageId, category, quoteMe
 	if len(data) > 5*1024 {
 		return nil, nil
 	}
-	if user.UserId != config.AppConfig.Mixin.ClientId && !user.isAdmin() {
-		if category != MessageCategoryMessageRecall && !durable.Allow(user.UserId) {
+	if user.UserId != config.AppConfig.Mixin.ClientId && !user.isAdmin() && category != MessageCategoryMessageRecall {
+		mute, err := readActiveMute(ctx, user.UserId)
+		if err != nil {
+			return nil, err
+		}
+		if mute != nil {
+			tips := fmt.Sprintf(config.AppConfig.MessageTemplate.MessageTipsMuted, mute.ExpiresAt.Format("2006-01-02 15:04:05"))
+			text := base64.StdEncoding.EncodeToString([]byte(tips))
+			if err := createSystemDistributedMessage(ctx, user, MessageCategoryPlainText, text); err != nil {
+				return nil, err
+			}
+			return nil, nil
+		}
+	}
+	if user.UserId != config.AppConfig.Mixin.ClientId && category != MessageCategoryMessageRecall {
+		allowed, err := allowMessage(ctx, user, category)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
 			text := base64.StdEncoding.EncodeToString([]byte(config.AppConfig.MessageTemplate.MessageTipsTooMany))
 			if err := createSystemDistributedMessage(ctx, user, MessageCategoryPlainText, text); err != nil {
 				return nil, err
@@ -140,6 +164,7 @@ func CreateMessage(ctx context.Context, user *User, messageId, category, quoteMe
 			}
 		}
 	}
+	var recalled string
 	if category == MessageCategoryMessageRecall {
 		bytes, err := base64.StdEncoding.DecodeString(data)
 		if err != nil {
@@ -160,16 +185,65 @@ func CreateMessage(ctx context.Context, user *User, messageId, category, quoteMe
 		if user.isAdmin() {
 			message.UserId = m.UserId
 		}
+		recalled = m.MessageId
 	}
-	params, positions := compileTableQuery(messagesCols)
-	query := fmt.Sprintf("INSERT INTO messages (%s) VALUES (%s) ON CONFLICT (message_id) DO NOTHING", params, positions)
-	_, err := session.Database(ctx).ExecContext(ctx, query, message.values()...)
+	// a recalled message is unpinned with the recall, never without it.
+	err := session.Database(ctx).RunInTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		err := createMessageInTx(ctx, tx, message)
+		if err != nil || recalled == "" {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM pins WHERE message_id=$1", recalled)
+		return err
+	})
 	if err != nil {
 		return nil, session.TransactionError(ctx, err)
 	}
 	return message, nil
 }
 
+func (user *User) RecallMessage(ctx context.Context, messageId string) (*Message, error) {
+	message, err := FindMessage(ctx, messageId)
+	if err != nil {
+		return nil, err
+	} else if message == nil {
+		return nil, session.NotFoundError(ctx)
+	}
+	switch message.Category {
+	case MessageCategoryPlainText,
+		MessageCategoryPlainImage,
+		MessageCategoryPlainVideo,
+		MessageCategoryPlainData,
+		MessageCategoryPlainSticker,
+		MessageCategoryPlainContact,
+		MessageCategoryPlainAudio:
+	default:
+		return nil, session.ForbiddenError(ctx)
+	}
+	if message.UserId != user.UserId && !user.isAdmin() {
+		return nil, session.ForbiddenError(ctx)
+	}
+	data, err := json.Marshal(RecallMessage{MessageId: message.MessageId})
+	if err != nil {
+		return nil, session.ServerError(ctx, err)
+	}
+	t := time.Now()
+	id := UniqueConversationId(message.MessageId, user.UserId)
+	return CreateMessage(ctx, user, id, MessageCategoryMessageRecall, "", base64.StdEncoding.EncodeToString(data), t, t)
+}
+
+func createMessageInTx(ctx context.Context, tx *sql.Tx, message *Message) error {
+	var text string
+	if message.Category == MessageCategoryPlainText {
+		b, _ := base64.StdEncoding.DecodeString(message.Data)
+		text = string(b)
+	}
+	params, positions := compileTableQuery(messagesCols)
+	query := fmt.Sprintf("INSERT INTO messages (%s,search_text) VALUES (%s,$%d) ON CONFLICT (message_id) DO NOTHING", params, positions, len(messagesCols)+1)
+	_, err := tx.ExecContext(ctx, query, append(message.values(), text)...)
+	return err
+}
+
 func createSystemMessage(ctx context.Context, tx *sql.Tx, category, data string) error {
 	mixin := config.AppConfig.Mixin
 	t := time.Now()
@@ -210,10 +284,19 @@ func createSystemJoinMessage(ctx context.Context, tx *sql.Tx, user *User) error
 	return err
 }
 
+func PendingMessagesCount(ctx context.Context) (int64, error) {
+	var count int64
+	err := session.Database(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM messages WHERE state=$1", MessageStatePending).Scan(&count)
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	return count, nil
+}
+
 func PendingMessages(ctx context.Context, limit int64) ([]*Message, error) {
 	var messages []*Message
-	query := fmt.Sprintf("SELECT %s FROM messages WHERE state=$1 ORDER BY state,updated_at LIMIT $2", strings.Join(messagesCols, ","))
-	rows, err := session.Database(ctx).QueryContext(ctx, query, MessageStatePending, limit)
+	query := fmt.Sprintf("SELECT %s FROM messages WHERE state=$1 AND updated_at<=$2 ORDER BY state,updated_at LIMIT $3", strings.Join(messagesCols, ","))
+	rows, err := session.Database(ctx).QueryContext(ctx, query, MessageStatePending, time.Now(), limit)
 	if err != nil {
 		return nil, session.TransactionError(ctx, err)
 	}
@@ -240,7 +323,7 @@ func FindMessage(ctx context.Context, id string) (*Message, error) {
 }
 
 func LastestMessageWithUser(ctx context.Context, limit int64) ([]*Message, error) {
-	query := "SELECT messages.message_id,messages.category,messages.data,messages.created_at,users.full_name FROM messages LEFT JOIN users ON messages.user_id=users.user_id ORDER BY updated_at DESC LIMIT $1"
+	query := "SELECT messages.message_id,messages.user_id,messages.category,messages.data,messages.created_at,users.full_name FROM messages LEFT JOIN users ON messages.user_id=users.user_id ORDER BY updated_at DESC LIMIT $1"
 	rows, err := session.Database(ctx).QueryContext(ctx, query, limit)
 	if err != nil {
 		return nil, session.TransactionError(ctx, err)
@@ -250,7 +333,7 @@ func LastestMessageWithUser(ctx context.Context, limit int64) ([]*Message, error
 	var messages []*Message
 	for rows.Next() {
 		var m Message
-		err := rows.Scan(&m.MessageId, &m.Category, &m.Data, &m.CreatedAt, &m.FullName)
+		err := rows.Scan(&m.MessageId, &m.UserId, &m.Category, &m.Data, &m.CreatedAt, &m.FullName)
 		if err != nil {
 			return nil, session.TransactionError(ctx, err)
 		}
@@ -284,25 +367,6 @@ func readLastestMessages(ctx context.Context, limit int64) ([]*Message, error) {
 	return messages, nil
 }
 
-func readLastestMessagesInTx(ctx context.Context, tx *sql.Tx, limit int64) ([]*Message, error) {
-	var messages []*Message
-	query := fmt.Sprintf("SELECT %s FROM messages WHERE state=$1 ORDER BY updated_at DESC LIMIT $2", strings.Join(messagesCols, ","))
-	rows, err := tx.QueryContext(ctx, query, MessageStateSuccess, limit)
-	if err != nil {
-		return nil, session.TransactionError(ctx, err)
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		m, err := messageFromRow(rows)
-		if err != nil {
-			return nil, session.TransactionError(ctx, err)
-		}
-		messages = append(messages, m)
-	}
-	return messages, nil
-}
-
 type RecallMessage struct {
 	MessageId string `json:"message_id"`
 }
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+type MessageSearch struct {
+	Query    string
+	UserId   string
+	Category string
+	Since    time.Time
+	Until    time.Time
+	Before   *MessageCursor
+	After    *MessageCursor
+	Limit    int64
+}
+
+// MessageCursor is the position of a message in the search results, the
+// message id orders the messages created at the same time.
+type MessageCursor struct {
+	CreatedAt time.Time
+	MessageId string
+}
+
+func (m *Message) Cursor() *MessageCursor {
+	return &MessageCursor{CreatedAt: m.CreatedAt, MessageId: m.MessageId}
+}
+
+// String formats the time in UTC, a "+" offset put back into a query string
+// unencoded would be decoded as a space.
+func (c *MessageCursor) String() string {
+	return c.CreatedAt.UTC().Format(time.RFC3339Nano) + "_" + c.MessageId
+}
+
+func ParseMessageCursor(s string) (*MessageCursor, error) {
+	parts := strings.SplitN(s, "_", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid message cursor %s", s)
+	}
+	t, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, err
+	}
+	return &MessageCursor{CreatedAt: t, MessageId: parts[1]}, nil
+}
+
+// SearchMessages returns the matching messages newest first. Every word of
+// the query must appear in the text, matched by the trigram index so CJK
+// text without spaces is found too. Before pages towards older messages and
+// After towards newer ones, both exclusive.
+func SearchMessages(ctx context.Context, search *MessageSearch) ([]*Message, error) {
+	var filters []string
+	var args []interface{}
+	add := func(filter string, arg interface{}) {
+		args = append(args, arg)
+		filters = append(filters, fmt.Sprintf(filter, len(args)))
+	}
+	for _, word := range strings.Fields(search.Query) {
+		add("m.search_text ILIKE $%d", "%"+likeEscaper.Replace(word)+"%")
+	}
+	if search.UserId != "" {
+		add("m.user_id=$%d", search.UserId)
+	}
+	if search.Category != "" {
+		add("m.category=$%d", search.Category)
+	}
+	if !search.Since.IsZero() {
+		add("m.created_at>=$%d", search.Since)
+	}
+	if !search.Until.IsZero() {
+		add("m.created_at<$%d", search.Until)
+	}
+	order := "DESC"
+	cursor := func(op string, c *MessageCursor) {
+		args = append(args, c.CreatedAt, c.MessageId)
+		filters = append(filters, fmt.Sprintf("(m.created_at,m.message_id)%s($%d,$%d)", op, len(args)-1, len(args)))
+	}
+	if search.After != nil {
+		cursor(">", search.After)
+		order = "ASC"
+	} else if search.Before != nil {
+		cursor("<", search.Before)
+	}
+	where := ""
+	if len(filters) > 0 {
+		where = "WHERE " + strings.Join(filters, " AND ")
+	}
+	limit := search.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	args = append(args, limit)
+	query := fmt.Sprintf("SELECT m.message_id,m.user_id,m.category,m.data,m.created_at,u.full_name FROM messages m LEFT JOIN users u ON m.user_id=u.user_id %s ORDER BY m.created_at %s,m.message_id %s LIMIT $%d", where, order, order, len(args))
+	rows, err := session.Database(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var messages []*Message
+	for rows.Next() {
+		var m Message
+		err := rows.Scan(&m.MessageId, &m.UserId, &m.Category, &m.Data, &m.CreatedAt, &m.FullName)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		if m.Category == MessageCategoryPlainText {
+			data, _ := base64.StdEncoding.DecodeString(m.Data)
+			m.Data = string(data)
+		} else {
+			m.Data = ""
+		}
+		messages = append(messages, &m)
+	}
+	if order == "ASC" {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	return messages, nil
+}
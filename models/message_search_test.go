@@ -0,0 +1,102 @@
+package models
+
+import (
+	"encoding/base64"
+	"net/url"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchMessages(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	li := &User{UserId: bot.UuidNewV4().String(), ActiveAt: time.Now()}
+	lu := &User{UserId: bot.UuidNewV4().String(), ActiveAt: time.Now()}
+	started := time.Now()
+	for i, text := range []string{"buy cheap tokens", "hello group", "cheap airdrop here", "今天群里有人发空投链接吗"} {
+		user := li
+		if i == 1 {
+			user = lu
+		}
+		data := base64.StdEncoding.EncodeToString([]byte(text))
+		t := started.Add(time.Duration(i%3) * time.Second)
+		message, err := CreateMessage(ctx, user, bot.UuidNewV4().String(), MessageCategoryPlainText, "", data, t, t)
+		assert.Nil(err)
+		assert.NotNil(message)
+	}
+
+	messages, err := SearchMessages(ctx, &MessageSearch{Query: "cheap"})
+	assert.Nil(err)
+	assert.Len(messages, 2)
+	assert.Equal("cheap airdrop here", messages[0].Data)
+	assert.Equal("buy cheap tokens", messages[1].Data)
+	messages, err = SearchMessages(ctx, &MessageSearch{Query: "airdrop cheap"})
+	assert.Nil(err)
+	assert.Len(messages, 1)
+	messages, err = SearchMessages(ctx, &MessageSearch{Query: "空投"})
+	assert.Nil(err)
+	assert.Len(messages, 1)
+	messages, err = SearchMessages(ctx, &MessageSearch{Query: "che%"})
+	assert.Nil(err)
+	assert.Len(messages, 0)
+	messages, err = SearchMessages(ctx, &MessageSearch{UserId: lu.UserId})
+	assert.Nil(err)
+	assert.Len(messages, 1)
+	assert.Equal("hello group", messages[0].Data)
+	messages, err = SearchMessages(ctx, &MessageSearch{Category: MessageCategoryPlainImage})
+	assert.Nil(err)
+	assert.Len(messages, 0)
+	messages, err = SearchMessages(ctx, &MessageSearch{Since: started.Add(time.Second)})
+	assert.Nil(err)
+	assert.Len(messages, 2)
+
+	all, err := SearchMessages(ctx, &MessageSearch{})
+	assert.Nil(err)
+	assert.Len(all, 4)
+	var paged []*Message
+	var before *MessageCursor
+	for {
+		page, err := SearchMessages(ctx, &MessageSearch{Limit: 1, Before: before})
+		assert.Nil(err)
+		if len(page) == 0 {
+			break
+		}
+		paged = append(paged, page...)
+		before = page[0].Cursor()
+	}
+	assert.Len(paged, 4)
+	for i := range all {
+		assert.Equal(all[i].MessageId, paged[i].MessageId)
+	}
+	messages, err = SearchMessages(ctx, &MessageSearch{Limit: 2, After: all[3].Cursor()})
+	assert.Nil(err)
+	assert.Len(messages, 2)
+	assert.Equal(all[1].MessageId, messages[0].MessageId)
+	assert.Equal(all[2].MessageId, messages[1].MessageId)
+
+	cursor, err := ParseMessageCursor(all[0].Cursor().String())
+	assert.Nil(err)
+	assert.Equal(all[0].MessageId, cursor.MessageId)
+	assert.True(all[0].CreatedAt.Equal(cursor.CreatedAt))
+	_, err = ParseMessageCursor(all[0].CreatedAt.Format(time.RFC3339Nano))
+	assert.NotNil(err)
+}
+
+func TestMessageCursorQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	shanghai := time.FixedZone("CST", 8*3600)
+	c := &MessageCursor{CreatedAt: time.Date(2026, 10, 18, 9, 30, 0, 123456000, shanghai), MessageId: "e9a5b807-fa8b-455a-8dfa-b189d28310ff"}
+	assert.Equal("2026-10-18T01:30:00.123456Z_e9a5b807-fa8b-455a-8dfa-b189d28310ff", c.String())
+	query, err := url.ParseQuery("before=" + c.String())
+	assert.Nil(err)
+	cursor, err := ParseMessageCursor(query.Get("before"))
+	assert.Nil(err)
+	assert.True(c.CreatedAt.Equal(cursor.CreatedAt))
+	assert.Equal(c.MessageId, cursor.MessageId)
+}
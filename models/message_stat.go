@@ -0,0 +1,228 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"sort"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/lib/pq"
+)
+
+const (
+	MessageReceiptDelivered = "DELIVERED"
+	MessageReceiptRead      = "READ"
+
+	MessageReceiptRetention = 7 * 24 * time.Hour
+)
+
+const message_stats_DDL = `
+CREATE TABLE IF NOT EXISTS message_stats (
+	parent_id         VARCHAR(36) PRIMARY KEY CHECK (parent_id ~* '^[0-9a-f-]{36,36}$'),
+	sent_count        BIGINT NOT NULL DEFAULT 0,
+	delivered_count   BIGINT NOT NULL DEFAULT 0,
+	read_count        BIGINT NOT NULL DEFAULT 0,
+	updated_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+`
+
+// message_receipts remembers the receipt of each delivery, so repeated acks
+// are counted once. Deliveries without any ack are copied here with an empty
+// status when the distributed messages are cleaned up, so their late acks
+// still count.
+const message_receipts_DDL = `
+CREATE TABLE IF NOT EXISTS message_receipts (
+	message_id        VARCHAR(36) PRIMARY KEY CHECK (message_id ~* '^[0-9a-f-]{36,36}$'),
+	parent_id         VARCHAR(36) NOT NULL CHECK (parent_id ~* '^[0-9a-f-]{36,36}$'),
+	status            VARCHAR(128) NOT NULL,
+	updated_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS message_receipts_updatedx ON message_receipts(updated_at);
+`
+
+type MessageStat struct {
+	MessageId      string
+	UserId         string
+	Category       string
+	Data           string
+	CreatedAt      time.Time
+	SentCount      int64
+	DeliveredCount int64
+	ReadCount      int64
+
+	FullName sql.NullString
+}
+
+func incrementMessageSentCount(ctx context.Context, tx *sql.Tx, parentId string, count int) error {
+	if count == 0 {
+		return nil
+	}
+	query := "INSERT INTO message_stats (parent_id,sent_count,updated_at) VALUES ($1,$2,$3) ON CONFLICT (parent_id) DO UPDATE SET (sent_count,updated_at)=(message_stats.sent_count+EXCLUDED.sent_count,EXCLUDED.updated_at)"
+	_, err := tx.ExecContext(ctx, query, parentId, count, time.Now())
+	return err
+}
+
+type MessageReceipt struct {
+	MessageId string
+	Status    string
+}
+
+// RecordMessageReceipts counts a batch of DELIVERED or READ acks of distributed
+// messages towards the stats of their group messages, each group message is
+// updated once per batch.
+func RecordMessageReceipts(ctx context.Context, receipts []*MessageReceipt) error {
+	latest := make(map[string]string)
+	for _, r := range receipts {
+		if r.Status != MessageReceiptDelivered && r.Status != MessageReceiptRead {
+			continue
+		}
+		if latest[r.MessageId] != MessageReceiptRead {
+			latest[r.MessageId] = r.Status
+		}
+	}
+	if len(latest) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(latest))
+	for id := range latest {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	err := session.Database(ctx).RunInTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		parents, previous, err := readMessageReceipts(ctx, tx, ids)
+		if err != nil {
+			return err
+		}
+		var missing []string
+		for _, id := range ids {
+			if _, found := parents[id]; !found {
+				missing = append(missing, id)
+			}
+		}
+		if len(missing) > 0 {
+			rows, err := tx.QueryContext(ctx, "SELECT message_id,parent_id FROM distributed_messages WHERE message_id=ANY($1)", pq.Array(missing))
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var id, parentId string
+				if err := rows.Scan(&id, &parentId); err != nil {
+					return err
+				}
+				parents[id] = parentId
+			}
+			if err := rows.Err(); err != nil {
+				return err
+			}
+		}
+
+		var messageIds, parentIds, statuses []string
+		delivered, read := make(map[string]int), make(map[string]int)
+		for _, id := range ids {
+			parentId, found := parents[id]
+			status := latest[id]
+			if !found || previous[id] == status || previous[id] == MessageReceiptRead {
+				continue
+			}
+			if previous[id] == "" {
+				delivered[parentId] += 1
+			}
+			if status == MessageReceiptRead {
+				read[parentId] += 1
+			}
+			messageIds = append(messageIds, id)
+			parentIds = append(parentIds, parentId)
+			statuses = append(statuses, status)
+		}
+		if len(messageIds) == 0 {
+			return nil
+		}
+		query := "INSERT INTO message_receipts (message_id,parent_id,status,updated_at) SELECT m,p,s,$4::TIMESTAMP WITH TIME ZONE FROM UNNEST($1::VARCHAR[],$2::VARCHAR[],$3::VARCHAR[]) AS r(m,p,s) ON CONFLICT (message_id) DO UPDATE SET (status,updated_at)=(EXCLUDED.status,EXCLUDED.updated_at)"
+		_, err = tx.ExecContext(ctx, query, pq.Array(messageIds), pq.Array(parentIds), pq.Array(statuses), time.Now())
+		if err != nil {
+			return err
+		}
+		stats := make([]string, 0, len(delivered))
+		for parentId := range delivered {
+			stats = append(stats, parentId)
+		}
+		for parentId := range read {
+			if _, found := delivered[parentId]; !found {
+				stats = append(stats, parentId)
+			}
+		}
+		sort.Strings(stats)
+		for _, parentId := range stats {
+			_, err = tx.ExecContext(ctx, "UPDATE message_stats SET (delivered_count,read_count,updated_at)=(delivered_count+$1,read_count+$2,$3) WHERE parent_id=$4", delivered[parentId], read[parentId], time.Now(), parentId)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+func readMessageReceipts(ctx context.Context, tx *sql.Tx, ids []string) (map[string]string, map[string]string, error) {
+	parents, previous := make(map[string]string), make(map[string]string)
+	rows, err := tx.QueryContext(ctx, "SELECT message_id,parent_id,status FROM message_receipts WHERE message_id=ANY($1) ORDER BY message_id FOR UPDATE", pq.Array(ids))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, parentId, status string
+		if err := rows.Scan(&id, &parentId, &status); err != nil {
+			return nil, nil, err
+		}
+		parents[id], previous[id] = parentId, status
+	}
+	return parents, previous, rows.Err()
+}
+
+func CleanUpExpiredMessageReceipts(ctx context.Context, limit int64) (int64, error) {
+	query := "DELETE FROM message_receipts WHERE message_id IN (SELECT message_id FROM message_receipts WHERE updated_at<$1 LIMIT $2)"
+	r, err := session.Database(ctx).ExecContext(ctx, query, time.Now().Add(-MessageReceiptRetention), limit)
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	count, err := r.RowsAffected()
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	return count, nil
+}
+
+func ListMessageStats(ctx context.Context, limit int64) ([]*MessageStat, error) {
+	query := "SELECT m.message_id,m.user_id,m.category,m.data,m.created_at,s.sent_count,s.delivered_count,s.read_count,u.full_name FROM message_stats s INNER JOIN messages m ON s.parent_id=m.message_id LEFT JOIN users u ON m.user_id=u.user_id ORDER BY m.updated_at DESC LIMIT $1"
+	rows, err := session.Database(ctx).QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var stats []*MessageStat
+	for rows.Next() {
+		var s MessageStat
+		err := rows.Scan(&s.MessageId, &s.UserId, &s.Category, &s.Data, &s.CreatedAt, &s.SentCount, &s.DeliveredCount, &s.ReadCount, &s.FullName)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		if s.Category == MessageCategoryPlainText {
+			data, _ := base64.StdEncoding.DecodeString(s.Data)
+			s.Data = string(data)
+		} else {
+			s.Data = ""
+		}
+		stats = append(stats, &s)
+	}
+	return stats, nil
+}
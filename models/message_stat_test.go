@@ -0,0 +1,85 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageStats(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	system := &config.AppConfig.System
+	payToJoin := system.PayToJoin
+	defer func() { system.PayToJoin = payToJoin }()
+	system.PayToJoin = false
+
+	sender := &User{UserId: bot.UuidNewV4().String(), ActiveAt: time.Now()}
+	for _, id := range []string{"10001", "10002", "10003"} {
+		user, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), id, "name", "http://localhost")
+		assert.Nil(err)
+		err = user.Subscribe(ctx)
+		assert.Nil(err)
+	}
+	data := base64.StdEncoding.EncodeToString([]byte("hello"))
+	message, err := CreateMessage(ctx, sender, bot.UuidNewV4().String(), MessageCategoryPlainText, "", data, time.Now(), time.Now())
+	assert.Nil(err)
+	assert.NotNil(message)
+	err = message.Distribute(ctx)
+	assert.Nil(err)
+	dms, err := testReadDistributedMessages(ctx)
+	assert.Nil(err)
+	assert.Len(dms, 3)
+
+	stats, err := ListMessageStats(ctx, 100)
+	assert.Nil(err)
+	assert.Len(stats, 1)
+	assert.Equal(message.MessageId, stats[0].MessageId)
+	assert.Equal("hello", stats[0].Data)
+	assert.Equal(int64(3), stats[0].SentCount)
+	assert.Equal(int64(0), stats[0].DeliveredCount)
+
+	assert.Nil(RecordMessageReceipts(ctx, []*MessageReceipt{
+		{MessageId: dms[0].MessageId, Status: MessageReceiptDelivered},
+		{MessageId: dms[0].MessageId, Status: MessageReceiptDelivered},
+	}))
+	assert.Nil(RecordMessageReceipts(ctx, []*MessageReceipt{
+		{MessageId: dms[0].MessageId, Status: MessageReceiptRead},
+		{MessageId: dms[0].MessageId, Status: MessageReceiptDelivered},
+		{MessageId: dms[1].MessageId, Status: MessageReceiptRead},
+		{MessageId: bot.UuidNewV4().String(), Status: MessageReceiptRead},
+		{MessageId: dms[1].MessageId, Status: "SENT"},
+	}))
+	assert.Nil(RecordMessageReceipts(ctx, []*MessageReceipt{{MessageId: dms[0].MessageId, Status: MessageReceiptDelivered}}))
+	stats, err = ListMessageStats(ctx, 100)
+	assert.Nil(err)
+	assert.Len(stats, 1)
+	assert.Equal(int64(2), stats[0].DeliveredCount)
+	assert.Equal(int64(2), stats[0].ReadCount)
+	recipients, err := FindDistributedMessageRecipientIds(ctx, []string{dms[0].MessageId, dms[1].MessageId})
+	assert.Nil(err)
+	assert.ElementsMatch([]string{dms[0].RecipientId, dms[1].RecipientId}, recipients)
+
+	_, err = session.Database(ctx).ExecContext(ctx, "UPDATE distributed_messages SET (status,created_at)=($1,$2)", MessageStatusDelivered, time.Now().Add(-2*time.Hour))
+	assert.Nil(err)
+	cleaned, err := testCleanUpExpiredDistributedMessages(ctx)
+	assert.Nil(err)
+	assert.Equal(3, cleaned)
+	assert.Nil(RecordMessageReceipts(ctx, []*MessageReceipt{{MessageId: dms[2].MessageId, Status: MessageReceiptRead}}))
+	stats, err = ListMessageStats(ctx, 100)
+	assert.Nil(err)
+	assert.Len(stats, 1)
+	assert.Equal(int64(3), stats[0].DeliveredCount)
+	assert.Equal(int64(3), stats[0].ReadCount)
+
+	count, err := CleanUpExpiredMessageReceipts(ctx, 100)
+	assert.Nil(err)
+	assert.Equal(int64(0), count)
+}
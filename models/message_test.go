@@ -22,6 +22,11 @@ func TestMessageCRUD(t *testing.T) {
 	ctx := setupTestContext()
 	defer teardownTestContext(ctx)
 
+	system := &config.AppConfig.System
+	payToJoin := system.PayToJoin
+	defer func() { system.PayToJoin = payToJoin }()
+	system.PayToJoin = false
+
 	id, uid := bot.UuidNewV4().String(), bot.UuidNewV4().String()
 	user := &User{UserId: id, ActiveAt: time.Now()}
 	data := base64.StdEncoding.EncodeToString([]byte("hello"))
@@ -123,6 +128,16 @@ func TestMessageCRUD(t *testing.T) {
 	messages, err = LastestMessageWithUser(ctx, 10)
 	assert.Nil(err)
 	assert.Len(messages, 2)
+
+	recall, err := user.RecallMessage(ctx, message.MessageId)
+	assert.Nil(err)
+	assert.NotNil(recall)
+	assert.Equal(MessageCategoryMessageRecall, recall.Category)
+	assert.Equal(UniqueConversationId(message.MessageId, user.UserId), recall.MessageId)
+	_, err = user.RecallMessage(ctx, recall.MessageId)
+	assert.NotNil(err)
+	_, err = user.RecallMessage(ctx, bot.UuidNewV4().String())
+	assert.NotNil(err)
 }
 
 func testReadMessage(ctx context.Context, id string) (*Message, error) {
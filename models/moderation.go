@@ -0,0 +1,251 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/lib/pq"
+)
+
+const (
+	ModerationStatePending  = "pending"
+	ModerationStateApproved = "approved"
+	ModerationStateRejected = "rejected"
+
+	ModerationActionMute = "mute"
+	ModerationActionBan  = "ban"
+)
+
+const moderations_DDL = `
+CREATE TABLE IF NOT EXISTS moderations (
+	message_id        VARCHAR(36) PRIMARY KEY CHECK (message_id ~* '^[0-9a-f-]{36,36}$'),
+	user_id           VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+	category          VARCHAR(512) NOT NULL,
+	interceptor       VARCHAR(128) NOT NULL,
+	reason            VARCHAR(1024) NOT NULL,
+	state             VARCHAR(128) NOT NULL,
+	action            VARCHAR(128) NOT NULL DEFAULT '',
+	decided_by        VARCHAR(36) NOT NULL DEFAULT '',
+	decided_at        TIMESTAMP WITH TIME ZONE,
+	created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS moderations_state_createdx ON moderations(state, created_at);
+`
+
+type Moderation struct {
+	MessageId   string
+	UserId      string
+	Category    string
+	Interceptor string
+	Reason      string
+	State       string
+	Action      string
+	DecidedBy   string
+	DecidedAt   pq.NullTime
+	CreatedAt   time.Time
+
+	FullName sql.NullString
+}
+
+var moderationsCols = []string{"message_id", "user_id", "category", "interceptor", "reason", "state", "action", "decided_by", "decided_at", "created_at"}
+
+func (m *Moderation) values() []interface{} {
+	return []interface{}{m.MessageId, m.UserId, m.Category, m.Interceptor, m.Reason, m.State, m.Action, m.DecidedBy, m.DecidedAt, m.CreatedAt}
+}
+
+func moderationFromRow(row durable.Row) (*Moderation, error) {
+	var m Moderation
+	err := row.Scan(&m.MessageId, &m.UserId, &m.Category, &m.Interceptor, &m.Reason, &m.State, &m.Action, &m.DecidedBy, &m.DecidedAt, &m.CreatedAt)
+	return &m, err
+}
+
+// Flag queues the message for review and forwards it to the operators
+// instead of the group.
+func (message *Message) Flag(ctx context.Context, interceptor, reason string) error {
+	err := session.Database(ctx).RunInTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		return message.createModeration(ctx, tx, interceptor, reason)
+	})
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return message.Leapfrog(ctx, reason)
+}
+
+// Hold queues the message for review without forwarding it to anyone, it
+// leaves the pending messages until an operator approves it.
+func (message *Message) Hold(ctx context.Context, interceptor, reason string) error {
+	err := session.Database(ctx).RunInTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		err := message.createModeration(ctx, tx, interceptor, reason)
+		if err != nil {
+			return err
+		}
+		message.State = MessageStateHeld
+		_, err = tx.ExecContext(ctx, "UPDATE messages SET state=$1 WHERE message_id=$2 AND state=$3", message.State, message.MessageId, MessageStatePending)
+		return err
+	})
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+func (message *Message) createModeration(ctx context.Context, tx *sql.Tx, interceptor, reason string) error {
+	m := &Moderation{
+		MessageId:   message.MessageId,
+		UserId:      message.UserId,
+		Category:    message.Category,
+		Interceptor: interceptor,
+		Reason:      reason,
+		State:       ModerationStatePending,
+		CreatedAt:   time.Now(),
+	}
+	params, positions := compileTableQuery(moderationsCols)
+	query := fmt.Sprintf("INSERT INTO moderations (%s) VALUES (%s) ON CONFLICT (message_id) DO NOTHING", params, positions)
+	_, err := tx.ExecContext(ctx, query, m.values()...)
+	return err
+}
+
+func ListModerations(ctx context.Context, state string, limit int64) ([]*Moderation, error) {
+	cols := make([]string, len(moderationsCols))
+	for i, c := range moderationsCols {
+		cols[i] = "m." + c
+	}
+	query := fmt.Sprintf("SELECT %s,u.full_name FROM moderations m LEFT JOIN users u ON m.user_id=u.user_id WHERE m.state=$1 ORDER BY m.created_at DESC LIMIT $2", strings.Join(cols, ","))
+	rows, err := session.Database(ctx).QueryContext(ctx, query, state, limit)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var moderations []*Moderation
+	for rows.Next() {
+		var m Moderation
+		err := rows.Scan(&m.MessageId, &m.UserId, &m.Category, &m.Interceptor, &m.Reason, &m.State, &m.Action, &m.DecidedBy, &m.DecidedAt, &m.CreatedAt, &m.FullName)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		moderations = append(moderations, &m)
+	}
+	return moderations, nil
+}
+
+// ApproveModeration distributes the flagged or held message to the whole
+// group, the operators who already got it through Leapfrog are skipped.
+func (user *User) ApproveModeration(ctx context.Context, messageId string) (*Moderation, error) {
+	m, err := user.readPendingModeration(ctx, messageId)
+	if err != nil || m == nil {
+		return nil, err
+	}
+	m, err = user.decideModeration(ctx, m, ModerationStateApproved, "")
+	if err != nil {
+		return nil, err
+	}
+	message, err := FindMessage(ctx, m.MessageId)
+	if err != nil {
+		return nil, releaseModeration(ctx, m, err)
+	}
+	if message != nil {
+		message.State = MessageStatePending
+		message.LastDistributeAt = genesisStartedAt()
+		if err := message.Distribute(ctx); err != nil {
+			return nil, releaseModeration(ctx, m, err)
+		}
+	}
+	return m, nil
+}
+
+// RejectModeration keeps the message out of the group, and optionally mutes
+// the sender for duration or bans the sender.
+func (user *User) RejectModeration(ctx context.Context, messageId, action string, duration time.Duration) (*Moderation, error) {
+	switch action {
+	case "", ModerationActionBan:
+	case ModerationActionMute:
+		if duration <= 0 {
+			return nil, session.BadDataError(ctx)
+		}
+	default:
+		return nil, session.BadDataError(ctx)
+	}
+	m, err := user.readPendingModeration(ctx, messageId)
+	if err != nil || m == nil {
+		return nil, err
+	}
+	m, err = user.decideModeration(ctx, m, ModerationStateRejected, action)
+	if err != nil {
+		return nil, err
+	}
+	switch action {
+	case ModerationActionMute:
+		if _, err := user.MuteUser(ctx, m.UserId, duration, m.Reason); err != nil {
+			return nil, releaseModeration(ctx, m, err)
+		}
+	case ModerationActionBan:
+		if _, err := user.CreateBlacklist(ctx, m.UserId); err != nil {
+			return nil, releaseModeration(ctx, m, err)
+		}
+	}
+	return m, nil
+}
+
+func (user *User) readPendingModeration(ctx context.Context, messageId string) (*Moderation, error) {
+	if !user.isAdmin() {
+		return nil, session.ForbiddenError(ctx)
+	}
+	m, err := findModeration(ctx, messageId)
+	if err != nil || m == nil {
+		return nil, err
+	}
+	if m.State != ModerationStatePending {
+		return nil, session.BadDataError(ctx)
+	}
+	return m, nil
+}
+
+// decideModeration claims the pending moderation, only the decision which
+// updated the row may run its side effects.
+func (user *User) decideModeration(ctx context.Context, m *Moderation, state, action string) (*Moderation, error) {
+	m.State = state
+	m.Action = action
+	m.DecidedBy = user.UserId
+	m.DecidedAt = pq.NullTime{Time: time.Now(), Valid: true}
+	r, err := session.Database(ctx).ExecContext(ctx, "UPDATE moderations SET (state,action,decided_by,decided_at)=($1,$2,$3,$4) WHERE message_id=$5 AND state=$6", m.State, m.Action, m.DecidedBy, m.DecidedAt, m.MessageId, ModerationStatePending)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	count, err := r.RowsAffected()
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	if count == 0 {
+		return nil, session.BadDataError(ctx)
+	}
+	return m, nil
+}
+
+// releaseModeration puts the claimed moderation back to pending when its side
+// effects failed, so the decision can be made again.
+func releaseModeration(ctx context.Context, m *Moderation, cause error) error {
+	_, err := session.Database(ctx).ExecContext(ctx, "UPDATE moderations SET (state,action,decided_by,decided_at)=($1,'','',NULL) WHERE message_id=$2 AND state=$3", ModerationStatePending, m.MessageId, m.State)
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return cause
+}
+
+func findModeration(ctx context.Context, messageId string) (*Moderation, error) {
+	query := fmt.Sprintf("SELECT %s FROM moderations WHERE message_id=$1", strings.Join(moderationsCols, ","))
+	row := session.Database(ctx).QueryRowContext(ctx, query, messageId)
+	m, err := moderationFromRow(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return m, nil
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModerationCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	admin := &User{UserId: "e9a5b807-fa8b-455a-8dfa-b189d28310ff"}
+	li, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "name", "http://localhost")
+	assert.Nil(err)
+	assert.NotNil(li)
+
+	data := base64.StdEncoding.EncodeToString([]byte("http://localhost"))
+	message, err := CreateMessage(ctx, li, bot.UuidNewV4().String(), MessageCategoryPlainText, "", data, time.Now(), time.Now())
+	assert.Nil(err)
+	assert.NotNil(message)
+	err = message.Flag(ctx, "link", "Message contains link")
+	assert.Nil(err)
+	err = message.Flag(ctx, "link", "Message contains link")
+	assert.Nil(err)
+	message, err = FindMessage(ctx, message.MessageId)
+	assert.Nil(err)
+	assert.Equal(MessageStateSuccess, message.State)
+	moderations, err := ListModerations(ctx, ModerationStatePending, 100)
+	assert.Nil(err)
+	assert.Len(moderations, 1)
+	assert.Equal("link", moderations[0].Interceptor)
+	assert.Equal("name", moderations[0].FullName.String)
+
+	m, err := li.ApproveModeration(ctx, message.MessageId)
+	assert.NotNil(err)
+	assert.Nil(m)
+	m, err = admin.ApproveModeration(ctx, bot.UuidNewV4().String())
+	assert.Nil(err)
+	assert.Nil(m)
+	m, err = admin.ApproveModeration(ctx, message.MessageId)
+	assert.Nil(err)
+	assert.NotNil(m)
+	assert.Equal(ModerationStateApproved, m.State)
+	assert.Equal(admin.UserId, m.DecidedBy)
+	assert.True(m.DecidedAt.Valid)
+	m, err = admin.ApproveModeration(ctx, message.MessageId)
+	assert.NotNil(err)
+	assert.Nil(m)
+	message, err = FindMessage(ctx, message.MessageId)
+	assert.Nil(err)
+	assert.Equal(MessageStateSuccess, message.State)
+	moderations, err = ListModerations(ctx, ModerationStateApproved, 100)
+	assert.Nil(err)
+	assert.Len(moderations, 1)
+
+	message, err = CreateMessage(ctx, li, bot.UuidNewV4().String(), MessageCategoryPlainText, "", data, time.Now(), time.Now())
+	assert.Nil(err)
+	assert.NotNil(message)
+	err = message.Flag(ctx, "link", "Message contains link")
+	assert.Nil(err)
+	m, err = admin.RejectModeration(ctx, message.MessageId, ModerationActionMute, 0)
+	assert.NotNil(err)
+	assert.Nil(m)
+	m, err = admin.RejectModeration(ctx, message.MessageId, ModerationActionMute, time.Hour)
+	assert.Nil(err)
+	assert.NotNil(m)
+	assert.Equal(ModerationStateRejected, m.State)
+	assert.Equal(ModerationActionMute, m.Action)
+	mute, err := readActiveMute(ctx, li.UserId)
+	assert.Nil(err)
+	assert.NotNil(mute)
+	moderations, err = ListModerations(ctx, ModerationStatePending, 100)
+	assert.Nil(err)
+	assert.Len(moderations, 0)
+
+	message, err = CreateMessage(ctx, li, bot.UuidNewV4().String(), MessageCategoryPlainText, "", data, time.Now(), time.Now())
+	assert.Nil(err)
+	assert.NotNil(message)
+	err = message.Hold(ctx, "nsfw", "Interceptor error: timeout")
+	assert.Nil(err)
+	message, err = FindMessage(ctx, message.MessageId)
+	assert.Nil(err)
+	assert.Equal(MessageStateHeld, message.State)
+	pending, err := PendingMessages(ctx, 100)
+	assert.Nil(err)
+	assert.Len(pending, 0)
+	moderations, err = ListModerations(ctx, ModerationStatePending, 100)
+	assert.Nil(err)
+	assert.Len(moderations, 1)
+	assert.Equal("nsfw", moderations[0].Interceptor)
+	m, err = admin.ApproveModeration(ctx, message.MessageId)
+	assert.Nil(err)
+	assert.NotNil(m)
+	message, err = FindMessage(ctx, message.MessageId)
+	assert.Nil(err)
+	assert.Equal(MessageStateSuccess, message.State)
+
+	message, err = CreateMessage(ctx, li, bot.UuidNewV4().String(), MessageCategoryPlainText, "", data, time.Now(), time.Now())
+	assert.Nil(err)
+	err = message.Flag(ctx, "link", "Message contains link")
+	assert.Nil(err)
+	approve, err := admin.readPendingModeration(ctx, message.MessageId)
+	assert.Nil(err)
+	reject, err := admin.readPendingModeration(ctx, message.MessageId)
+	assert.Nil(err)
+	m, err = admin.decideModeration(ctx, approve, ModerationStateApproved, "")
+	assert.Nil(err)
+	assert.NotNil(m)
+	m, err = admin.decideModeration(ctx, reject, ModerationStateRejected, ModerationActionBan)
+	assert.NotNil(err)
+	assert.Nil(m)
+	err = releaseModeration(ctx, approve, nil)
+	assert.Nil(err)
+	m, err = admin.RejectModeration(ctx, message.MessageId, "", 0)
+	assert.Nil(err)
+	assert.NotNil(m)
+	assert.Equal(ModerationStateRejected, m.State)
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const mutes_DDL = `
+CREATE TABLE IF NOT EXISTS mutes (
+	user_id	          VARCHAR(36) PRIMARY KEY CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+	muted_by          VARCHAR(36) NOT NULL CHECK (muted_by ~* '^[0-9a-f-]{36,36}$'),
+	reason            VARCHAR(512) NOT NULL DEFAULT '',
+	expires_at        TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS mutes_expiresx ON mutes(expires_at);
+`
+
+type Mute struct {
+	UserId    string
+	MutedBy   string
+	Reason    string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+
+	FullName sql.NullString
+}
+
+var mutesCols = []string{"user_id", "muted_by", "reason", "expires_at", "created_at"}
+
+func (m *Mute) values() []interface{} {
+	return []interface{}{m.UserId, m.MutedBy, m.Reason, m.ExpiresAt, m.CreatedAt}
+}
+
+func muteFromRow(row durable.Row) (*Mute, error) {
+	var m Mute
+	err := row.Scan(&m.UserId, &m.MutedBy, &m.Reason, &m.ExpiresAt, &m.CreatedAt)
+	return &m, err
+}
+
+func (user *User) MuteUser(ctx context.Context, userId string, duration time.Duration, reason string) (*Mute, error) {
+	if !user.isAdmin() {
+		return nil, session.ForbiddenError(ctx)
+	}
+	if _, err := bot.UuidFromString(userId); err != nil {
+		return nil, session.BadDataError(ctx)
+	}
+	if config.AppConfig.System.Operators[userId] || duration <= 0 {
+		return nil, session.BadDataError(ctx)
+	}
+	target, err := FindUser(ctx, userId)
+	if err != nil || target == nil {
+		return nil, err
+	}
+	t := time.Now()
+	mute := &Mute{
+		UserId:    userId,
+		MutedBy:   user.UserId,
+		Reason:    reason,
+		ExpiresAt: t.Add(duration),
+		CreatedAt: t,
+		FullName:  sql.NullString{String: target.FullName, Valid: true},
+	}
+	params, positions := compileTableQuery(mutesCols)
+	query := fmt.Sprintf("INSERT INTO mutes (%s) VALUES (%s) ON CONFLICT (user_id) DO UPDATE SET (muted_by,reason,expires_at,created_at)=(EXCLUDED.muted_by,EXCLUDED.reason,EXCLUDED.expires_at,EXCLUDED.created_at)", params, positions)
+	_, err = session.Database(ctx).ExecContext(ctx, query, mute.values()...)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return mute, nil
+}
+
+func (user *User) UnmuteUser(ctx context.Context, userId string) error {
+	if !user.isAdmin() {
+		return session.ForbiddenError(ctx)
+	}
+	_, err := session.Database(ctx).ExecContext(ctx, "DELETE FROM mutes WHERE user_id=$1", userId)
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+func ListMutes(ctx context.Context) ([]*Mute, error) {
+	cols := make([]string, len(mutesCols))
+	for i, c := range mutesCols {
+		cols[i] = "m." + c
+	}
+	query := fmt.Sprintf("SELECT %s,u.full_name FROM mutes m LEFT JOIN users u ON m.user_id=u.user_id WHERE m.expires_at>$1 ORDER BY m.expires_at", strings.Join(cols, ","))
+	rows, err := session.Database(ctx).QueryContext(ctx, query, time.Now())
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var mutes []*Mute
+	for rows.Next() {
+		var m Mute
+		err := rows.Scan(&m.UserId, &m.MutedBy, &m.Reason, &m.ExpiresAt, &m.CreatedAt, &m.FullName)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		mutes = append(mutes, &m)
+	}
+	return mutes, nil
+}
+
+// readActiveMute ignores rows whose expires_at has passed, so a mute lifts
+// by itself without anything having to delete it.
+func readActiveMute(ctx context.Context, userId string) (*Mute, error) {
+	query := fmt.Sprintf("SELECT %s FROM mutes WHERE user_id=$1 AND expires_at>$2", strings.Join(mutesCols, ","))
+	row := session.Database(ctx).QueryRowContext(ctx, query, userId, time.Now())
+	mute, err := muteFromRow(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return mute, nil
+}
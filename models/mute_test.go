@@ -0,0 +1,64 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMuteCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	admin := &User{UserId: "e9a5b807-fa8b-455a-8dfa-b189d28310ff"}
+	li, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "name", "http://localhost")
+	assert.Nil(err)
+	assert.NotNil(li)
+
+	mute, err := li.MuteUser(ctx, admin.UserId, time.Hour, "")
+	assert.NotNil(err)
+	assert.Nil(mute)
+	mute, err = admin.MuteUser(ctx, bot.UuidNewV4().String(), time.Hour, "")
+	assert.Nil(err)
+	assert.Nil(mute)
+	mute, err = admin.MuteUser(ctx, li.UserId, time.Hour, "spam")
+	assert.Nil(err)
+	assert.NotNil(mute)
+	assert.Equal("spam", mute.Reason)
+	mutes, err := ListMutes(ctx)
+	assert.Nil(err)
+	assert.Len(mutes, 1)
+	assert.Equal("name", mutes[0].FullName.String)
+
+	data := base64.StdEncoding.EncodeToString([]byte("hello"))
+	message, err := CreateMessage(ctx, li, bot.UuidNewV4().String(), MessageCategoryPlainText, "", data, time.Now(), time.Now())
+	assert.Nil(err)
+	assert.Nil(message)
+	dms, err := testReadDistributedMessages(ctx)
+	assert.Nil(err)
+	assert.Len(dms, 1)
+	assert.Equal(li.UserId, dms[0].RecipientId)
+
+	_, err = session.Database(ctx).ExecContext(ctx, "UPDATE mutes SET expires_at=$1", time.Now().Add(-time.Minute))
+	assert.Nil(err)
+	mutes, err = ListMutes(ctx)
+	assert.Nil(err)
+	assert.Len(mutes, 0)
+	message, err = CreateMessage(ctx, li, bot.UuidNewV4().String(), MessageCategoryPlainText, "", data, time.Now(), time.Now())
+	assert.Nil(err)
+	assert.NotNil(message)
+
+	mute, err = admin.MuteUser(ctx, li.UserId, time.Hour, "again")
+	assert.Nil(err)
+	assert.NotNil(mute)
+	err = admin.UnmuteUser(ctx, li.UserId)
+	assert.Nil(err)
+	mute, err = readActiveMute(ctx, li.UserId)
+	assert.Nil(err)
+	assert.Nil(mute)
+}
@@ -4,12 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"math"
 	"strconv"
 	"strings"
 	"time"
 
 	bot "github.com/MixinNetwork/bot-api-go-client"
+	number "github.com/MixinNetwork/go-number"
 	"github.com/MixinNetwork/supergroup.mixin.one/config"
 	"github.com/MixinNetwork/supergroup.mixin.one/durable"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
@@ -27,11 +27,13 @@ CREATE TABLE IF NOT EXISTS orders (
 	amount           VARCHAR(128) NOT NULL,
 	channel          VARCHAR(32) NOT NULL,
 	transaction_id   VARCHAR(32) DEFAULT '',
+	plan             VARCHAR(128) NOT NULL DEFAULT '',
 	created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
 	paid_at          TIMESTAMP WITH TIME ZONE
 );
 
 CREATE INDEX IF NOT EXISTS order_created_paidx ON orders(created_at, paid_at);
+CREATE INDEX IF NOT EXISTS order_state_createdx ON orders(state, created_at);
 `
 
 type Order struct {
@@ -43,21 +45,34 @@ type Order struct {
 	Amount        string
 	Channel       string
 	TransactionId string
+	Plan          string
 	CreatedAt     time.Time
 	PaidAt        pq.NullTime
 }
 
+const (
+	OrderStatePending   = "PENDING"
+	OrderStateNotPaid   = "NOTPAID"
+	OrderStatePaid      = "PAID"
+	OrderStateExpired   = "EXPIRED"
+	OrderStateCancelled = "CANCELLED"
+	OrderStateRefunded  = "REFUNDED"
+
+	// WeChat prepay ids are only valid for two hours.
+	OrderExpiration = 2 * time.Hour
+)
+
 const WX_TN_PREFIX = "tn-"
 
-var orderColumns = []string{"order_id", "user_id", "trace_id", "prepay_id", "state", "amount", "channel", "transaction_id", "created_at", "paid_at"}
+var orderColumns = []string{"order_id", "user_id", "trace_id", "prepay_id", "state", "amount", "channel", "transaction_id", "plan", "created_at", "paid_at"}
 
 func (o *Order) values() []interface{} {
-	return []interface{}{o.OrderId, o.UserId, o.TraceId, o.PrepayId, o.State, o.Amount, o.Channel, o.TransactionId, o.CreatedAt, o.PaidAt}
+	return []interface{}{o.OrderId, o.UserId, o.TraceId, o.PrepayId, o.State, o.Amount, o.Channel, o.TransactionId, o.Plan, o.CreatedAt, o.PaidAt}
 }
 
 func orderFromRow(row durable.Row) (*Order, error) {
 	var o Order
-	err := row.Scan(&o.OrderId, &o.UserId, &o.TraceId, &o.PrepayId, &o.State, &o.Amount, &o.Channel, &o.TransactionId, &o.CreatedAt, &o.PaidAt)
+	err := row.Scan(&o.OrderId, &o.UserId, &o.TraceId, &o.PrepayId, &o.State, &o.Amount, &o.Channel, &o.TransactionId, &o.Plan, &o.CreatedAt, &o.PaidAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -70,7 +85,7 @@ func GetNotPaidOrders(ctx context.Context, limit int64) ([]*Order, error) {
 		state='NOTPAID'
 			AND created_at > NOW() - INTERVAL '%d minute'
 			AND user_id NOT IN
-				(SELECT user_id FROM users WHERE state='paid')
+				(SELECT user_id FROM users WHERE state='paid' AND expires_at IS NULL)
 		ORDER BY created_at`, strings.Join(orderColumns, ","), limit)
 	// query := fmt.Sprintf("SELECT %s FROM orders WHERE state='NOTPAID' AND created_at > NOW() - INTERVAL '30 minute' ORDER BY created_at", strings.Join(orderColumns, ","))
 	rows, err := session.Database(ctx).QueryContext(ctx, query)
@@ -90,23 +105,28 @@ func GetNotPaidOrders(ctx context.Context, limit int64) ([]*Order, error) {
 	return orders, nil
 }
 
-func CreateOrder(ctx context.Context, userId, amount, wxOpenId string) (*Order, wxpay.Params, wxpay.Params, error) {
+func CreateOrder(ctx context.Context, userId, planName, wxOpenId string) (*Order, wxpay.Params, wxpay.Params, error) {
+	plan := config.FindMembershipPlan(planName)
+	if plan == nil || plan.CNYPrice == "" {
+		return nil, nil, nil, session.BadDataError(ctx)
+	}
 	order := &Order{
 		OrderId:       bot.UuidNewV4().String(),
 		UserId:        userId,
 		TraceId:       0,
 		PrepayId:      "",
-		State:         "PENDING",
-		Amount:        config.AppConfig.System.WeChatPaymentAmount,
+		State:         OrderStatePending,
+		Amount:        plan.CNYPrice,
 		Channel:       "wx",
 		TransactionId: "",
+		Plan:          plan.Name,
 	}
 
 	// create an order
 	var err error
-	query := "INSERT INTO orders (order_id, user_id, prepay_id, state, amount, channel) VALUES ($1, $2, $3, $4, $5, $6)"
+	query := "INSERT INTO orders (order_id, user_id, prepay_id, state, amount, channel, plan) VALUES ($1, $2, $3, $4, $5, $6, $7)"
 	_, err = session.Database(ctx).ExecContext(ctx, query,
-		order.OrderId, order.UserId, order.PrepayId, order.State, order.Amount, order.Channel)
+		order.OrderId, order.UserId, order.PrepayId, order.State, order.Amount, order.Channel, order.Plan)
 	if err != nil {
 		return nil, nil, nil, session.TransactionError(ctx, err)
 	}
@@ -129,7 +149,7 @@ func CreateOrder(ctx context.Context, userId, amount, wxOpenId string) (*Order,
 	jswxp = GetPayJsParams(client, wxp)
 
 	// update record
-	order.State = "NOTPAID"
+	order.State = OrderStateNotPaid
 	query = "UPDATE orders SET state=$1, prepay_id=$2 WHERE order_id=$3"
 	_, err = session.Database(ctx).ExecContext(ctx, query, order.State, wxp["prepay_id"], order.OrderId)
 	if err != nil {
@@ -147,8 +167,15 @@ func MarkOrderAsPaidByTraceId(ctx context.Context, traceId int64, transactionId
 		if err != nil || order == nil {
 			return err
 		}
-		query := "UPDATE orders SET state='PAID', transaction_id=$1, paid_at=$2 WHERE order_id=$3"
-		_, err = tx.ExecContext(ctx, query, transactionId, time.Now(), order.OrderId)
+		// a payment may still land on an expired or cancelled order, honour it.
+		if order.State == OrderStatePaid || order.State == OrderStateRefunded {
+			return nil
+		}
+		order.State = OrderStatePaid
+		order.TransactionId = transactionId
+		order.PaidAt = pq.NullTime{Time: time.Now(), Valid: true}
+		query := "UPDATE orders SET state=$1, transaction_id=$2, paid_at=$3 WHERE order_id=$4"
+		_, err = tx.ExecContext(ctx, query, order.State, order.TransactionId, order.PaidAt, order.OrderId)
 		if err != nil {
 			return err
 		}
@@ -156,7 +183,11 @@ func MarkOrderAsPaidByTraceId(ctx context.Context, traceId int64, transactionId
 		if err != nil {
 			return err
 		}
-		return user.paymentInTx(ctx, tx, PayMethodWechat)
+		plan := config.FindMembershipPlan(order.Plan)
+		if plan == nil {
+			plan = config.FindMembershipPlan("")
+		}
+		return user.paymentInTx(ctx, tx, PayMethodWechat, plan)
 	})
 	if err != nil {
 		return nil, session.TransactionError(ctx, err)
@@ -165,8 +196,14 @@ func MarkOrderAsPaidByTraceId(ctx context.Context, traceId int64, transactionId
 }
 
 func getOrderByTraceId(ctx context.Context, tx *sql.Tx, traceId int64) (*Order, error) {
-	query := fmt.Sprintf("SELECT %s FROM orders WHERE trace_id=$1 ORDER BY created_at LIMIT 1", strings.Join(orderColumns, ","))
+	query := fmt.Sprintf("SELECT %s FROM orders WHERE trace_id=$1 LIMIT 1 FOR UPDATE", strings.Join(orderColumns, ","))
 	row := tx.QueryRowContext(ctx, query, traceId)
+	return orderFromRow(row)
+}
+
+func GetOrderByTraceId(ctx context.Context, traceId int64) (*Order, error) {
+	query := fmt.Sprintf("SELECT %s FROM orders WHERE trace_id=$1", strings.Join(orderColumns, ","))
+	row := session.Database(ctx).QueryRowContext(ctx, query, traceId)
 	order, err := orderFromRow(row)
 	if err != nil {
 		return nil, session.TransactionError(ctx, err)
@@ -184,6 +221,154 @@ func GetOrder(ctx context.Context, orderId string) (*Order, error) {
 	return order, nil
 }
 
+// ExpireOrders expires the unpaid orders whose prepay id is no longer valid.
+func ExpireOrders(ctx context.Context, limit int64) (int64, error) {
+	query := "UPDATE orders SET state=$1 WHERE order_id IN (SELECT order_id FROM orders WHERE state IN ($2,$3) AND created_at<$4 LIMIT $5)"
+	r, err := session.Database(ctx).ExecContext(ctx, query, OrderStateExpired, OrderStatePending, OrderStateNotPaid, time.Now().Add(-OrderExpiration), limit)
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	count, err := r.RowsAffected()
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	return count, nil
+}
+
+// CancelOrder closes the WeChat prepay before the order is cancelled, so it
+// can't be paid afterwards.
+func (user *User) CancelOrder(ctx context.Context, orderId string) (*Order, error) {
+	order, err := GetOrder(ctx, orderId)
+	if err != nil || order == nil {
+		return nil, err
+	}
+	if order.UserId != user.UserId && user.GetRole() != "admin" {
+		return nil, session.ForbiddenError(ctx)
+	}
+	if order.State == OrderStatePending || order.State == OrderStateNotPaid {
+		if err := closeOrderPayment(ctx, order); err != nil {
+			return nil, err
+		}
+	}
+	return user.transitOrder(ctx, orderId, OrderStateCancelled, nil, OrderStatePending, OrderStateNotPaid)
+}
+
+// RefundOrder records the refund and takes back the membership the order paid
+// for, the money is returned from the merchant platform.
+func (user *User) RefundOrder(ctx context.Context, orderId string) (*Order, error) {
+	if user.GetRole() != "admin" {
+		return nil, session.ForbiddenError(ctx)
+	}
+	return user.transitOrder(ctx, orderId, OrderStateRefunded, func(ctx context.Context, tx *sql.Tx, order *Order) error {
+		member, err := findUserById(ctx, tx, order.UserId)
+		if err != nil || member == nil {
+			return err
+		}
+		return member.revokeInTx(ctx, tx, config.FindMembershipPlan(order.Plan))
+	}, OrderStatePaid)
+}
+
+func (user *User) transitOrder(ctx context.Context, orderId, state string, hook func(context.Context, *sql.Tx, *Order) error, from ...string) (*Order, error) {
+	var order *Order
+	err := session.Database(ctx).RunInTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		query := fmt.Sprintf("SELECT %s FROM orders WHERE order_id=$1 FOR UPDATE", strings.Join(orderColumns, ","))
+		o, err := orderFromRow(tx.QueryRowContext(ctx, query, orderId))
+		if err != nil || o == nil {
+			return err
+		}
+		if o.UserId != user.UserId && user.GetRole() != "admin" {
+			return session.ForbiddenError(ctx)
+		}
+		order = o
+		if order.State == state {
+			return nil
+		}
+		valid := false
+		for _, s := range from {
+			valid = valid || order.State == s
+		}
+		if !valid {
+			return session.BadDataError(ctx)
+		}
+		order.State = state
+		_, err = tx.ExecContext(ctx, "UPDATE orders SET state=$1 WHERE order_id=$2", order.State, order.OrderId)
+		if err != nil || hook == nil {
+			return err
+		}
+		return hook(ctx, tx, order)
+	})
+	if err != nil {
+		if sessionErr, ok := err.(session.Error); ok {
+			return nil, sessionErr
+		}
+		return nil, session.TransactionError(ctx, err)
+	}
+	return order, nil
+}
+
+type OrderSearch struct {
+	UserId  string
+	Channel string
+	State   string
+	Since   time.Time
+	Until   time.Time
+	Before  time.Time
+	Limit   int64
+}
+
+// SearchOrders returns the matching orders newest first, Before pages towards older orders.
+func SearchOrders(ctx context.Context, search *OrderSearch) ([]*Order, error) {
+	var filters []string
+	var args []interface{}
+	add := func(filter string, arg interface{}) {
+		args = append(args, arg)
+		filters = append(filters, fmt.Sprintf(filter, len(args)))
+	}
+	if search.UserId != "" {
+		add("user_id=$%d", search.UserId)
+	}
+	if search.Channel != "" {
+		add("channel=$%d", search.Channel)
+	}
+	if search.State != "" {
+		add("state=$%d", strings.ToUpper(search.State))
+	}
+	if !search.Since.IsZero() {
+		add("created_at>=$%d", search.Since)
+	}
+	if !search.Until.IsZero() {
+		add("created_at<$%d", search.Until)
+	}
+	if !search.Before.IsZero() {
+		add("created_at<$%d", search.Before)
+	}
+	where := ""
+	if len(filters) > 0 {
+		where = "WHERE " + strings.Join(filters, " AND ")
+	}
+	limit := search.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	args = append(args, limit)
+	query := fmt.Sprintf("SELECT %s FROM orders %s ORDER BY created_at DESC LIMIT $%d", strings.Join(orderColumns, ","), where, len(args))
+	rows, err := session.Database(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var orders []*Order
+	for rows.Next() {
+		order, err := orderFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
 func CreateWxClient() *wxpay.Client {
 	cfg := config.AppConfig
 	account := wxpay.NewAccount(cfg.Wechat.AppId, cfg.Wechat.MchId, cfg.Wechat.MchKey, false)
@@ -197,17 +382,14 @@ func CreateWxClient() *wxpay.Client {
 }
 
 func CreateWxPayment(client *wxpay.Client, traceId int64, amount, wxOpenId string) (wxpay.Params, error) {
-	fs, _ := strconv.ParseFloat(amount, 32)
 	tradeNo := WX_TN_PREFIX + strconv.FormatInt(traceId, 10)
 	params := make(wxpay.Params)
 	params.
 		SetString("out_trade_no", tradeNo).
-		SetInt64("total_fee", int64(math.Ceil(fs*100))).
+		SetInt64("total_fee", wxPayTotalFee(amount)).
 		// I don't know what's the meaning of the IP
 		SetString("spbill_create_ip", "123.12.12.123").
-		// I don't have the permission of notify url.
-		// so I pull to get order state
-		// @TODO need to implement an method to handle it.
+		// notifications land on /wechat/pay/callback, the order watch polls as a fallback.
 		SetString("notify_url", config.AppConfig.Wechat.NotifyUrl).
 		// drop some shits here.
 		SetString("body", "Mixin-PayToJoin").
@@ -220,6 +402,12 @@ func CreateWxPayment(client *wxpay.Client, traceId int64, amount, wxOpenId strin
 	return p, err
 }
 
+// wxPayTotalFee converts the order amount in yuan to fen, the plan prices are
+// validated to have at most 2 decimals so the conversion is exact.
+func wxPayTotalFee(amount string) int64 {
+	return number.FromString(amount).RoundCeil(2).Integer(2).Value()
+}
+
 func FetchWxPayment(client *wxpay.Client, traceId int64) (wxpay.Params, error) {
 	tradeNo := WX_TN_PREFIX + strconv.FormatInt(traceId, 10)
 	params := make(wxpay.Params)
@@ -227,6 +415,35 @@ func FetchWxPayment(client *wxpay.Client, traceId int64) (wxpay.Params, error) {
 	return client.OrderQuery(params)
 }
 
+func CloseWxPayment(client *wxpay.Client, traceId int64) (wxpay.Params, error) {
+	tradeNo := WX_TN_PREFIX + strconv.FormatInt(traceId, 10)
+	params := make(wxpay.Params)
+	params.SetString("out_trade_no", tradeNo)
+	return client.CloseOrder(params)
+}
+
+// closeOrderPayment closes the WeChat prepay of the order, an order which is
+// already paid can't be closed, it's marked paid by the notify or the watch.
+var closeOrderPayment = func(ctx context.Context, order *Order) error {
+	params, err := CloseWxPayment(CreateWxClient(), order.TraceId)
+	if err != nil {
+		return session.ServerError(ctx, err)
+	}
+	if params["return_code"] != wxpay.Success {
+		return session.ServerError(ctx, fmt.Errorf("wxpay close order %d %s", order.TraceId, params["return_msg"]))
+	}
+	if params["result_code"] == wxpay.Success {
+		return nil
+	}
+	switch params["err_code"] {
+	case "ORDERCLOSED", "ORDERNOTEXIST":
+		return nil
+	case "ORDERPAID":
+		return session.BadDataError(ctx)
+	}
+	return session.ServerError(ctx, fmt.Errorf("wxpay close order %d %s %s", order.TraceId, params["err_code"], params["err_code_des"]))
+}
+
 func GetPayJsParams(client *wxpay.Client, params wxpay.Params) wxpay.Params {
 	// for JSAPI payment, we have to sign again for slight different params.
 	// be careful about the stupid fields spelling, WeChat's API design is horrible.
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderLifecycle(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	system := &config.AppConfig.System
+	plans, closePayment := system.MembershipPlans, closeOrderPayment
+	defer func() { system.MembershipPlans, closeOrderPayment = plans, closePayment }()
+	system.MembershipPlans = []config.MembershipPlan{{Name: "monthly", CNYPrice: "19.9", Duration: 30 * 24 * time.Hour}}
+	var closing error
+	var closed int
+	closeOrderPayment = func(ctx context.Context, order *Order) error {
+		closed += 1
+		return closing
+	}
+
+	admin := &User{UserId: "e9a5b807-fa8b-455a-8dfa-b189d28310ff"}
+	li, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "name", "http://localhost")
+	assert.Nil(err)
+	assert.NotNil(li)
+	other, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1002", "name", "http://localhost")
+	assert.Nil(err)
+	assert.NotNil(other)
+
+	query := "INSERT INTO orders (order_id, trace_id, user_id, state, amount, channel, created_at) VALUES ($1, $2, $3, $4, '19.9', 'wx', $5)"
+	stale, fresh, paid := bot.UuidNewV4().String(), bot.UuidNewV4().String(), bot.UuidNewV4().String()
+	_, err = session.Database(ctx).ExecContext(ctx, query, stale, 1, li.UserId, OrderStateNotPaid, time.Now().Add(-OrderExpiration-time.Minute))
+	assert.Nil(err)
+	_, err = session.Database(ctx).ExecContext(ctx, query, fresh, 2, li.UserId, OrderStateNotPaid, time.Now())
+	assert.Nil(err)
+	_, err = session.Database(ctx).ExecContext(ctx, query, paid, 3, other.UserId, OrderStatePaid, time.Now())
+	assert.Nil(err)
+
+	count, err := ExpireOrders(ctx, 100)
+	assert.Nil(err)
+	assert.Equal(int64(1), count)
+	order, err := GetOrder(ctx, stale)
+	assert.Nil(err)
+	assert.Equal(OrderStateExpired, order.State)
+	count, err = ExpireOrders(ctx, 100)
+	assert.Nil(err)
+	assert.Equal(int64(0), count)
+
+	order, err = other.CancelOrder(ctx, fresh)
+	assert.NotNil(err)
+	assert.Nil(order)
+	order, err = li.CancelOrder(ctx, stale)
+	assert.NotNil(err)
+	assert.Nil(order)
+	order, err = li.CancelOrder(ctx, bot.UuidNewV4().String())
+	assert.Nil(err)
+	assert.Nil(order)
+	closing = session.BadDataError(ctx)
+	order, err = li.CancelOrder(ctx, fresh)
+	assert.NotNil(err)
+	assert.Nil(order)
+	order, err = GetOrder(ctx, fresh)
+	assert.Nil(err)
+	assert.Equal(OrderStateNotPaid, order.State)
+	closing = nil
+	order, err = li.CancelOrder(ctx, fresh)
+	assert.Nil(err)
+	assert.NotNil(order)
+	assert.Equal(OrderStateCancelled, order.State)
+	order, err = li.CancelOrder(ctx, fresh)
+	assert.Nil(err)
+	assert.Equal(OrderStateCancelled, order.State)
+	assert.Equal(2, closed)
+
+	order, err = other.RefundOrder(ctx, paid)
+	assert.NotNil(err)
+	assert.Nil(order)
+	order, err = admin.RefundOrder(ctx, fresh)
+	assert.NotNil(err)
+	assert.Nil(order)
+	_, err = session.Database(ctx).ExecContext(ctx, "UPDATE users SET (state,subscribed_at,pay_method,expires_at)=($1,$2,$3,$4) WHERE user_id=$5", PaymentStatePaid, time.Now(), PayMethodWechat, time.Now().Add(10*24*time.Hour), other.UserId)
+	assert.Nil(err)
+	order, err = admin.RefundOrder(ctx, paid)
+	assert.Nil(err)
+	assert.Equal(OrderStateRefunded, order.State)
+	other, err = FindUser(ctx, other.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePending, other.State)
+	assert.True(other.SubscribedAt.Before(genesisStartedAt()))
+	assert.True(other.ExpiresAt.Time.Before(time.Now()))
+
+	orders, err := SearchOrders(ctx, &OrderSearch{})
+	assert.Nil(err)
+	assert.Len(orders, 3)
+	assert.Equal(stale, orders[2].OrderId)
+	orders, err = SearchOrders(ctx, &OrderSearch{UserId: li.UserId})
+	assert.Nil(err)
+	assert.Len(orders, 2)
+	orders, err = SearchOrders(ctx, &OrderSearch{State: "refunded", Channel: "wx"})
+	assert.Nil(err)
+	assert.Len(orders, 1)
+	assert.Equal(paid, orders[0].OrderId)
+	orders, err = SearchOrders(ctx, &OrderSearch{Since: time.Now().Add(-time.Minute)})
+	assert.Nil(err)
+	assert.Len(orders, 2)
+	orders, err = SearchOrders(ctx, &OrderSearch{Before: time.Now().Add(-time.Minute)})
+	assert.Nil(err)
+	assert.Len(orders, 1)
+	assert.Equal(stale, orders[0].OrderId)
+}
@@ -10,7 +10,6 @@ import (
 	"io"
 	"math/rand"
 	"strings"
-	"sync"
 	"time"
 	"unicode/utf8"
 
@@ -201,8 +200,6 @@ func ShowPacket(ctx context.Context, packetId string) (*Packet, error) {
 	return packet, nil
 }
 
-var mutexeSet map[string]*sync.Mutex
-
 func (current *User) ClaimPacket(ctx context.Context, packetId string) (*Packet, error) {
 	packet, err := ShowPacket(ctx, packetId)
 	if err != nil || packet == nil {
@@ -222,20 +219,16 @@ func (current *User) ClaimPacket(ctx context.Context, packetId string) (*Packet,
 		return nil, session.InsufficientAccountBalanceError(ctx)
 	}
 
-	mutex := mutexeSet[shard]
-	if mutex == nil {
-		mutex = &sync.Mutex{}
-		mutexeSet[shard] = mutex
-	}
-	mutex.Lock()
-	defer mutex.Unlock()
-
 	errChain := make(chan error, 1)
 	packetChain := make(chan *Packet, 1)
 	go func(id string) {
 		var packet *Packet
 		err := session.Database(ctx).RunInTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
-			var err error
+			// claims of the same shard are serialized across all the instances
+			_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", durable.AdvisoryLockKey("packet:"+shard))
+			if err != nil {
+				return err
+			}
 			packet, err = readPacketWithAssetAndUser(ctx, tx, packetId)
 			if err != nil || packet == nil {
 				return err
@@ -462,7 +455,3 @@ func generatePacketRefundId(packetId string) (string, error) {
 	id, err := uuid.FromBytes(sum)
 	return id.String(), err
 }
-
-func init() {
-	mutexeSet = make(map[string]*sync.Mutex, 0)
-}
@@ -8,6 +8,7 @@ import (
 
 	bot "github.com/MixinNetwork/bot-api-go-client"
 	number "github.com/MixinNetwork/go-number"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 	"github.com/stretchr/testify/assert"
 )
@@ -17,6 +18,11 @@ func TestPacketCRUD(t *testing.T) {
 	ctx := setupTestContext()
 	defer teardownTestContext(ctx)
 
+	system := &config.AppConfig.System
+	payToJoin := system.PayToJoin
+	defer func() { system.PayToJoin = payToJoin }()
+	system.PayToJoin = false
+
 	user, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1000", "name", "http://localhost")
 	assert.Nil(err)
 	assert.NotNil(user)
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const pins_DDL = `
+CREATE TABLE IF NOT EXISTS pins (
+	message_id        VARCHAR(36) PRIMARY KEY CHECK (message_id ~* '^[0-9a-f-]{36,36}$'),
+	pinned_by         VARCHAR(36) NOT NULL CHECK (pinned_by ~* '^[0-9a-f-]{36,36}$'),
+	created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+`
+
+type Pin struct {
+	MessageId string
+	PinnedBy  string
+	CreatedAt time.Time
+
+	Message *Message
+}
+
+var pinnableCategories = map[string]bool{
+	MessageCategoryPlainText:    true,
+	MessageCategoryPlainImage:   true,
+	MessageCategoryPlainVideo:   true,
+	MessageCategoryPlainData:    true,
+	MessageCategoryPlainSticker: true,
+	MessageCategoryPlainContact: true,
+	MessageCategoryPlainAudio:   true,
+	MessageCategoryAppCard:      true,
+}
+
+func (user *User) PinMessage(ctx context.Context, messageId string) (*Pin, error) {
+	if !user.isAdmin() {
+		return nil, session.ForbiddenError(ctx)
+	}
+	message, err := FindMessage(ctx, messageId)
+	if err != nil || message == nil {
+		return nil, err
+	}
+	if !pinnableCategories[message.Category] {
+		return nil, session.BadDataError(ctx)
+	}
+	pin := &Pin{MessageId: message.MessageId, PinnedBy: user.UserId, CreatedAt: time.Now(), Message: message}
+	_, err = session.Database(ctx).ExecContext(ctx, "INSERT INTO pins (message_id,pinned_by,created_at) VALUES ($1,$2,$3) ON CONFLICT (message_id) DO NOTHING", pin.MessageId, pin.PinnedBy, pin.CreatedAt)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return pin, nil
+}
+
+// CreateAnnouncement posts the text to the group as a message of the admin
+// and pins it.
+func (user *User) CreateAnnouncement(ctx context.Context, text string) (*Pin, error) {
+	if !user.isAdmin() {
+		return nil, session.ForbiddenError(ctx)
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, session.BadDataError(ctx)
+	}
+	data := base64.StdEncoding.EncodeToString([]byte(text))
+	t := time.Now()
+	message, err := CreateMessage(ctx, user, bot.UuidNewV4().String(), MessageCategoryPlainText, "", data, t, t)
+	if err != nil {
+		return nil, err
+	}
+	if message == nil {
+		return nil, session.BadDataError(ctx)
+	}
+	return user.PinMessage(ctx, message.MessageId)
+}
+
+func (user *User) UnpinMessage(ctx context.Context, messageId string) error {
+	if !user.isAdmin() {
+		return session.ForbiddenError(ctx)
+	}
+	_, err := session.Database(ctx).ExecContext(ctx, "DELETE FROM pins WHERE message_id=$1", messageId)
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+// ListPins returns the pinned messages in the order they were pinned.
+func ListPins(ctx context.Context) ([]*Pin, error) {
+	cols := make([]string, len(messagesCols))
+	for i, c := range messagesCols {
+		cols[i] = "m." + c
+	}
+	query := fmt.Sprintf("SELECT p.message_id,p.pinned_by,p.created_at,%s,u.full_name FROM pins p INNER JOIN messages m ON p.message_id=m.message_id LEFT JOIN users u ON m.user_id=u.user_id ORDER BY p.created_at", strings.Join(cols, ","))
+	rows, err := session.Database(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var pins []*Pin
+	for rows.Next() {
+		var p Pin
+		var m Message
+		err := rows.Scan(&p.MessageId, &p.PinnedBy, &p.CreatedAt, &m.MessageId, &m.UserId, &m.Category, &m.QuoteMessageId, &m.Data, &m.CreatedAt, &m.UpdatedAt, &m.State, &m.LastDistributeAt, &m.FullName)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		p.Message = &m
+		pins = append(pins, &p)
+	}
+	return pins, nil
+}
+
+// SendPinnedMessages delivers the pinned messages to the user again, with
+// new message ids so they are not taken as duplicates of earlier deliveries.
+func (user *User) SendPinnedMessages(ctx context.Context) (int, error) {
+	pins, err := ListPins(ctx)
+	if err != nil || len(pins) == 0 {
+		return 0, err
+	}
+	var values bytes.Buffer
+	for i, pin := range pins {
+		msg := pin.Message
+		dm, err := createDistributeMessage(ctx, bot.UuidNewV4().String(), msg.MessageId, "", msg.UserId, user.UserId, msg.Category, msg.Data)
+		if err != nil {
+			return 0, session.TransactionError(ctx, err)
+		}
+		if i > 0 {
+			values.WriteString(",")
+		}
+		values.WriteString(distributedMessageValuesString(dm.MessageId, dm.ConversationId, dm.RecipientId, dm.UserId, dm.ParentId, dm.QuoteMessageId, dm.Shard, dm.Category, dm.Data, dm.Status))
+	}
+	query := fmt.Sprintf("INSERT INTO distributed_messages (%s) VALUES %s", strings.Join(distributedMessagesCols, ","), values.String())
+	_, err = session.Database(ctx).ExecContext(ctx, query)
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	return len(pins), nil
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPinCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	admin := &User{UserId: "e9a5b807-fa8b-455a-8dfa-b189d28310ff"}
+	li, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "name", "http://localhost")
+	assert.Nil(err)
+	assert.NotNil(li)
+
+	data := base64.StdEncoding.EncodeToString([]byte("hello"))
+	message, err := CreateMessage(ctx, li, bot.UuidNewV4().String(), MessageCategoryPlainText, "", data, time.Now(), time.Now())
+	assert.Nil(err)
+	assert.NotNil(message)
+
+	pin, err := li.PinMessage(ctx, message.MessageId)
+	assert.NotNil(err)
+	assert.Nil(pin)
+	pin, err = admin.PinMessage(ctx, bot.UuidNewV4().String())
+	assert.Nil(err)
+	assert.Nil(pin)
+	pin, err = admin.PinMessage(ctx, message.MessageId)
+	assert.Nil(err)
+	assert.NotNil(pin)
+	pin, err = admin.PinMessage(ctx, message.MessageId)
+	assert.Nil(err)
+	assert.NotNil(pin)
+	pin, err = admin.CreateAnnouncement(ctx, "")
+	assert.NotNil(err)
+	pin, err = admin.CreateAnnouncement(ctx, "announcement")
+	assert.Nil(err)
+	assert.NotNil(pin)
+	assert.Equal(MessageCategoryPlainText, pin.Message.Category)
+
+	pins, err := ListPins(ctx)
+	assert.Nil(err)
+	assert.Len(pins, 2)
+	assert.Equal(message.MessageId, pins[0].MessageId)
+	assert.Equal("name", pins[0].Message.FullName.String)
+	assert.Equal(admin.UserId, pins[0].PinnedBy)
+
+	count, err := li.SendPinnedMessages(ctx)
+	assert.Nil(err)
+	assert.Equal(2, count)
+	count, err = li.SendPinnedMessages(ctx)
+	assert.Nil(err)
+	assert.Equal(2, count)
+
+	jason := &User{UserId: bot.UuidNewV4().String()}
+	err = ProcessBackfill(ctx, jason.UserId)
+	assert.Nil(err)
+	dm, err := FindDistributedMessage(ctx, UniqueConversationId(jason.UserId, pin.MessageId))
+	assert.Nil(err)
+	assert.NotNil(dm)
+
+	_, err = li.RecallMessage(ctx, pin.MessageId)
+	assert.NotNil(err)
+	pins, err = ListPins(ctx)
+	assert.Nil(err)
+	assert.Len(pins, 2)
+
+	err = li.UnpinMessage(ctx, message.MessageId)
+	assert.NotNil(err)
+	err = admin.UnpinMessage(ctx, message.MessageId)
+	assert.Nil(err)
+	_, err = admin.RecallMessage(ctx, pin.MessageId)
+	assert.Nil(err)
+	pins, err = ListPins(ctx)
+	assert.Nil(err)
+	assert.Len(pins, 0)
+}
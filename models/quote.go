@@ -0,0 +1,192 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	number "github.com/MixinNetwork/go-number"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const quotes_DDL = `
+CREATE TABLE IF NOT EXISTS quotes (
+	quote_id          VARCHAR(36) PRIMARY KEY CHECK (quote_id ~* '^[0-9a-f-]{36,36}$'),
+	user_id           VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+	plan              VARCHAR(128) NOT NULL,
+	asset_id          VARCHAR(36) NOT NULL CHECK (asset_id ~* '^[0-9a-f-]{36,36}$'),
+	amount            VARCHAR(128) NOT NULL,
+	price_usd         VARCHAR(128) NOT NULL,
+	expires_at        TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS quotes_user_plan_assetx ON quotes(user_id, plan, asset_id, expires_at);
+CREATE INDEX IF NOT EXISTS quotes_expiresx ON quotes(expires_at);
+`
+
+const (
+	PaymentAmountAuto = "auto"
+
+	// quotes are kept a while after expiry for the transfers delivered late.
+	QuoteRetention = 24 * time.Hour
+)
+
+type Quote struct {
+	QuoteId   string
+	UserId    string
+	Plan      string
+	AssetId   string
+	Amount    string
+	PriceUSD  string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+
+	TraceId string
+}
+
+var quotesCols = []string{"quote_id", "user_id", "plan", "asset_id", "amount", "price_usd", "expires_at", "created_at"}
+
+func (q *Quote) values() []interface{} {
+	return []interface{}{q.QuoteId, q.UserId, q.Plan, q.AssetId, q.Amount, q.PriceUSD, q.ExpiresAt, q.CreatedAt}
+}
+
+func quoteFromRow(row durable.Row) (*Quote, error) {
+	var q Quote
+	err := row.Scan(&q.QuoteId, &q.UserId, &q.Plan, &q.AssetId, &q.Amount, &q.PriceUSD, &q.ExpiresAt, &q.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &q, err
+}
+
+// CreateQuote prices the plan in the asset, auto amounts are estimated from
+// the cached asset price, which is refreshed when missing or stale.
+func (user *User) CreateQuote(ctx context.Context, planName, assetId string) (*Quote, error) {
+	plan := config.FindMembershipPlan(planName)
+	if plan == nil {
+		return nil, session.BadDataError(ctx)
+	}
+	var asset *config.PaymentAsset
+	for i := range plan.Assets {
+		if plan.Assets[i].AssetId == assetId {
+			asset = &plan.Assets[i]
+		}
+	}
+	if asset == nil {
+		return nil, session.BadDataError(ctx)
+	}
+
+	t := time.Now()
+	quote := &Quote{
+		QuoteId:   bot.UuidNewV4().String(),
+		UserId:    user.UserId,
+		Plan:      plan.Name,
+		AssetId:   asset.AssetId,
+		Amount:    asset.Amount,
+		ExpiresAt: t.Add(config.AppConfig.System.Quote.TTL),
+		CreatedAt: t,
+		TraceId:   user.PlanTraceId(plan),
+	}
+	if asset.Amount != PaymentAmountAuto {
+		quote.Amount = number.FromString(asset.Amount).RoundFloor(8).Persist()
+		return quote, nil
+	}
+
+	price, err := user.readAssetPriceUSD(ctx, assetId)
+	if err != nil {
+		return nil, err
+	}
+	rate := number.FromString(config.AppConfig.System.Quote.USDCNYRate)
+	base := plan.EstimateBase
+	if base == "" {
+		base = plan.CNYPrice
+	}
+	if rate.Cmp(number.Zero()) <= 0 || price.Cmp(number.Zero()) <= 0 || number.FromString(base).Cmp(number.Zero()) <= 0 {
+		return nil, session.ServerError(ctx, fmt.Errorf("invalid quote %s %s %s %s", plan.Name, base, rate.Persist(), price.Persist()))
+	}
+	quote.PriceUSD = price.Persist()
+	quote.Amount = number.FromString(base).Div(rate).Div(price).RoundCeil(8).Persist()
+
+	params, positions := compileTableQuery(quotesCols)
+	query := fmt.Sprintf("INSERT INTO quotes (%s) VALUES (%s)", params, positions)
+	if _, err := session.Database(ctx).ExecContext(ctx, query, quote.values()...); err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return quote, nil
+}
+
+// readAssetPriceUSD uses the cached asset price unless it is older than the
+// quote ttl, stale or missing prices are fetched again.
+func (user *User) readAssetPriceUSD(ctx context.Context, assetId string) (number.Decimal, error) {
+	var price string
+	var updatedAt time.Time
+	err := session.Database(ctx).QueryRowContext(ctx, "SELECT price_usd,updated_at FROM assets WHERE asset_id=$1", assetId).Scan(&price, &updatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return number.Zero(), session.TransactionError(ctx, err)
+	}
+	fresh := updatedAt.After(time.Now().Add(-config.AppConfig.System.Quote.TTL))
+	if fresh && number.FromString(price).Cmp(number.Zero()) > 0 {
+		return number.FromString(price), nil
+	}
+	asset, err := user.ShowAsset(ctx, assetId)
+	if err != nil {
+		return number.Zero(), err
+	}
+	return number.FromString(asset.PriceUSD), nil
+}
+
+// AcceptsPlanPayment matches the transfer against the fixed amounts of the plan,
+// or against the quotes of the auto amounts which were valid at the transfer time.
+func (user *User) AcceptsPlanPayment(ctx context.Context, plan *config.MembershipPlan, assetId, amount string, at time.Time) (bool, error) {
+	if MembershipPlanAccepts(plan, assetId, amount) {
+		return true, nil
+	}
+	auto := false
+	for _, asset := range plan.Assets {
+		auto = auto || (asset.AssetId == assetId && asset.Amount == PaymentAmountAuto)
+	}
+	if !auto {
+		return false, nil
+	}
+	if at.IsZero() {
+		at = time.Now()
+	}
+	query := fmt.Sprintf("SELECT %s FROM quotes WHERE user_id=$1 AND plan=$2 AND asset_id=$3 AND expires_at>=$4 AND created_at<=$4", strings.Join(quotesCols, ","))
+	rows, err := session.Database(ctx).QueryContext(ctx, query, user.UserId, plan.Name, assetId, at)
+	if err != nil {
+		return false, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	tolerance := number.FromString("1").Sub(number.FromString(config.AppConfig.System.Quote.Tolerance))
+	paid := number.FromString(amount)
+	for rows.Next() {
+		quote, err := quoteFromRow(rows)
+		if err != nil {
+			return false, session.TransactionError(ctx, err)
+		}
+		if paid.Cmp(number.FromString(quote.Amount).Mul(tolerance)) >= 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func CleanUpExpiredQuotes(ctx context.Context, limit int64) (int64, error) {
+	query := "DELETE FROM quotes WHERE quote_id IN (SELECT quote_id FROM quotes WHERE expires_at<$1 LIMIT $2)"
+	r, err := session.Database(ctx).ExecContext(ctx, query, time.Now().Add(-QuoteRetention), limit)
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	count, err := r.RowsAffected()
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	return count, nil
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuote(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	const xin, cnb = "c94ac88f-4671-3976-b60a-09064f1811e8", "965e5c6e-434c-3fa9-b780-c50f43cd955c"
+	system := &config.AppConfig.System
+	plans, quote := system.MembershipPlans, system.Quote
+	defer func() { system.MembershipPlans, system.Quote = plans, quote }()
+	system.Quote.TTL = 15 * time.Minute
+	system.Quote.Tolerance = "0.02"
+	system.Quote.USDCNYRate = "7.1"
+	system.MembershipPlans = []config.MembershipPlan{
+		{Name: "monthly", CNYPrice: "14.2", Assets: []config.PaymentAsset{{AssetId: xin, Amount: "auto"}, {AssetId: cnb, Amount: "1000"}}},
+	}
+	plan := config.FindMembershipPlan("monthly")
+
+	err := upsertAssets(ctx, []*Asset{{AssetId: xin, Symbol: "XIN", Name: "Mixin", IconURL: "http://localhost", PriceBTC: "0.01", PriceUSD: "400"}})
+	assert.Nil(err)
+	li, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "name", "http://localhost")
+	assert.Nil(err)
+
+	q, err := li.CreateQuote(ctx, "yearly", xin)
+	assert.NotNil(err)
+	assert.Nil(q)
+	q, err = li.CreateQuote(ctx, "monthly", bot.UuidNewV4().String())
+	assert.NotNil(err)
+	assert.Nil(q)
+	q, err = li.CreateQuote(ctx, "monthly", cnb)
+	assert.Nil(err)
+	assert.Equal("1000", q.Amount)
+	assert.Equal(li.PlanTraceId(plan), q.TraceId)
+	q, err = li.CreateQuote(ctx, "monthly", xin)
+	assert.Nil(err)
+	assert.Equal("0.005", q.Amount)
+	assert.Equal("400", q.PriceUSD)
+
+	accepted, err := li.AcceptsPlanPayment(ctx, plan, cnb, "1000", time.Now())
+	assert.Nil(err)
+	assert.True(accepted)
+	accepted, err = li.AcceptsPlanPayment(ctx, plan, xin, "0.005", time.Now())
+	assert.Nil(err)
+	assert.True(accepted)
+	accepted, err = li.AcceptsPlanPayment(ctx, plan, xin, "0.0049", time.Now())
+	assert.Nil(err)
+	assert.True(accepted)
+	accepted, err = li.AcceptsPlanPayment(ctx, plan, xin, "0.0048", time.Now())
+	assert.Nil(err)
+	assert.False(accepted)
+	accepted, err = li.AcceptsPlanPayment(ctx, plan, xin, "0.005", time.Now().Add(16*time.Minute))
+	assert.Nil(err)
+	assert.False(accepted)
+	accepted, err = li.AcceptsPlanPayment(ctx, plan, xin, "0.005", time.Now().Add(-time.Minute))
+	assert.Nil(err)
+	assert.False(accepted)
+	other := &User{UserId: bot.UuidNewV4().String()}
+	accepted, err = other.AcceptsPlanPayment(ctx, plan, xin, "0.005", time.Now())
+	assert.Nil(err)
+	assert.False(accepted)
+
+	count, err := CleanUpExpiredQuotes(ctx, 100)
+	assert.Nil(err)
+	assert.Equal(int64(0), count)
+
+	_, err = session.Database(ctx).ExecContext(ctx, "UPDATE assets SET updated_at=$1 WHERE asset_id=$2", time.Now().Add(-16*time.Minute), xin)
+	assert.Nil(err)
+	q, err = li.CreateQuote(ctx, "monthly", xin)
+	assert.NotNil(err)
+	assert.Nil(q)
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const rate_limits_DDL = `
+CREATE TABLE IF NOT EXISTS rate_limits (
+	key               VARCHAR(128) PRIMARY KEY,
+	tokens            DOUBLE PRECISION NOT NULL,
+	updated_at        TIMESTAMP WITH TIME ZONE NOT NULL
+);
+`
+
+// The bucket is refilled and drained by a single upsert, so every process
+// sharing the database sees the same counters without extra locking.
+const rateLimitQuery = `
+INSERT INTO rate_limits (key,tokens,updated_at) VALUES ($1, $2-1, NOW())
+ON CONFLICT (key) DO UPDATE SET
+	tokens=LEAST($2, rate_limits.tokens + EXTRACT(EPOCH FROM (NOW()-rate_limits.updated_at))*$3) - 1,
+	updated_at=NOW()
+WHERE LEAST($2, rate_limits.tokens + EXTRACT(EPOCH FROM (NOW()-rate_limits.updated_at))*$3) >= 1
+RETURNING tokens`
+
+type databaseLimiter struct{}
+
+func (databaseLimiter) Allow(ctx context.Context, key string, limit durable.RateLimit) (bool, error) {
+	perSecond := 1 / limit.Every.Seconds()
+	var tokens float64
+	err := session.Database(ctx).QueryRowContext(ctx, rateLimitQuery, key, float64(limit.Burst), perSecond).Scan(&tokens)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, session.TransactionError(ctx, err)
+	}
+	return true, nil
+}
+
+var (
+	messageLimiter     durable.Limiter
+	messageLimiterOnce sync.Once
+)
+
+func readMessageLimiter() durable.Limiter {
+	messageLimiterOnce.Do(func() {
+		if config.AppConfig.System.MessageRateLimit.Store == "memory" {
+			messageLimiter = durable.NewMemoryLimiter()
+		} else {
+			messageLimiter = databaseLimiter{}
+		}
+	})
+	return messageLimiter
+}
+
+func findRateLimitPolicy(role, category string) *config.RateLimitPolicy {
+	var fallback *config.RateLimitPolicy
+	policies := config.AppConfig.System.MessageRateLimit.Policies
+	for i := range policies {
+		p := &policies[i]
+		if p.Role != role || p.Every <= 0 || p.Burst <= 0 {
+			continue
+		}
+		if p.Category == category {
+			return p
+		}
+		if p.Category == "*" && fallback == nil {
+			fallback = p
+		}
+	}
+	return fallback
+}
+
+// allowMessage reports whether the user may send a message of the category
+// under the configured policies. Roles without a policy are not limited.
+func allowMessage(ctx context.Context, user *User, category string) (bool, error) {
+	if config.AppConfig.Service.Environment == "test" {
+		return true, nil
+	}
+	if !config.AppConfig.System.LimitMessageFrequency {
+		return true, nil
+	}
+	policy := findRateLimitPolicy(user.GetRole(), category)
+	if policy == nil {
+		return true, nil
+	}
+	limit := durable.RateLimit{Every: policy.Every, Burst: policy.Burst}
+	return readMessageLimiter().Allow(ctx, user.UserId+":"+policy.Category, limit)
+}
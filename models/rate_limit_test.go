@@ -0,0 +1,62 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	policies := config.AppConfig.System.MessageRateLimit.Policies
+	defer func() { config.AppConfig.System.MessageRateLimit.Policies = policies }()
+	config.AppConfig.System.MessageRateLimit.Policies = []config.RateLimitPolicy{
+		{Role: "user", Category: "*", Every: time.Minute, Burst: 2},
+		{Role: "user", Category: MessageCategoryPlainImage, Every: time.Hour, Burst: 1},
+	}
+	policy := findRateLimitPolicy("user", MessageCategoryPlainText)
+	assert.NotNil(policy)
+	assert.Equal("*", policy.Category)
+	policy = findRateLimitPolicy("user", MessageCategoryPlainImage)
+	assert.NotNil(policy)
+	assert.Equal(MessageCategoryPlainImage, policy.Category)
+	assert.Nil(findRateLimitPolicy("admin", MessageCategoryPlainText))
+
+	limiter := databaseLimiter{}
+	key := bot.UuidNewV4().String() + ":*"
+	limit := durable.RateLimit{Every: time.Minute, Burst: 2}
+	allowed, err := limiter.Allow(ctx, key, limit)
+	assert.Nil(err)
+	assert.True(allowed)
+	allowed, err = limiter.Allow(ctx, key, limit)
+	assert.Nil(err)
+	assert.True(allowed)
+	allowed, err = limiter.Allow(ctx, key, limit)
+	assert.Nil(err)
+	assert.False(allowed)
+
+	_, err = session.Database(ctx).ExecContext(ctx, "UPDATE rate_limits SET updated_at=$1 WHERE key=$2", time.Now().Add(-time.Minute), key)
+	assert.Nil(err)
+	allowed, err = limiter.Allow(ctx, key, limit)
+	assert.Nil(err)
+	assert.True(allowed)
+	allowed, err = limiter.Allow(ctx, key, limit)
+	assert.Nil(err)
+	assert.False(allowed)
+
+	memory := durable.NewMemoryLimiter()
+	allowed, err = memory.Allow(ctx, key, durable.RateLimit{Every: time.Hour, Burst: 1})
+	assert.Nil(err)
+	assert.True(allowed)
+	allowed, err = memory.Allow(ctx, key, durable.RateLimit{Every: time.Hour, Burst: 1})
+	assert.Nil(err)
+	assert.False(allowed)
+}
@@ -0,0 +1,261 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/lib/pq"
+)
+
+const (
+	ScheduledMessageStateActive = "active"
+	ScheduledMessageStatePaused = "paused"
+	ScheduledMessageStateDone   = "done"
+)
+
+const scheduled_messages_DDL = `
+CREATE TABLE IF NOT EXISTS scheduled_messages (
+	schedule_id       VARCHAR(36) PRIMARY KEY CHECK (schedule_id ~* '^[0-9a-f-]{36,36}$'),
+	user_id           VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+	category          VARCHAR(512) NOT NULL,
+	data              TEXT NOT NULL,
+	cron              VARCHAR(128) NOT NULL DEFAULT '',
+	state             VARCHAR(128) NOT NULL,
+	next_run_at       TIMESTAMP WITH TIME ZONE NOT NULL,
+	last_run_at       TIMESTAMP WITH TIME ZONE,
+	created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_messages_state_nextx ON scheduled_messages(state, next_run_at);
+`
+
+type ScheduledMessage struct {
+	ScheduleId string
+	UserId     string
+	Category   string
+	Data       string
+	Cron       string
+	State      string
+	NextRunAt  time.Time
+	LastRunAt  pq.NullTime
+	CreatedAt  time.Time
+}
+
+var scheduledMessagesCols = []string{"schedule_id", "user_id", "category", "data", "cron", "state", "next_run_at", "last_run_at", "created_at"}
+
+func (s *ScheduledMessage) values() []interface{} {
+	return []interface{}{s.ScheduleId, s.UserId, s.Category, s.Data, s.Cron, s.State, s.NextRunAt, s.LastRunAt, s.CreatedAt}
+}
+
+func scheduledMessageFromRow(row durable.Row) (*ScheduledMessage, error) {
+	var s ScheduledMessage
+	err := row.Scan(&s.ScheduleId, &s.UserId, &s.Category, &s.Data, &s.Cron, &s.State, &s.NextRunAt, &s.LastRunAt, &s.CreatedAt)
+	return &s, err
+}
+
+// schedulableCategories are the categories a run is delivered as, none of them
+// is dropped by the member gates of CreateMessage.
+var schedulableCategories = map[string]bool{
+	MessageCategoryPlainText:    true,
+	MessageCategoryPlainImage:   true,
+	MessageCategoryPlainSticker: true,
+	MessageCategoryAppCard:      true,
+}
+
+// CreateScheduledMessage queues data to be sent by the bot at runAt, and then
+// on every match of the cron spec if any. A zero runAt with a cron spec starts
+// at the next match. Cron specs are evaluated in the server time zone.
+func (user *User) CreateScheduledMessage(ctx context.Context, category, data string, runAt time.Time, cron string) (*ScheduledMessage, error) {
+	if !user.isAdmin() {
+		return nil, session.ForbiddenError(ctx)
+	}
+	if !schedulableCategories[category] || data == "" || len(data) > 5*1024 {
+		return nil, session.BadDataError(ctx)
+	}
+	t := time.Now()
+	if cron != "" {
+		spec, err := parseCronSpec(cron)
+		if err != nil {
+			return nil, session.BadDataError(ctx)
+		}
+		if runAt.IsZero() {
+			runAt = spec.next(t)
+		}
+	}
+	if runAt.IsZero() || runAt.Before(t) {
+		return nil, session.BadDataError(ctx)
+	}
+	s := &ScheduledMessage{
+		ScheduleId: bot.UuidNewV4().String(),
+		UserId:     user.UserId,
+		Category:   category,
+		Data:       data,
+		Cron:       cron,
+		State:      ScheduledMessageStateActive,
+		NextRunAt:  runAt,
+		CreatedAt:  t,
+	}
+	params, positions := compileTableQuery(scheduledMessagesCols)
+	query := fmt.Sprintf("INSERT INTO scheduled_messages (%s) VALUES (%s)", params, positions)
+	_, err := session.Database(ctx).ExecContext(ctx, query, s.values()...)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return s, nil
+}
+
+func (user *User) ListScheduledMessages(ctx context.Context) ([]*ScheduledMessage, error) {
+	if !user.isAdmin() {
+		return nil, session.ForbiddenError(ctx)
+	}
+	query := fmt.Sprintf("SELECT %s FROM scheduled_messages ORDER BY created_at DESC", strings.Join(scheduledMessagesCols, ","))
+	return findScheduledMessages(ctx, query)
+}
+
+func ListDueScheduledMessages(ctx context.Context, limit int64) ([]*ScheduledMessage, error) {
+	query := fmt.Sprintf("SELECT %s FROM scheduled_messages WHERE state=$1 AND next_run_at<=$2 ORDER BY next_run_at LIMIT $3", strings.Join(scheduledMessagesCols, ","))
+	return findScheduledMessages(ctx, query, ScheduledMessageStateActive, time.Now(), limit)
+}
+
+func (user *User) PauseScheduledMessage(ctx context.Context, id string) (*ScheduledMessage, error) {
+	s, err := user.readScheduledMessage(ctx, id)
+	if err != nil || s == nil {
+		return nil, err
+	}
+	if s.State != ScheduledMessageStateActive {
+		return nil, session.BadDataError(ctx)
+	}
+	s.State = ScheduledMessageStatePaused
+	return s, s.update(ctx)
+}
+
+// ResumeScheduledMessage activates a paused schedule again, runs missed
+// while paused are skipped for cron schedules.
+func (user *User) ResumeScheduledMessage(ctx context.Context, id string) (*ScheduledMessage, error) {
+	s, err := user.readScheduledMessage(ctx, id)
+	if err != nil || s == nil {
+		return nil, err
+	}
+	if s.State != ScheduledMessageStatePaused {
+		return nil, session.BadDataError(ctx)
+	}
+	if s.Cron != "" && s.NextRunAt.Before(time.Now()) {
+		spec, err := parseCronSpec(s.Cron)
+		if err != nil {
+			return nil, session.BadDataError(ctx)
+		}
+		s.NextRunAt = spec.next(time.Now())
+	}
+	s.State = ScheduledMessageStateActive
+	return s, s.update(ctx)
+}
+
+func (user *User) DeleteScheduledMessage(ctx context.Context, id string) error {
+	if !user.isAdmin() {
+		return session.ForbiddenError(ctx)
+	}
+	_, err := session.Database(ctx).ExecContext(ctx, "DELETE FROM scheduled_messages WHERE schedule_id=$1", id)
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+// RunMessageId is the message id of the current run, so a run retried after
+// a failure is not sent twice.
+func (s *ScheduledMessage) RunMessageId() string {
+	return UniqueConversationId(s.ScheduleId, s.NextRunAt.UTC().Format(time.RFC3339))
+}
+
+// Run sends the current run as the bot, then moves the schedule to the next
+// match of its cron spec, one-off schedules are done. Runs are scheduled by
+// admins, so they skip the member gates of CreateMessage: a prohibited group
+// or a disabled category would otherwise drop them silently. A schedule
+// paused while the run was in flight stays paused and sends nothing.
+func (s *ScheduledMessage) Run(ctx context.Context) error {
+	t := time.Now()
+	message := &Message{
+		MessageId:        s.RunMessageId(),
+		UserId:           config.AppConfig.Mixin.ClientId,
+		Category:         s.Category,
+		Data:             s.Data,
+		CreatedAt:        t,
+		UpdatedAt:        t,
+		State:            MessageStatePending,
+		LastDistributeAt: genesisStartedAt(),
+	}
+	current := s.NextRunAt
+	s.LastRunAt = pq.NullTime{Time: t, Valid: true}
+	s.State = ScheduledMessageStateDone
+	if s.Cron != "" {
+		spec, err := parseCronSpec(s.Cron)
+		if err != nil {
+			return session.BadDataError(ctx)
+		}
+		if next := spec.next(t); !next.IsZero() {
+			s.State, s.NextRunAt = ScheduledMessageStateActive, next
+		}
+	}
+	err := session.Database(ctx).RunInTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		r, err := tx.ExecContext(ctx, "UPDATE scheduled_messages SET (state,next_run_at,last_run_at)=($1,$2,$3) WHERE schedule_id=$4 AND next_run_at=$5 AND state=$6", s.State, s.NextRunAt, s.LastRunAt, s.ScheduleId, current, ScheduledMessageStateActive)
+		if err != nil {
+			return err
+		}
+		if n, err := r.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		return createMessageInTx(ctx, tx, message)
+	})
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+func (s *ScheduledMessage) update(ctx context.Context) error {
+	_, err := session.Database(ctx).ExecContext(ctx, "UPDATE scheduled_messages SET (state,next_run_at)=($1,$2) WHERE schedule_id=$3", s.State, s.NextRunAt, s.ScheduleId)
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+func (user *User) readScheduledMessage(ctx context.Context, id string) (*ScheduledMessage, error) {
+	if !user.isAdmin() {
+		return nil, session.ForbiddenError(ctx)
+	}
+	query := fmt.Sprintf("SELECT %s FROM scheduled_messages WHERE schedule_id=$1", strings.Join(scheduledMessagesCols, ","))
+	row := session.Database(ctx).QueryRowContext(ctx, query, id)
+	s, err := scheduledMessageFromRow(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return s, nil
+}
+
+func findScheduledMessages(ctx context.Context, query string, args ...interface{}) ([]*ScheduledMessage, error) {
+	rows, err := session.Database(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var schedules []*ScheduledMessage
+	for rows.Next() {
+		s, err := scheduledMessageFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, nil
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCronSpec(t *testing.T) {
+	assert := assert.New(t)
+
+	base := time.Date(2026, 10, 18, 9, 30, 20, 0, time.UTC)
+	spec, err := parseCronSpec("*/15 * * * *")
+	assert.Nil(err)
+	assert.Equal(time.Date(2026, 10, 18, 9, 45, 0, 0, time.UTC), spec.next(base))
+	spec, err = parseCronSpec("0 9 * * 1")
+	assert.Nil(err)
+	assert.Equal(time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC), spec.next(base))
+	spec, err = parseCronSpec("0 0 1,15 * *")
+	assert.Nil(err)
+	assert.Equal(time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC), spec.next(base))
+	spec, err = parseCronSpec("30 8 * * 7")
+	assert.Nil(err)
+	assert.Equal(time.Date(2026, 10, 25, 8, 30, 0, 0, time.UTC), spec.next(base))
+	spec, err = parseCronSpec("@daily")
+	assert.Nil(err)
+	assert.Equal(time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), spec.next(base))
+	spec, err = parseCronSpec("0 0 30 2 *")
+	assert.Nil(err)
+	assert.True(spec.next(base).IsZero())
+
+	for _, invalid := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		_, err = parseCronSpec(invalid)
+		assert.NotNil(err, invalid)
+	}
+}
+
+func TestScheduledMessageCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	admin := &User{UserId: "e9a5b807-fa8b-455a-8dfa-b189d28310ff"}
+	li := &User{UserId: bot.UuidNewV4().String()}
+	data := base64.StdEncoding.EncodeToString([]byte("weekly notice"))
+
+	s, err := li.CreateScheduledMessage(ctx, MessageCategoryPlainText, data, time.Now().Add(time.Hour), "")
+	assert.NotNil(err)
+	s, err = admin.CreateScheduledMessage(ctx, MessageCategoryMessageRecall, data, time.Now().Add(time.Hour), "")
+	assert.NotNil(err)
+	s, err = admin.CreateScheduledMessage(ctx, MessageCategoryPlainText, data, time.Now().Add(-time.Hour), "")
+	assert.NotNil(err)
+	s, err = admin.CreateScheduledMessage(ctx, MessageCategoryPlainText, data, time.Time{}, "invalid")
+	assert.NotNil(err)
+	imageEnable := config.AppConfig.System.ImageMessageEnable
+	config.AppConfig.System.ImageMessageEnable = false
+	defer func() { config.AppConfig.System.ImageMessageEnable = imageEnable }()
+	once, err := admin.CreateScheduledMessage(ctx, MessageCategoryPlainImage, data, time.Now().Add(time.Second), "")
+	assert.Nil(err)
+	assert.NotNil(once)
+	weekly, err := admin.CreateScheduledMessage(ctx, MessageCategoryPlainText, data, time.Now().Add(time.Second), "0 9 * * 1")
+	assert.Nil(err)
+	assert.NotNil(weekly)
+
+	schedules, err := admin.ListScheduledMessages(ctx)
+	assert.Nil(err)
+	assert.Len(schedules, 2)
+	schedules, err = ListDueScheduledMessages(ctx, 100)
+	assert.Nil(err)
+	assert.Len(schedules, 0)
+
+	time.Sleep(time.Second)
+	schedules, err = ListDueScheduledMessages(ctx, 100)
+	assert.Nil(err)
+	assert.Len(schedules, 2)
+	for _, s := range schedules {
+		id := s.RunMessageId()
+		err = s.Run(ctx)
+		assert.Nil(err)
+		m, err := FindMessage(ctx, id)
+		assert.Nil(err)
+		if assert.NotNil(m) {
+			assert.Equal(config.AppConfig.Mixin.ClientId, m.UserId)
+			assert.Equal(s.Category, m.Category)
+		}
+	}
+	schedules, err = ListDueScheduledMessages(ctx, 100)
+	assert.Nil(err)
+	assert.Len(schedules, 0)
+	s, err = admin.readScheduledMessage(ctx, once.ScheduleId)
+	assert.Nil(err)
+	assert.Equal(ScheduledMessageStateDone, s.State)
+	assert.True(s.LastRunAt.Valid)
+	s, err = admin.readScheduledMessage(ctx, weekly.ScheduleId)
+	assert.Nil(err)
+	assert.Equal(ScheduledMessageStateActive, s.State)
+	assert.Equal(time.Monday, s.NextRunAt.Weekday())
+
+	s, err = admin.PauseScheduledMessage(ctx, weekly.ScheduleId)
+	assert.Nil(err)
+	assert.Equal(ScheduledMessageStatePaused, s.State)
+	s, err = admin.PauseScheduledMessage(ctx, weekly.ScheduleId)
+	assert.NotNil(err)
+	s, err = admin.ResumeScheduledMessage(ctx, weekly.ScheduleId)
+	assert.Nil(err)
+	assert.Equal(ScheduledMessageStateActive, s.State)
+	running := s
+	_, err = admin.PauseScheduledMessage(ctx, weekly.ScheduleId)
+	assert.Nil(err)
+	id := running.RunMessageId()
+	err = running.Run(ctx)
+	assert.Nil(err)
+	m, err := FindMessage(ctx, id)
+	assert.Nil(err)
+	assert.Nil(m)
+	s, err = admin.readScheduledMessage(ctx, weekly.ScheduleId)
+	assert.Nil(err)
+	assert.Equal(ScheduledMessageStatePaused, s.State)
+	s, err = admin.PauseScheduledMessage(ctx, bot.UuidNewV4().String())
+	assert.Nil(err)
+	assert.Nil(s)
+
+	err = li.DeleteScheduledMessage(ctx, weekly.ScheduleId)
+	assert.NotNil(err)
+	err = admin.DeleteScheduledMessage(ctx, weekly.ScheduleId)
+	assert.Nil(err)
+	schedules, err = admin.ListScheduledMessages(ctx)
+	assert.Nil(err)
+	assert.Len(schedules, 1)
+}
@@ -0,0 +1,189 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const transfers_DDL = `
+CREATE TABLE IF NOT EXISTS transfers (
+	snapshot_id       VARCHAR(36) PRIMARY KEY CHECK (snapshot_id ~* '^[0-9a-f-]{36,36}$'),
+	counter_user_id   VARCHAR(36) NOT NULL,
+	asset_id          VARCHAR(36) NOT NULL,
+	amount            VARCHAR(128) NOT NULL,
+	trace_id          VARCHAR(128) NOT NULL DEFAULT '',
+	memo              VARCHAR(1024) NOT NULL DEFAULT '',
+	category          VARCHAR(128) NOT NULL,
+	created_at        TIMESTAMP WITH TIME ZONE NOT NULL,
+	updated_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS transfers_createdx ON transfers(created_at);
+CREATE INDEX IF NOT EXISTS transfers_counter_createdx ON transfers(counter_user_id, created_at);
+`
+
+const (
+	TransferCategoryPending    = "pending"
+	TransferCategoryMembership = "membership"
+	TransferCategoryPacket     = "packet"
+	TransferCategoryUnknown    = "unknown"
+)
+
+type Transfer struct {
+	SnapshotId    string
+	CounterUserId string
+	AssetId       string
+	Amount        string
+	TraceId       string
+	Memo          string
+	Category      string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+var transfersCols = []string{"snapshot_id", "counter_user_id", "asset_id", "amount", "trace_id", "memo", "category", "created_at", "updated_at"}
+
+func (t *Transfer) values() []interface{} {
+	return []interface{}{t.SnapshotId, t.CounterUserId, t.AssetId, t.Amount, t.TraceId, t.Memo, t.Category, t.CreatedAt, t.UpdatedAt}
+}
+
+func transferFromRow(row durable.Row) (*Transfer, error) {
+	var t Transfer
+	err := row.Scan(&t.SnapshotId, &t.CounterUserId, &t.AssetId, &t.Amount, &t.TraceId, &t.Memo, &t.Category, &t.CreatedAt, &t.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &t, err
+}
+
+// CreateTransfer records the snapshot as pending, or returns the recorded one
+// so that a redelivered snapshot is only processed while still pending.
+func CreateTransfer(ctx context.Context, snapshotId, counterUserId, assetId, amount, traceId, memo string, createdAt time.Time) (*Transfer, error) {
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	transfer := &Transfer{
+		SnapshotId:    snapshotId,
+		CounterUserId: counterUserId,
+		AssetId:       assetId,
+		Amount:        amount,
+		TraceId:       traceId,
+		Memo:          memo,
+		Category:      TransferCategoryPending,
+		CreatedAt:     createdAt,
+		UpdatedAt:     time.Now(),
+	}
+	params, positions := compileTableQuery(transfersCols)
+	query := fmt.Sprintf("INSERT INTO transfers (%s) VALUES (%s) ON CONFLICT (snapshot_id) DO NOTHING", params, positions)
+	if _, err := session.Database(ctx).ExecContext(ctx, query, transfer.values()...); err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	query = fmt.Sprintf("SELECT %s FROM transfers WHERE snapshot_id=$1", strings.Join(transfersCols, ","))
+	transfer, err := transferFromRow(session.Database(ctx).QueryRowContext(ctx, query, snapshotId))
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return transfer, nil
+}
+
+const classifyTransferQuery = "UPDATE transfers SET (category,updated_at)=($1,$2) WHERE snapshot_id=$3 AND category=$4"
+
+func ClassifyTransfer(ctx context.Context, snapshotId, category string) error {
+	_, err := session.Database(ctx).ExecContext(ctx, classifyTransferQuery, category, time.Now(), snapshotId, TransferCategoryPending)
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+// classifyTransferInTx only moves a pending transfer, it reports false when
+// the transfer has been classified already.
+func classifyTransferInTx(ctx context.Context, tx *sql.Tx, snapshotId, category string) (bool, error) {
+	r, err := tx.ExecContext(ctx, classifyTransferQuery, category, time.Now(), snapshotId, TransferCategoryPending)
+	if err != nil {
+		return false, err
+	}
+	count, err := r.RowsAffected()
+	return count > 0, err
+}
+
+// PayByTransfer applies the membership payment and classifies the transfer
+// in the same transaction, so a snapshot never pays twice.
+func (user *User) PayByTransfer(ctx context.Context, snapshotId string, plan *config.MembershipPlan) error {
+	err := session.Database(ctx).RunInTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		claimed, err := classifyTransferInTx(ctx, tx, snapshotId, TransferCategoryMembership)
+		if err != nil || !claimed {
+			return err
+		}
+		return user.paymentInTx(ctx, tx, PayMethodMixin, plan)
+	})
+	if err != nil {
+		if sessionErr, ok := err.(session.Error); ok {
+			return sessionErr
+		}
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+type TransferSearch struct {
+	CounterUserId string
+	AssetId       string
+	Category      string
+	Before        time.Time
+	Limit         int64
+}
+
+// SearchTransfers returns the matching transfers newest first, Before pages towards older transfers.
+func SearchTransfers(ctx context.Context, search *TransferSearch) ([]*Transfer, error) {
+	var filters []string
+	var args []interface{}
+	add := func(filter string, arg interface{}) {
+		args = append(args, arg)
+		filters = append(filters, fmt.Sprintf(filter, len(args)))
+	}
+	if search.CounterUserId != "" {
+		add("counter_user_id=$%d", search.CounterUserId)
+	}
+	if search.AssetId != "" {
+		add("asset_id=$%d", search.AssetId)
+	}
+	if search.Category != "" {
+		add("category=$%d", search.Category)
+	}
+	if !search.Before.IsZero() {
+		add("created_at<$%d", search.Before)
+	}
+	where := ""
+	if len(filters) > 0 {
+		where = "WHERE " + strings.Join(filters, " AND ")
+	}
+	limit := search.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	args = append(args, limit)
+	query := fmt.Sprintf("SELECT %s FROM transfers %s ORDER BY created_at DESC LIMIT $%d", strings.Join(transfersCols, ","), where, len(args))
+	rows, err := session.Database(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var transfers []*Transfer
+	for rows.Next() {
+		transfer, err := transferFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, nil
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransfer(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	const cnb = "965e5c6e-434c-3fa9-b780-c50f43cd955c"
+	li, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "name", "http://localhost")
+	assert.Nil(err)
+	plan := config.FindMembershipPlan("")
+
+	snapshotId := bot.UuidNewV4().String()
+	transfer, err := CreateTransfer(ctx, snapshotId, li.UserId, cnb, "1000", li.TraceId, "PAY_TO_JOIN", time.Now())
+	assert.Nil(err)
+	assert.NotNil(transfer)
+	assert.Equal(TransferCategoryPending, transfer.Category)
+	transfer, err = CreateTransfer(ctx, snapshotId, li.UserId, cnb, "2000", li.TraceId, "", time.Now())
+	assert.Nil(err)
+	assert.Equal("1000", transfer.Amount)
+	assert.Equal(TransferCategoryPending, transfer.Category)
+
+	err = li.PayByTransfer(ctx, snapshotId, plan)
+	assert.Nil(err)
+	user, err := FindUser(ctx, li.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePaid, user.State)
+	subscribedAt := user.SubscribedAt
+	err = user.PayByTransfer(ctx, snapshotId, plan)
+	assert.Nil(err)
+	user, err = FindUser(ctx, li.UserId)
+	assert.Nil(err)
+	assert.Equal(subscribedAt.Unix(), user.SubscribedAt.Unix())
+	transfer, err = CreateTransfer(ctx, snapshotId, li.UserId, cnb, "1000", li.TraceId, "", time.Now())
+	assert.Nil(err)
+	assert.Equal(TransferCategoryMembership, transfer.Category)
+
+	other := bot.UuidNewV4().String()
+	_, err = CreateTransfer(ctx, other, li.UserId, cnb, "1", bot.UuidNewV4().String(), "", time.Now().Add(-time.Hour))
+	assert.Nil(err)
+	err = ClassifyTransfer(ctx, other, TransferCategoryUnknown)
+	assert.Nil(err)
+	err = ClassifyTransfer(ctx, other, TransferCategoryPacket)
+	assert.Nil(err)
+
+	transfers, err := SearchTransfers(ctx, &TransferSearch{})
+	assert.Nil(err)
+	assert.Len(transfers, 2)
+	assert.Equal(snapshotId, transfers[0].SnapshotId)
+	transfers, err = SearchTransfers(ctx, &TransferSearch{Category: TransferCategoryUnknown})
+	assert.Nil(err)
+	assert.Len(transfers, 1)
+	assert.Equal(other, transfers[0].SnapshotId)
+	transfers, err = SearchTransfers(ctx, &TransferSearch{CounterUserId: li.UserId, Before: transfers[0].CreatedAt})
+	assert.Nil(err)
+	assert.Len(transfers, 0)
+}
@@ -5,8 +5,6 @@ import (
 	"context"
 	"crypto/sha256"
 	"database/sql"
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"sort"
 	"strconv"
@@ -18,6 +16,7 @@ import (
 	"github.com/MixinNetwork/supergroup.mixin.one/durable"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/lib/pq"
 )
 
 const (
@@ -43,12 +42,15 @@ CREATE TABLE IF NOT EXISTS users (
 	state             VARCHAR(128) NOT NULL,
 	active_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
 	subscribed_at     TIMESTAMP WITH TIME ZONE NOT NULL,
-	pay_method        VARCHAR(512) NOT NULL DEFAULT ''
+	pay_method        VARCHAR(512) NOT NULL DEFAULT '',
+	expires_at        TIMESTAMP WITH TIME ZONE,
+	reminded_at       TIMESTAMP WITH TIME ZONE
 );
 
 CREATE UNIQUE INDEX IF NOT EXISTS users_identityx ON users(identity_number);
 CREATE INDEX IF NOT EXISTS users_subscribedx ON users(subscribed_at);
 CREATE INDEX IF NOT EXISTS users_activex ON users(active_at);
+CREATE INDEX IF NOT EXISTS users_state_expiresx ON users(state, expires_at);
 `
 
 type User struct {
@@ -62,20 +64,22 @@ type User struct {
 	ActiveAt       time.Time
 	SubscribedAt   time.Time
 	PayMethod      string
+	ExpiresAt      pq.NullTime
+	RemindedAt     pq.NullTime
 
 	isNew               bool
 	AuthenticationToken string
 }
 
-var usersCols = []string{"user_id", "identity_number", "full_name", "access_token", "avatar_url", "trace_id", "state", "active_at", "subscribed_at", "pay_method"}
+var usersCols = []string{"user_id", "identity_number", "full_name", "access_token", "avatar_url", "trace_id", "state", "active_at", "subscribed_at", "pay_method", "expires_at", "reminded_at"}
 
 func (u *User) values() []interface{} {
-	return []interface{}{u.UserId, u.IdentityNumber, u.FullName, u.AccessToken, u.AvatarURL, u.TraceId, u.State, u.ActiveAt, u.SubscribedAt, u.PayMethod}
+	return []interface{}{u.UserId, u.IdentityNumber, u.FullName, u.AccessToken, u.AvatarURL, u.TraceId, u.State, u.ActiveAt, u.SubscribedAt, u.PayMethod, u.ExpiresAt, u.RemindedAt}
 }
 
 func userFromRow(row durable.Row) (*User, error) {
 	var u User
-	err := row.Scan(&u.UserId, &u.IdentityNumber, &u.FullName, &u.AccessToken, &u.AvatarURL, &u.TraceId, &u.State, &u.ActiveAt, &u.SubscribedAt, &u.PayMethod)
+	err := row.Scan(&u.UserId, &u.IdentityNumber, &u.FullName, &u.AccessToken, &u.AvatarURL, &u.TraceId, &u.State, &u.ActiveAt, &u.SubscribedAt, &u.PayMethod, &u.ExpiresAt, &u.RemindedAt)
 	return &u, err
 }
 
@@ -238,10 +242,15 @@ func (user *User) UpdateProfile(ctx context.Context, fullName string) error {
 	return nil
 }
 
+// Subscribe is refused to unpaid members when paying to join, expired members
+// included, they have to renew first.
 func (user *User) Subscribe(ctx context.Context) error {
 	if user.SubscribedAt.After(genesisStartedAt()) {
 		return nil
 	}
+	if config.AppConfig.System.PayToJoin && user.State != PaymentStatePaid {
+		return session.ForbiddenError(ctx)
+	}
 	user.SubscribedAt = time.Now()
 	query := "UPDATE users SET subscribed_at=$1 WHERE user_id=$2"
 	if _, err := session.Database(ctx).ExecContext(ctx, query, user.SubscribedAt, user.UserId); err != nil {
@@ -262,9 +271,9 @@ func (user *User) Unsubscribe(ctx context.Context) error {
 	return nil
 }
 
-func (user *User) Payment(ctx context.Context) error {
+func (user *User) Payment(ctx context.Context, plan *config.MembershipPlan) error {
 	err := session.Database(ctx).RunInTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
-		return user.paymentInTx(ctx, tx, PayMethodMixin)
+		return user.paymentInTx(ctx, tx, PayMethodMixin, plan)
 	})
 	if err != nil {
 		if sessionErr, ok := err.(session.Error); ok {
@@ -275,8 +284,11 @@ func (user *User) Payment(ctx context.Context) error {
 	return nil
 }
 
-func (user *User) paymentInTx(ctx context.Context, tx *sql.Tx, method string) error {
+func (user *User) paymentInTx(ctx context.Context, tx *sql.Tx, method string, plan *config.MembershipPlan) error {
 	if user.State != PaymentStatePending {
+		if user.State == PaymentStatePaid && user.ExpiresAt.Valid {
+			return user.renewInTx(ctx, tx, method, plan)
+		}
 		if method == PayMethodCoupon {
 			return session.ForbiddenError(ctx)
 		}
@@ -291,53 +303,9 @@ func (user *User) paymentInTx(ctx context.Context, tx *sql.Tx, method string) er
 		return nil
 	}
 
-	messages, err := readLastestMessagesInTx(ctx, tx, 10)
-	if err != nil {
+	if err := queueBackfillInTx(ctx, tx, user.UserId); err != nil {
 		return err
 	}
-	sort.Slice(messages, func(i, j int) bool { return messages[i].CreatedAt.Before(messages[j].CreatedAt) })
-	var values bytes.Buffer
-	for i, msg := range messages {
-		if msg.Category == MessageCategoryMessageRecall {
-			var recallMessage RecallMessage
-			data, err := base64.StdEncoding.DecodeString(msg.Data)
-			if err != nil {
-				return session.BadDataError(ctx)
-			}
-			err = json.Unmarshal(data, &recallMessage)
-			if err != nil {
-				return session.BadDataError(ctx)
-			}
-
-			r := RecallMessage{
-				MessageId: UniqueConversationId(user.UserId, recallMessage.MessageId),
-			}
-			data, err = json.Marshal(r)
-			if err != nil {
-				return session.BadDataError(ctx)
-			}
-			msg.Data = base64.StdEncoding.EncodeToString(data)
-		}
-
-		messageId := UniqueConversationId(user.UserId, msg.MessageId)
-		dm, err := createDistributeMessage(ctx, messageId, msg.MessageId, "", msg.UserId, user.UserId, msg.Category, msg.Data)
-		if err != nil {
-			session.TransactionError(ctx, err)
-		}
-		if i > 0 {
-			values.WriteString(",")
-		}
-		values.WriteString(distributedMessageValuesString(dm.MessageId, dm.ConversationId, dm.RecipientId, dm.UserId, dm.ParentId, dm.QuoteMessageId, dm.Shard, dm.Category, dm.Data, dm.Status))
-	}
-	v := values.String()
-	if v != "" {
-		dquery := fmt.Sprintf("INSERT INTO distributed_messages (%s) VALUES %s ON CONFLICT (message_id) DO NOTHING", strings.Join(distributedMessagesCols, ","), values.String())
-		_, err := tx.ExecContext(ctx, dquery)
-		if err != nil {
-			return err
-		}
-	}
-
 	if err := createSystemJoinMessage(ctx, tx, user); err != nil {
 		return err
 	}
@@ -345,10 +313,64 @@ func (user *User) paymentInTx(ctx context.Context, tx *sql.Tx, method string) er
 	user.State = PaymentStatePaid
 	user.SubscribedAt = time.Now()
 	user.PayMethod = method
-	_, err = tx.ExecContext(ctx, "UPDATE users SET (state,subscribed_at,pay_method)=($1,$2,$3) WHERE user_id=$4", user.State, user.SubscribedAt, user.PayMethod, user.UserId)
+	user.ExpiresAt = membershipExpiresAt(time.Now(), plan)
+	user.RemindedAt = pq.NullTime{}
+	user.TraceId = bot.UuidNewV4().String()
+	_, err := tx.ExecContext(ctx, "UPDATE users SET (state,subscribed_at,pay_method,expires_at,reminded_at,trace_id)=($1,$2,$3,$4,$5,$6) WHERE user_id=$7", user.State, user.SubscribedAt, user.PayMethod, user.ExpiresAt, user.RemindedAt, user.TraceId, user.UserId)
 	return err
 }
 
+// renewInTx extends a time-limited membership from its current expiry, the
+// trace id is rotated so the next renewal transfer can be told apart.
+func (user *User) renewInTx(ctx context.Context, tx *sql.Tx, method string, plan *config.MembershipPlan) error {
+	from := user.ExpiresAt.Time
+	if from.Before(time.Now()) {
+		from = time.Now()
+	}
+	user.PayMethod = method
+	user.ExpiresAt = membershipExpiresAt(from, plan)
+	user.RemindedAt = pq.NullTime{}
+	user.TraceId = bot.UuidNewV4().String()
+	_, err := tx.ExecContext(ctx, "UPDATE users SET (pay_method,expires_at,reminded_at,trace_id)=($1,$2,$3,$4) WHERE user_id=$5", user.PayMethod, user.ExpiresAt, user.RemindedAt, user.TraceId, user.UserId)
+	return err
+}
+
+// revokeInTx takes back the membership of a refunded payment, a time-limited
+// one loses the plan duration and ends when no time is left, a permanent one
+// paid by WeChat ends at once.
+func (user *User) revokeInTx(ctx context.Context, tx *sql.Tx, plan *config.MembershipPlan) error {
+	if user.State != PaymentStatePaid {
+		return nil
+	}
+	if user.ExpiresAt.Valid {
+		if plan == nil || plan.Duration <= 0 {
+			return nil
+		}
+		user.ExpiresAt.Time = user.ExpiresAt.Time.Add(-plan.Duration)
+		if user.ExpiresAt.Time.After(time.Now()) {
+			_, err := tx.ExecContext(ctx, "UPDATE users SET expires_at=$1 WHERE user_id=$2", user.ExpiresAt, user.UserId)
+			return err
+		}
+	} else if user.PayMethod != PayMethodWechat {
+		return nil
+	}
+	user.State = PaymentStatePending
+	user.SubscribedAt = time.Time{}
+	_, err := tx.ExecContext(ctx, "UPDATE users SET (state,subscribed_at,expires_at)=($1,$2,$3) WHERE user_id=$4", user.State, user.SubscribedAt, user.ExpiresAt, user.UserId)
+	return err
+}
+
+func (user *User) CanPay() bool {
+	return user.State == PaymentStatePending || (user.State == PaymentStatePaid && user.ExpiresAt.Valid)
+}
+
+func membershipExpiresAt(from time.Time, plan *config.MembershipPlan) pq.NullTime {
+	if plan == nil || plan.Duration <= 0 {
+		return pq.NullTime{}
+	}
+	return pq.NullTime{Time: from.Add(plan.Duration), Valid: true}
+}
+
 func Subscribers(ctx context.Context, offset time.Time, identity int64, keywords string) ([]*User, error) {
 	if identity > 20000 {
 		return findUsersByIdentityNumber(ctx, identity)
@@ -450,6 +472,14 @@ func FindUser(ctx context.Context, userId string) (*User, error) {
 	return user, nil
 }
 
+func FindUserByIdentityNumber(ctx context.Context, identity int64) (*User, error) {
+	users, err := findUsersByIdentityNumber(ctx, identity)
+	if err != nil || len(users) == 0 {
+		return nil, err
+	}
+	return users[0], nil
+}
+
 func PingUserActiveAt(ctx context.Context, userId string) error {
 	query := "UPDATE users SET active_at=$1 WHERE user_id=$2"
 	_, err := session.Database(ctx).ExecContext(ctx, query, time.Now(), userId)
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -37,7 +38,17 @@ func TestUserCRUD(t *testing.T) {
 	assert.Nil(err)
 	assert.Len(users, 0)
 
+	system := &config.AppConfig.System
+	payToJoin := system.PayToJoin
+	system.PayToJoin = true
 	err = user.Subscribe(ctx)
+	assert.NotNil(err)
+	user, err = FindUser(ctx, user.UserId)
+	assert.Nil(err)
+	assert.True(user.SubscribedAt.Before(genesisStartedAt()))
+	system.PayToJoin = false
+	err = user.Subscribe(ctx)
+	system.PayToJoin = payToJoin
 	assert.Nil(err)
 	user, err = FindUser(ctx, user.UserId)
 	assert.Nil(err)
@@ -65,7 +76,7 @@ func TestUserCRUD(t *testing.T) {
 	err = message.Distribute(ctx)
 	assert.Nil(err)
 
-	err = user.Payment(ctx)
+	err = user.Payment(ctx, config.FindMembershipPlan(""))
 	assert.Nil(err)
 	user, err = FindUser(ctx, user.UserId)
 	assert.Nil(err)
@@ -75,9 +86,20 @@ func TestUserCRUD(t *testing.T) {
 	assert.Len(messages, 1)
 	dms, err := testReadDistributedMessages(ctx)
 	assert.Nil(err)
+	assert.Len(dms, 0)
+	ids, err := ListPendingBackfills(ctx, 100)
+	assert.Nil(err)
+	assert.Equal([]string{user.UserId}, ids)
+	err = ProcessBackfill(ctx, user.UserId)
+	assert.Nil(err)
+	ids, err = ListPendingBackfills(ctx, 100)
+	assert.Nil(err)
+	assert.Len(ids, 0)
+	dms, err = testReadDistributedMessages(ctx)
+	assert.Nil(err)
 	assert.Len(dms, 1)
 
-	err = user.Payment(ctx)
+	err = user.Payment(ctx, config.FindMembershipPlan(""))
 	assert.Nil(err)
 	user, err = FindUser(ctx, user.UserId)
 	assert.Nil(err)
@@ -97,7 +119,7 @@ func TestUserCRUD(t *testing.T) {
 	assert.Nil(err)
 	assert.NotNil(li)
 	assert.Equal("fullname", li.FullName)
-	err = li.Payment(ctx)
+	err = li.Payment(ctx, config.FindMembershipPlan(""))
 	assert.Nil(err)
 	users, err = Subscribers(ctx, user.SubscribedAt, 0, "")
 	assert.Nil(err)
@@ -105,6 +127,13 @@ func TestUserCRUD(t *testing.T) {
 	users, err = findUsersByIdentityNumber(ctx, li.IdentityNumber)
 	assert.Nil(err)
 	assert.Len(users, 1)
+	user, err = FindUserByIdentityNumber(ctx, li.IdentityNumber)
+	assert.Nil(err)
+	assert.NotNil(user)
+	assert.Equal(li.UserId, user.UserId)
+	user, err = FindUserByIdentityNumber(ctx, 99999)
+	assert.Nil(err)
+	assert.Nil(user)
 
 	li.DeleteUser(ctx, li.UserId)
 	user, err = FindUser(ctx, li.UserId)
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/objcoding/wxpay"
+)
+
+const (
+	wxPayCodeSuccess = "SUCCESS"
+	wxPaySignTypeKey = "sign_type"
+	wxPaySignKey     = "sign"
+)
+
+// HandleWxPayNotification verifies a WeChat Pay notify body and marks the order as paid.
+// A nil error means the notification has been handled and should be acknowledged,
+// notifications for failed payments included; WeChat retries until it gets SUCCESS.
+func HandleWxPayNotification(ctx context.Context, body []byte) (*Order, error) {
+	params, err := parseWxPayXML(body)
+	if err != nil {
+		return nil, session.BadDataError(ctx)
+	}
+	if params["return_code"] != wxPayCodeSuccess {
+		return nil, nil
+	}
+	cfg := config.AppConfig.Wechat
+	if !verifyWxPaySign(params, cfg.MchKey) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	if params["appid"] != cfg.AppId || params["mch_id"] != cfg.MchId {
+		return nil, session.ForbiddenError(ctx)
+	}
+	if params["result_code"] != wxPayCodeSuccess {
+		return nil, nil
+	}
+
+	tn := params["out_trade_no"]
+	if !strings.HasPrefix(tn, WX_TN_PREFIX) {
+		return nil, session.BadDataError(ctx)
+	}
+	traceId, err := strconv.ParseInt(tn[len(WX_TN_PREFIX):], 10, 64)
+	if err != nil {
+		return nil, session.BadDataError(ctx)
+	}
+	totalFee, err := strconv.ParseInt(params["total_fee"], 10, 64)
+	if err != nil {
+		return nil, session.BadDataError(ctx)
+	}
+	order, err := GetOrderByTraceId(ctx, traceId)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, session.NotFoundError(ctx)
+	}
+	if wxPayTotalFee(order.Amount) != totalFee {
+		return nil, session.BadDataError(ctx)
+	}
+	return MarkOrderAsPaidByTraceId(ctx, traceId, params["transaction_id"])
+}
+
+// parseWxPayXML only keeps the direct children of the root element,
+// wxpay.XmlToMap chokes on the indentation some gateways send.
+func parseWxPayXML(body []byte) (wxpay.Params, error) {
+	params := make(wxpay.Params)
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	depth := 0
+	var key string
+	var value strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 {
+				key = t.Name.Local
+				value.Reset()
+			}
+		case xml.CharData:
+			if depth == 2 {
+				value.Write(t)
+			}
+		case xml.EndElement:
+			if depth == 2 {
+				params[key] = strings.TrimSpace(value.String())
+			}
+			depth--
+		}
+	}
+	if len(params) == 0 {
+		return nil, fmt.Errorf("empty wxpay xml")
+	}
+	return params, nil
+}
+
+func signWxPayParams(params wxpay.Params, key string) string {
+	keys := make([]string, 0, len(params))
+	for k, v := range params {
+		if k != wxPaySignKey && v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var buf strings.Builder
+	for _, k := range keys {
+		buf.WriteString(k + "=" + params[k] + "&")
+	}
+	buf.WriteString("key=" + key)
+
+	var h hash.Hash
+	switch params[wxPaySignTypeKey] {
+	case wxpay.HMACSHA256:
+		h = hmac.New(sha256.New, []byte(key))
+	default:
+		h = md5.New()
+	}
+	h.Write([]byte(buf.String()))
+	return strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
+}
+
+func verifyWxPaySign(params wxpay.Params, key string) bool {
+	sign := params[wxPaySignKey]
+	if sign == "" || key == "" {
+		return false
+	}
+	expected := signWxPayParams(params, key)
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToUpper(sign))) == 1
+}
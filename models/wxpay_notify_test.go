@@ -0,0 +1,120 @@
+package models
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+const testWxPayMchKey = "192006250b4c09247ec02edce69f6a2d"
+
+func readWxPayFixture(name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func TestWxPaySign(t *testing.T) {
+	assert := assert.New(t)
+
+	params, err := parseWxPayXML(readWxPayFixture("wxpay_notify_paid.xml"))
+	assert.Nil(err)
+	assert.Equal("tn-1", params["out_trade_no"])
+	assert.Equal("1990", params["total_fee"])
+	assert.True(verifyWxPaySign(params, testWxPayMchKey))
+	assert.False(verifyWxPaySign(params, "wrong-key"))
+	assert.False(verifyWxPaySign(params, ""))
+
+	params, err = parseWxPayXML(readWxPayFixture("wxpay_notify_paid_sha256.xml"))
+	assert.Nil(err)
+	assert.True(verifyWxPaySign(params, testWxPayMchKey))
+
+	params, err = parseWxPayXML(readWxPayFixture("wxpay_notify_bad_sign.xml"))
+	assert.Nil(err)
+	assert.False(verifyWxPaySign(params, testWxPayMchKey))
+
+	_, err = parseWxPayXML([]byte("not xml"))
+	assert.NotNil(err)
+	params, err = parseWxPayXML(readWxPayFixture("wxpay_notify_paid_decimal.xml"))
+	assert.Nil(err)
+	assert.Equal("1230", params["total_fee"])
+	assert.True(verifyWxPaySign(params, testWxPayMchKey))
+
+	assert.Equal(int64(1990), wxPayTotalFee("19.9"))
+	assert.Equal(int64(1), wxPayTotalFee("0.01"))
+	assert.Equal(int64(1230), wxPayTotalFee("12.3"))
+	assert.Equal(int64(1280), wxPayTotalFee("12.8"))
+	assert.Equal(int64(7), wxPayTotalFee("0.07"))
+	assert.Equal(int64(100), wxPayTotalFee("1"))
+}
+
+func TestWxPayNotification(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	wechat := &config.AppConfig.Wechat
+	wechat.AppId, wechat.MchId, wechat.MchKey = "wx2421b1c4370ec43b", "10000100", testWxPayMchKey
+	payToJoin := config.AppConfig.System.PayToJoin
+	config.AppConfig.System.PayToJoin = true
+	defer func() { config.AppConfig.System.PayToJoin = payToJoin }()
+
+	li, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "name", "http://localhost")
+	assert.Nil(err)
+	assert.NotNil(li)
+
+	order, err := HandleWxPayNotification(ctx, readWxPayFixture("wxpay_notify_paid.xml"))
+	assert.NotNil(err)
+	assert.Nil(order)
+
+	orderId := bot.UuidNewV4().String()
+	_, err = session.Database(ctx).ExecContext(ctx, "INSERT INTO orders (order_id, trace_id, user_id, state, amount, channel) VALUES ($1, 1, $2, 'NOTPAID', '19.9', 'wx')", orderId, li.UserId)
+	assert.Nil(err)
+
+	order, err = HandleWxPayNotification(ctx, readWxPayFixture("wxpay_notify_bad_sign.xml"))
+	assert.NotNil(err)
+	assert.Nil(order)
+	order, err = HandleWxPayNotification(ctx, readWxPayFixture("wxpay_notify_fee_mismatch.xml"))
+	assert.NotNil(err)
+	assert.Nil(order)
+	order, err = HandleWxPayNotification(ctx, readWxPayFixture("wxpay_notify_failed.xml"))
+	assert.Nil(err)
+	assert.Nil(order)
+	order, err = GetOrder(ctx, orderId)
+	assert.Nil(err)
+	assert.Equal("NOTPAID", order.State)
+
+	order, err = HandleWxPayNotification(ctx, readWxPayFixture("wxpay_notify_paid.xml"))
+	assert.Nil(err)
+	assert.NotNil(order)
+	assert.Equal("PAID", order.State)
+	assert.Equal("1004400740201409030005092168", order.TransactionId)
+	paidAt := order.PaidAt.Time
+	order, err = HandleWxPayNotification(ctx, readWxPayFixture("wxpay_notify_paid_sha256.xml"))
+	assert.Nil(err)
+	assert.NotNil(order)
+	assert.Equal("PAID", order.State)
+	order, err = GetOrder(ctx, orderId)
+	assert.Nil(err)
+	assert.True(order.PaidAt.Valid)
+	assert.True(paidAt.Equal(order.PaidAt.Time))
+	user, err := FindUser(ctx, li.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePaid, user.State)
+	assert.Equal(PayMethodWechat, user.PayMethod)
+
+	orderId = bot.UuidNewV4().String()
+	_, err = session.Database(ctx).ExecContext(ctx, "INSERT INTO orders (order_id, trace_id, user_id, state, amount, channel) VALUES ($1, 2, $2, 'NOTPAID', '12.3', 'wx')", orderId, li.UserId)
+	assert.Nil(err)
+	order, err = HandleWxPayNotification(ctx, readWxPayFixture("wxpay_notify_paid_decimal.xml"))
+	assert.Nil(err)
+	assert.NotNil(order)
+	assert.Equal("PAID", order.State)
+}
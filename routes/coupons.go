@@ -10,7 +10,6 @@ import (
 	"github.com/MixinNetwork/supergroup.mixin.one/models"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 	"github.com/MixinNetwork/supergroup.mixin.one/views"
-	"github.com/dimfeld/httptreemux"
 )
 
 type couponImpl struct{}
@@ -19,7 +18,7 @@ type couponRequest struct {
 	Quantity int `json:"quantity"`
 }
 
-func registerCoupons(router *httptreemux.TreeMux) {
+func registerCoupons(router *middlewares.Router) {
 	impl := &couponImpl{}
 
 	router.POST("/coupons", impl.create)
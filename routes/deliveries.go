@@ -0,0 +1,45 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+)
+
+type deliveriesImpl struct{}
+
+type deliveriesRequeueRequest struct {
+	MessageIds []string `json:"message_ids"`
+}
+
+func registerDeliveries(router *middlewares.Router) {
+	impl := &deliveriesImpl{}
+
+	router.GET("/deliveries/failed", impl.failed)
+	router.POST("/deliveries/requeue", impl.requeue)
+}
+
+func (impl *deliveriesImpl) failed(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	if middlewares.CurrentUser(r).GetRole() != "admin" {
+		views.RenderErrorResponse(w, r, session.ForbiddenError(r.Context()))
+	} else if messages, err := models.ListFailedDistributedMessages(r.Context(), 100); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderDeliveries(w, r, messages)
+	}
+}
+
+func (impl *deliveriesImpl) requeue(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	var body deliveriesRequeueRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+	} else if count, err := middlewares.CurrentUser(r).RequeueDistributedMessages(r.Context(), body.MessageIds); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderDataResponse(w, r, map[string]int64{"count": count})
+	}
+}
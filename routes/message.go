@@ -1,24 +1,24 @@
 package routes
 
 import (
-	"encoding/base64"
-	"encoding/json"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
 	"github.com/MixinNetwork/supergroup.mixin.one/models"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 	"github.com/MixinNetwork/supergroup.mixin.one/views"
-	"github.com/dimfeld/httptreemux"
 )
 
 type messageImpl struct{}
 
-func registerMesseages(router *httptreemux.TreeMux) {
+func registerMesseages(router *middlewares.Router) {
 	impl := messageImpl{}
 
 	router.GET("/messages", impl.index)
+	router.GET("/messages/stats", impl.stats)
+	router.GET("/messages/search", impl.search)
 	router.POST("/messages/:id/recall", impl.recall)
 }
 
@@ -33,34 +33,65 @@ func (impl *messageImpl) index(w http.ResponseWriter, r *http.Request, _ map[str
 	}
 }
 
-func (impl *messageImpl) recall(w http.ResponseWriter, r *http.Request, params map[string]string) {
-	message, err := models.FindMessage(r.Context(), params["id"])
-	if err != nil {
+func (impl *messageImpl) stats(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	if middlewares.CurrentUser(r).GetRole() != "admin" {
+		views.RenderErrorResponse(w, r, session.ForbiddenError(r.Context()))
+	} else if stats, err := models.ListMessageStats(r.Context(), 200); err != nil {
 		views.RenderErrorResponse(w, r, err)
-		return
+	} else {
+		views.RenderMessageStats(w, r, stats)
 	}
-	switch message.Category {
-	case models.MessageCategoryPlainText,
-		models.MessageCategoryPlainImage,
-		models.MessageCategoryPlainVideo,
-		models.MessageCategoryPlainData,
-		models.MessageCategoryPlainSticker,
-		models.MessageCategoryPlainContact,
-		models.MessageCategoryPlainAudio:
-	default:
+}
+
+// search takes q, user_id, category, since and until as filters, and the
+// before or after cursors from the prev and next of the previous page.
+func (impl *messageImpl) search(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	if middlewares.CurrentUser(r).GetRole() != "admin" {
 		views.RenderErrorResponse(w, r, session.ForbiddenError(r.Context()))
 		return
 	}
-	data, err := json.Marshal(map[string]string{"message_id": params["id"]})
+	query := r.URL.Query()
+	search := &models.MessageSearch{
+		Query:    query.Get("q"),
+		UserId:   query.Get("user_id"),
+		Category: query.Get("category"),
+	}
+	search.Limit, _ = strconv.ParseInt(query.Get("limit"), 10, 64)
+	for key, t := range map[string]*time.Time{"since": &search.Since, "until": &search.Until} {
+		if v := query.Get(key); v != "" {
+			parsed, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+				return
+			}
+			*t = parsed
+		}
+	}
+	for key, c := range map[string]**models.MessageCursor{"before": &search.Before, "after": &search.After} {
+		if v := query.Get(key); v != "" {
+			parsed, err := models.ParseMessageCursor(v)
+			if err != nil {
+				views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+				return
+			}
+			*c = parsed
+		}
+	}
+	messages, err := models.SearchMessages(r.Context(), search)
 	if err != nil {
 		views.RenderErrorResponse(w, r, err)
 		return
 	}
-	str := base64.StdEncoding.EncodeToString(data)
-	t := time.Now()
-	id := models.UniqueConversationId(params["id"], middlewares.CurrentUser(r).UserId)
-	_, err = models.CreateMessage(r.Context(), middlewares.CurrentUser(r), id, models.MessageCategoryMessageRecall, "", str, t, t)
-	if err != nil {
+	var prev, next string
+	if len(messages) > 0 {
+		prev = messages[0].Cursor().String()
+		next = messages[len(messages)-1].Cursor().String()
+	}
+	views.RenderMessagesPage(w, r, messages, prev, next)
+}
+
+func (impl *messageImpl) recall(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if _, err := middlewares.CurrentUser(r).RecallMessage(r.Context(), params["id"]); err != nil {
 		views.RenderErrorResponse(w, r, err)
 	} else {
 		views.RenderBlankResponse(w, r)
@@ -0,0 +1,64 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+)
+
+type moderationsImpl struct{}
+
+type moderationRejectRequest struct {
+	Action  string `json:"action"`
+	Minutes int64  `json:"minutes"`
+}
+
+func registerModerations(router *middlewares.Router) {
+	impl := &moderationsImpl{}
+
+	router.GET("/moderations", impl.index)
+	router.POST("/moderations/:id/approve", impl.approve)
+	router.POST("/moderations/:id/reject", impl.reject)
+}
+
+func (impl *moderationsImpl) index(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	state := r.URL.Query().Get("state")
+	if state == "" {
+		state = models.ModerationStatePending
+	}
+	if middlewares.CurrentUser(r).GetRole() != "admin" {
+		views.RenderErrorResponse(w, r, session.ForbiddenError(r.Context()))
+	} else if moderations, err := models.ListModerations(r.Context(), state, 100); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderModerations(w, r, moderations)
+	}
+}
+
+func (impl *moderationsImpl) approve(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if m, err := middlewares.CurrentUser(r).ApproveModeration(r.Context(), params["id"]); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else if m == nil {
+		views.RenderErrorResponse(w, r, session.NotFoundError(r.Context()))
+	} else {
+		views.RenderModeration(w, r, m)
+	}
+}
+
+func (impl *moderationsImpl) reject(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	var body moderationRejectRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+	} else if m, err := middlewares.CurrentUser(r).RejectModeration(r.Context(), params["id"], body.Action, time.Duration(body.Minutes)*time.Minute); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else if m == nil {
+		views.RenderErrorResponse(w, r, session.NotFoundError(r.Context()))
+	} else {
+		views.RenderModeration(w, r, m)
+	}
+}
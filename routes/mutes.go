@@ -0,0 +1,58 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+)
+
+type mutesImpl struct{}
+
+type muteRequest struct {
+	Minutes int64  `json:"minutes"`
+	Reason  string `json:"reason"`
+}
+
+func registerMutes(router *middlewares.Router) {
+	impl := &mutesImpl{}
+
+	router.GET("/mutes", impl.index)
+	router.POST("/users/:id/mute", impl.create)
+	router.POST("/users/:id/unmute", impl.destroy)
+}
+
+func (impl *mutesImpl) index(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	if middlewares.CurrentUser(r).GetRole() != "admin" {
+		views.RenderErrorResponse(w, r, session.ForbiddenError(r.Context()))
+	} else if mutes, err := models.ListMutes(r.Context()); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderMutes(w, r, mutes)
+	}
+}
+
+func (impl *mutesImpl) create(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	var body muteRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+	} else if mute, err := middlewares.CurrentUser(r).MuteUser(r.Context(), params["id"], time.Duration(body.Minutes)*time.Minute, body.Reason); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else if mute == nil {
+		views.RenderErrorResponse(w, r, session.NotFoundError(r.Context()))
+	} else {
+		views.RenderMute(w, r, mute)
+	}
+}
+
+func (impl *mutesImpl) destroy(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if err := middlewares.CurrentUser(r).UnmuteUser(r.Context(), params["id"]); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderBlankResponse(w, r)
+	}
+}
@@ -0,0 +1,93 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+)
+
+type ordersImpl struct{}
+
+func registerOrders(router *middlewares.Router) {
+	impl := &ordersImpl{}
+
+	router.GET("/orders", impl.index)
+	router.GET("/me/orders", impl.mine)
+	router.POST("/orders/:id/cancel", impl.cancel)
+	router.POST("/orders/:id/refund", impl.refund)
+}
+
+// index takes user_id, channel, state, since and until as filters, and the
+// before cursor from the next of the previous page.
+func (impl *ordersImpl) index(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	if middlewares.CurrentUser(r).GetRole() != "admin" {
+		views.RenderErrorResponse(w, r, session.ForbiddenError(r.Context()))
+		return
+	}
+	query := r.URL.Query()
+	search := &models.OrderSearch{
+		UserId:  query.Get("user_id"),
+		Channel: query.Get("channel"),
+		State:   query.Get("state"),
+	}
+	impl.search(w, r, search)
+}
+
+func (impl *ordersImpl) mine(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	query := r.URL.Query()
+	search := &models.OrderSearch{
+		UserId: middlewares.CurrentUser(r).UserId,
+		State:  query.Get("state"),
+	}
+	impl.search(w, r, search)
+}
+
+func (impl *ordersImpl) search(w http.ResponseWriter, r *http.Request, search *models.OrderSearch) {
+	query := r.URL.Query()
+	search.Limit, _ = strconv.ParseInt(query.Get("limit"), 10, 64)
+	for key, t := range map[string]*time.Time{"since": &search.Since, "until": &search.Until, "before": &search.Before} {
+		if v := query.Get(key); v != "" {
+			parsed, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+				return
+			}
+			*t = parsed
+		}
+	}
+	orders, err := models.SearchOrders(r.Context(), search)
+	if err != nil {
+		views.RenderErrorResponse(w, r, err)
+		return
+	}
+	var next string
+	if len(orders) > 0 {
+		next = orders[len(orders)-1].CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	views.RenderOrdersPage(w, r, orders, next)
+}
+
+func (impl *ordersImpl) cancel(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if order, err := middlewares.CurrentUser(r).CancelOrder(r.Context(), params["id"]); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else if order == nil {
+		views.RenderErrorResponse(w, r, session.NotFoundError(r.Context()))
+	} else {
+		views.RenderOrder(w, r, order)
+	}
+}
+
+func (impl *ordersImpl) refund(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if order, err := middlewares.CurrentUser(r).RefundOrder(r.Context(), params["id"]); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else if order == nil {
+		views.RenderErrorResponse(w, r, session.NotFoundError(r.Context()))
+	} else {
+		views.RenderOrder(w, r, order)
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"github.com/MixinNetwork/supergroup.mixin.one/models"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 	"github.com/MixinNetwork/supergroup.mixin.one/views"
-	"github.com/dimfeld/httptreemux"
 )
 
 type packetsImpl struct{}
@@ -21,7 +20,7 @@ type packetRequest struct {
 	Greeting   string `json:"greeting"`
 }
 
-func registerPackets(router *httptreemux.TreeMux) {
+func registerPackets(router *middlewares.Router) {
 	impl := &packetsImpl{}
 
 	router.GET("/packets/prepare", impl.prepare)
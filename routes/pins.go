@@ -0,0 +1,61 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+)
+
+type pinsImpl struct{}
+
+type pinRequest struct {
+	MessageId string `json:"message_id"`
+	Text      string `json:"text"`
+}
+
+func registerPins(router *middlewares.Router) {
+	impl := &pinsImpl{}
+
+	router.GET("/pins", impl.index)
+	router.POST("/pins", impl.create)
+	router.POST("/pins/:id/unpin", impl.unpin)
+}
+
+func (impl *pinsImpl) index(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	if pins, err := models.ListPins(r.Context()); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderPins(w, r, pins)
+	}
+}
+
+func (impl *pinsImpl) create(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	var body pinRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+	} else if body.MessageId == "" {
+		if pin, err := middlewares.CurrentUser(r).CreateAnnouncement(r.Context(), body.Text); err != nil {
+			views.RenderErrorResponse(w, r, err)
+		} else {
+			views.RenderPin(w, r, pin)
+		}
+	} else if pin, err := middlewares.CurrentUser(r).PinMessage(r.Context(), body.MessageId); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else if pin == nil {
+		views.RenderErrorResponse(w, r, session.NotFoundError(r.Context()))
+	} else {
+		views.RenderPin(w, r, pin)
+	}
+}
+
+func (impl *pinsImpl) unpin(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if err := middlewares.CurrentUser(r).UnpinMessage(r.Context(), params["id"]); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderBlankResponse(w, r)
+	}
+}
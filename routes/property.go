@@ -8,12 +8,11 @@ import (
 	"github.com/MixinNetwork/supergroup.mixin.one/models"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 	"github.com/MixinNetwork/supergroup.mixin.one/views"
-	"github.com/dimfeld/httptreemux"
 )
 
 type propertyImpl struct{}
 
-func registerProperties(router *httptreemux.TreeMux) {
+func registerProperties(router *middlewares.Router) {
 	impl := propertyImpl{}
 
 	router.POST("/properties", impl.create)
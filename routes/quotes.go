@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+)
+
+type quotesImpl struct{}
+
+type quoteRequest struct {
+	Plan    string `json:"plan"`
+	AssetId string `json:"asset_id"`
+}
+
+func registerQuotes(router *middlewares.Router) {
+	impl := &quotesImpl{}
+
+	router.POST("/quotes", impl.create)
+}
+
+func (impl *quotesImpl) create(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	var body quoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+	} else if quote, err := middlewares.CurrentUser(r).CreateQuote(r.Context(), body.Plan, body.AssetId); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderQuote(w, r, quote)
+	}
+}
@@ -5,15 +5,15 @@ import (
 	"runtime"
 
 	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
 	"github.com/MixinNetwork/supergroup.mixin.one/views"
-	"github.com/dimfeld/httptreemux"
 	"github.com/silenceper/wechat"
 )
 
 var wxcfg *wechat.Config
 var wxclient *wechat.Wechat
 
-func RegisterRoutes(router *httptreemux.TreeMux) {
+func RegisterRoutes(router *middlewares.Router) {
 	//配置微信参数
 	wxcfg = &wechat.Config{
 		AppID:          config.AppConfig.Wechat.AppId,
@@ -30,6 +30,14 @@ func RegisterRoutes(router *httptreemux.TreeMux) {
 	registerMesseages(router)
 	registerProperties(router)
 	registerCoupons(router)
+	registerMutes(router)
+	registerModerations(router)
+	registerPins(router)
+	registerSchedules(router)
+	registerDeliveries(router)
+	registerOrders(router)
+	registerTransfers(router)
+	registerQuotes(router)
 	registerWechat(router)
 }
 
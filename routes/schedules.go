@@ -0,0 +1,86 @@
+package routes
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+)
+
+type schedulesImpl struct{}
+
+type scheduleRequest struct {
+	Category string    `json:"category"`
+	Data     string    `json:"data"`
+	Text     string    `json:"text"`
+	RunAt    time.Time `json:"run_at"`
+	Cron     string    `json:"cron"`
+}
+
+func registerSchedules(router *middlewares.Router) {
+	impl := &schedulesImpl{}
+
+	router.GET("/schedules", impl.index)
+	router.POST("/schedules", impl.create)
+	router.POST("/schedules/:id/pause", impl.pause)
+	router.POST("/schedules/:id/resume", impl.resume)
+	router.POST("/schedules/:id/delete", impl.delete)
+}
+
+func (impl *schedulesImpl) index(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	if schedules, err := middlewares.CurrentUser(r).ListScheduledMessages(r.Context()); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderScheduledMessages(w, r, schedules)
+	}
+}
+
+func (impl *schedulesImpl) create(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	var body scheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+		return
+	}
+	if body.Text != "" {
+		body.Category = models.MessageCategoryPlainText
+		body.Data = base64.StdEncoding.EncodeToString([]byte(body.Text))
+	}
+	if s, err := middlewares.CurrentUser(r).CreateScheduledMessage(r.Context(), body.Category, body.Data, body.RunAt, body.Cron); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderScheduledMessage(w, r, s)
+	}
+}
+
+func (impl *schedulesImpl) pause(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if s, err := middlewares.CurrentUser(r).PauseScheduledMessage(r.Context(), params["id"]); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else if s == nil {
+		views.RenderErrorResponse(w, r, session.NotFoundError(r.Context()))
+	} else {
+		views.RenderScheduledMessage(w, r, s)
+	}
+}
+
+func (impl *schedulesImpl) resume(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if s, err := middlewares.CurrentUser(r).ResumeScheduledMessage(r.Context(), params["id"]); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else if s == nil {
+		views.RenderErrorResponse(w, r, session.NotFoundError(r.Context()))
+	} else {
+		views.RenderScheduledMessage(w, r, s)
+	}
+}
+
+func (impl *schedulesImpl) delete(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if err := middlewares.CurrentUser(r).DeleteScheduledMessage(r.Context(), params["id"]); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderBlankResponse(w, r)
+	}
+}
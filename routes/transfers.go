@@ -0,0 +1,54 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+)
+
+type transfersImpl struct{}
+
+func registerTransfers(router *middlewares.Router) {
+	impl := &transfersImpl{}
+
+	router.GET("/transfers", impl.index)
+}
+
+// index takes user_id, asset_id and category as filters, and the before
+// cursor from the next of the previous page.
+func (impl *transfersImpl) index(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	if middlewares.CurrentUser(r).GetRole() != "admin" {
+		views.RenderErrorResponse(w, r, session.ForbiddenError(r.Context()))
+		return
+	}
+	query := r.URL.Query()
+	search := &models.TransferSearch{
+		CounterUserId: query.Get("user_id"),
+		AssetId:       query.Get("asset_id"),
+		Category:      query.Get("category"),
+	}
+	search.Limit, _ = strconv.ParseInt(query.Get("limit"), 10, 64)
+	if v := query.Get("before"); v != "" {
+		before, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+			return
+		}
+		search.Before = before
+	}
+	transfers, err := models.SearchTransfers(r.Context(), search)
+	if err != nil {
+		views.RenderErrorResponse(w, r, err)
+		return
+	}
+	var next string
+	if len(transfers) > 0 {
+		next = transfers[len(transfers)-1].CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	views.RenderTransfersPage(w, r, transfers, next)
+}
@@ -11,7 +11,6 @@ import (
 	"github.com/MixinNetwork/supergroup.mixin.one/models"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 	"github.com/MixinNetwork/supergroup.mixin.one/views"
-	"github.com/dimfeld/httptreemux"
 )
 
 type usersImpl struct{}
@@ -20,7 +19,7 @@ type userRequest struct {
 	FullName string `json:"full_name"`
 }
 
-func registerUsers(router *httptreemux.TreeMux) {
+func registerUsers(router *middlewares.Router) {
 	impl := &usersImpl{}
 	router.POST("/auth", impl.authenticate)
 	router.POST("/account", impl.update)
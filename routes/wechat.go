@@ -3,21 +3,21 @@ package routes
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 
 	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
 	"github.com/MixinNetwork/supergroup.mixin.one/models"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 	"github.com/MixinNetwork/supergroup.mixin.one/views"
-	"github.com/dimfeld/httptreemux"
 	"github.com/objcoding/wxpay"
 )
 
 type wechatImpl struct{}
 
-func registerWechat(router *httptreemux.TreeMux) {
+func registerWechat(router *middlewares.Router) {
 	impl := &wechatImpl{}
 	router.POST("/wechat/pay/create", impl.createWxPay)
 	router.POST("/wechat/pay/callback", impl.wxPayCallback)
@@ -27,19 +27,34 @@ func registerWechat(router *httptreemux.TreeMux) {
 }
 
 func (impl *wechatImpl) wxPayCallback(w http.ResponseWriter, r *http.Request, params map[string]string) {
-	bodyBytes, err := ioutil.ReadAll(r.Body)
+	var notifies wxpay.Notifies
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1<<16))
 	if err != nil {
-		log.Fatal(err)
+		renderWxPayNotify(w, notifies.NotOK("read body failed"))
+		return
+	}
+	if order, err := models.HandleWxPayNotification(r.Context(), body); err != nil {
+		session.Logger(r.Context()).Errorf("wxPayCallback: %v", err)
+		renderWxPayNotify(w, notifies.NotOK(err.Error()))
+	} else {
+		if order != nil {
+			session.Logger(r.Context()).Infof("wxPayCallback: order %s %s", order.OrderId, order.State)
+		}
+		renderWxPayNotify(w, notifies.OK())
 	}
-	bodyString := string(bodyBytes)
-	fmt.Printf("wxPayCallback: %v\n", bodyString)
-	views.RenderDataResponse(w, r, config.GetExported())
+}
+
+func renderWxPayNotify(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(body))
 }
 
 func (impl *wechatImpl) createWxPay(w http.ResponseWriter, r *http.Request, _ map[string]string) {
 	var payload struct {
 		OpenId string `json:"open_id"`
 		UserId string `json:"user_id"`
+		Plan   string `json:"plan"`
 	}
 	var resp struct {
 		Order       *models.Order `json:"order"`
@@ -50,7 +65,7 @@ func (impl *wechatImpl) createWxPay(w http.ResponseWriter, r *http.Request, _ ma
 		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
 		return
 	}
-	if order, payParams, payJsParams, err := models.CreateOrder(r.Context(), payload.UserId, "19.9", payload.OpenId); err != nil {
+	if order, payParams, payJsParams, err := models.CreateOrder(r.Context(), payload.UserId, payload.Plan, payload.OpenId); err != nil {
 		views.RenderErrorResponse(w, r, err)
 	} else {
 		resp.Order = order
@@ -74,9 +89,9 @@ func (impl *wechatImpl) wxOAuthRequest(w http.ResponseWriter, r *http.Request, p
 	wxoauth := wxclient.GetOauth()
 	url, err := wxoauth.GetRedirectURL(config.AppConfig.Service.HTTPResourceHost+"/wechat/callback", "snsapi_userinfo", userId)
 	if err != nil {
-		fmt.Println(err)
+		session.Logger(r.Context()).Errorf("wxOAuthRequest GetRedirectURL: %v", err)
 	}
-	fmt.Println(url)
+	session.Logger(r.Context()).Infof("wxOAuthRequest redirect: %s", url)
 	http.Redirect(w, r, url, 302)
 }
 
@@ -87,7 +102,7 @@ func (impl *wechatImpl) wxOAuthCallback(w http.ResponseWriter, r *http.Request,
 	userId := r.URL.Query().Get("state")
 	resToken, err := wxoauth.GetUserAccessToken(code)
 	if err != nil {
-		fmt.Println(err)
+		session.Logger(r.Context()).Errorf("wxOAuthCallback GetUserAccessToken: %v", err)
 		return
 	}
 	url := fmt.Sprintf(config.AppConfig.Service.HTTPResourceHost+"/?#/wxpay?access_token=%s&open_id=%s&user_id=%s", resToken.AccessToken, resToken.OpenID, userId)
@@ -8,14 +8,19 @@ CREATE TABLE IF NOT EXISTS users (
   state             VARCHAR(128) NOT NULL,
   active_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
   subscribed_at     TIMESTAMP WITH TIME ZONE NOT NULL,
-  pay_method        VARCHAR(512) NOT NULL DEFAULT ''
+  pay_method        VARCHAR(512) NOT NULL DEFAULT '',
+  expires_at        TIMESTAMP WITH TIME ZONE,
+  reminded_at       TIMESTAMP WITH TIME ZONE
 );
 
 CREATE UNIQUE INDEX IF NOT EXISTS users_identityx ON users(identity_number);
 CREATE INDEX IF NOT EXISTS users_subscribedx ON users(subscribed_at);
 CREATE INDEX IF NOT EXISTS users_activex ON users(active_at);
+CREATE INDEX IF NOT EXISTS users_state_expiresx ON users(state,expires_at);
 
 
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
 CREATE TABLE IF NOT EXISTS messages (
   message_id            VARCHAR(36) PRIMARY KEY CHECK (message_id ~* '^[0-9a-f-]{36,36}$'),
   user_id               VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
@@ -25,10 +30,13 @@ CREATE TABLE IF NOT EXISTS messages (
   created_at            TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
   updated_at            TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
   state                 VARCHAR(128) NOT NULL,
-  last_distribute_at    TIMESTAMP WITH TIME ZONE NOT NULL
+  last_distribute_at    TIMESTAMP WITH TIME ZONE NOT NULL,
+  search_text           TEXT NOT NULL DEFAULT ''
 );
 
 CREATE INDEX IF NOT EXISTS messages_state_updatedx ON messages(state, updated_at);
+CREATE INDEX IF NOT EXISTS messages_created_messagex ON messages(created_at, message_id);
+CREATE INDEX IF NOT EXISTS messages_search_textx ON messages USING GIN (search_text gin_trgm_ops);
 
 
 CREATE TABLE IF NOT EXISTS distributed_messages (
@@ -42,7 +50,10 @@ CREATE TABLE IF NOT EXISTS distributed_messages (
   category              VARCHAR(512) NOT NULL,
   data                  TEXT NOT NULL,
   status                VARCHAR(512) NOT NULL,
-  created_at            TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+  created_at            TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  attempts              INTEGER NOT NULL DEFAULT 0,
+  last_error            VARCHAR(1024) NOT NULL DEFAULT '',
+  next_attempt_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
 
 CREATE INDEX IF NOT EXISTS message_shard_statusx ON distributed_messages(shard, status, created_at);
@@ -82,7 +93,8 @@ CREATE TABLE IF NOT EXISTS assets (
   name             VARCHAR(512) NOT NULL,
   icon_url         VARCHAR(1024) NOT NULL,
   price_btc        VARCHAR(128) NOT NULL,
-  price_usd        VARCHAR(128) NOT NULL
+  price_usd        VARCHAR(128) NOT NULL,
+  updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
 
 
@@ -106,11 +118,13 @@ CREATE TABLE IF NOT EXISTS orders (
   amount           VARCHAR(128) NOT NULL,
   channel          VARCHAR(32) NOT NULL,
   transaction_id   VARCHAR(32) DEFAULT '',
+  plan             VARCHAR(128) NOT NULL DEFAULT '',
   created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
   paid_at          TIMESTAMP WITH TIME ZONE
 );
 
 CREATE INDEX IF NOT EXISTS order_created_paidx ON orders(user_id,state,created_at);
+CREATE INDEX IF NOT EXISTS order_state_createdx ON orders(state,created_at);
 
 
 CREATE TABLE IF NOT EXISTS coupons (
@@ -125,3 +139,120 @@ CREATE TABLE IF NOT EXISTS coupons (
 CREATE UNIQUE INDEX IF NOT EXISTS coupons_codex ON coupons(code);
 CREATE INDEX IF NOT EXISTS coupons_occupiedx ON coupons(occupied_by);
 CREATE INDEX IF NOT EXISTS coupons_userx ON coupons(user_id);
+
+
+CREATE TABLE IF NOT EXISTS mutes (
+  user_id           VARCHAR(36) PRIMARY KEY CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  muted_by          VARCHAR(36) NOT NULL CHECK (muted_by ~* '^[0-9a-f-]{36,36}$'),
+  reason            VARCHAR(512) NOT NULL DEFAULT '',
+  expires_at        TIMESTAMP WITH TIME ZONE NOT NULL,
+  created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS mutes_expiresx ON mutes(expires_at);
+
+
+CREATE TABLE IF NOT EXISTS rate_limits (
+  key               VARCHAR(128) PRIMARY KEY,
+  tokens            DOUBLE PRECISION NOT NULL,
+  updated_at        TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+
+CREATE TABLE IF NOT EXISTS moderations (
+  message_id        VARCHAR(36) PRIMARY KEY CHECK (message_id ~* '^[0-9a-f-]{36,36}$'),
+  user_id           VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  category          VARCHAR(512) NOT NULL,
+  interceptor       VARCHAR(128) NOT NULL,
+  reason            VARCHAR(1024) NOT NULL,
+  state             VARCHAR(128) NOT NULL,
+  action            VARCHAR(128) NOT NULL DEFAULT '',
+  decided_by        VARCHAR(36) NOT NULL DEFAULT '',
+  decided_at        TIMESTAMP WITH TIME ZONE,
+  created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS moderations_state_createdx ON moderations(state, created_at);
+
+
+CREATE TABLE IF NOT EXISTS message_stats (
+  parent_id         VARCHAR(36) PRIMARY KEY CHECK (parent_id ~* '^[0-9a-f-]{36,36}$'),
+  sent_count        BIGINT NOT NULL DEFAULT 0,
+  delivered_count   BIGINT NOT NULL DEFAULT 0,
+  read_count        BIGINT NOT NULL DEFAULT 0,
+  updated_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+
+CREATE TABLE IF NOT EXISTS message_receipts (
+  message_id        VARCHAR(36) PRIMARY KEY CHECK (message_id ~* '^[0-9a-f-]{36,36}$'),
+  parent_id         VARCHAR(36) NOT NULL CHECK (parent_id ~* '^[0-9a-f-]{36,36}$'),
+  status            VARCHAR(128) NOT NULL,
+  updated_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS message_receipts_updatedx ON message_receipts(updated_at);
+
+
+CREATE TABLE IF NOT EXISTS backfills (
+  user_id           VARCHAR(36) PRIMARY KEY CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  attempts          INTEGER NOT NULL DEFAULT 0,
+  last_error        VARCHAR(1024) NOT NULL DEFAULT '',
+  next_attempt_at   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS backfills_createdx ON backfills(created_at);
+
+
+CREATE TABLE IF NOT EXISTS pins (
+  message_id        VARCHAR(36) PRIMARY KEY CHECK (message_id ~* '^[0-9a-f-]{36,36}$'),
+  pinned_by         VARCHAR(36) NOT NULL CHECK (pinned_by ~* '^[0-9a-f-]{36,36}$'),
+  created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+
+CREATE TABLE IF NOT EXISTS scheduled_messages (
+  schedule_id       VARCHAR(36) PRIMARY KEY CHECK (schedule_id ~* '^[0-9a-f-]{36,36}$'),
+  user_id           VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  category          VARCHAR(512) NOT NULL,
+  data              TEXT NOT NULL,
+  cron              VARCHAR(128) NOT NULL DEFAULT '',
+  state             VARCHAR(128) NOT NULL,
+  next_run_at       TIMESTAMP WITH TIME ZONE NOT NULL,
+  last_run_at       TIMESTAMP WITH TIME ZONE,
+  created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_messages_state_nextx ON scheduled_messages(state, next_run_at);
+
+
+CREATE TABLE IF NOT EXISTS quotes (
+  quote_id          VARCHAR(36) PRIMARY KEY CHECK (quote_id ~* '^[0-9a-f-]{36,36}$'),
+  user_id           VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  plan              VARCHAR(128) NOT NULL,
+  asset_id          VARCHAR(36) NOT NULL CHECK (asset_id ~* '^[0-9a-f-]{36,36}$'),
+  amount            VARCHAR(128) NOT NULL,
+  price_usd         VARCHAR(128) NOT NULL,
+  expires_at        TIMESTAMP WITH TIME ZONE NOT NULL,
+  created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS quotes_user_plan_assetx ON quotes(user_id, plan, asset_id, expires_at);
+CREATE INDEX IF NOT EXISTS quotes_expiresx ON quotes(expires_at);
+
+
+CREATE TABLE IF NOT EXISTS transfers (
+  snapshot_id       VARCHAR(36) PRIMARY KEY CHECK (snapshot_id ~* '^[0-9a-f-]{36,36}$'),
+  counter_user_id   VARCHAR(36) NOT NULL,
+  asset_id          VARCHAR(36) NOT NULL,
+  amount            VARCHAR(128) NOT NULL,
+  trace_id          VARCHAR(128) NOT NULL DEFAULT '',
+  memo              VARCHAR(1024) NOT NULL DEFAULT '',
+  category          VARCHAR(128) NOT NULL,
+  created_at        TIMESTAMP WITH TIME ZONE NOT NULL,
+  updated_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS transfers_createdx ON transfers(created_at);
+CREATE INDEX IF NOT EXISTS transfers_counter_createdx ON transfers(counter_user_id, created_at);
@@ -8,14 +8,20 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-func ConnectMixinBlaze(clientId, sessionId, sessionKey string) (*websocket.Conn, error) {
+func ConnectMixinBlaze(blazeBase, clientId, sessionId, sessionKey string) (*websocket.Conn, error) {
 	token, err := bot.SignAuthenticationToken(clientId, sessionId, sessionKey, "GET", "/", "")
 	if err != nil {
 		return nil, err
 	}
 	header := make(http.Header)
 	header.Add("Authorization", "Bearer "+token)
-	u := url.URL{Scheme: "wss", Host: "blaze.mixin.one", Path: "/"}
+	u, err := url.Parse(blazeBase)
+	if err != nil {
+		return nil, err
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
 	dialer := &websocket.Dialer{
 		Subprotocols: []string{"Mixin-Blaze-1"},
 	}
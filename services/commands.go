@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+const (
+	CommandRoleMember = "member"
+	CommandRoleAdmin  = "admin"
+)
+
+var errCommandUsage = errors.New("invalid command arguments")
+
+type Command struct {
+	Name    string
+	Aliases []string
+	Role    string
+	Usage   string
+	Parse   func(args []string) (interface{}, error)
+	Handle  func(ctx context.Context, mc *MessageContext, req *CommandRequest) error
+}
+
+type CommandRequest struct {
+	User    *models.User
+	Message *MessageView
+	Command *Command
+	Args    interface{}
+}
+
+type commandRegistry struct {
+	commands []*Command
+	index    map[string]*Command
+}
+
+var commands = &commandRegistry{index: make(map[string]*Command)}
+
+func registerCommand(cmd *Command) {
+	commands.commands = append(commands.commands, cmd)
+	commands.index[strings.ToLower(cmd.Name)] = cmd
+	for _, alias := range cmd.Aliases {
+		commands.index[strings.ToLower(alias)] = cmd
+	}
+}
+
+func (r *commandRegistry) lookup(name string) *Command {
+	name = strings.ToLower(name)
+	if cmd := r.index[name]; cmd != nil {
+		return cmd
+	}
+	legacy := strings.TrimPrefix(config.AppConfig.MessageTemplate.MessageCommandsInfo, config.AppConfig.MessageTemplate.CommandPrefix)
+	if legacy != "" && strings.ToLower(legacy) == name {
+		return r.index["info"]
+	}
+	return nil
+}
+
+func (cmd *Command) allowed(user *models.User) bool {
+	return cmd.Role != CommandRoleAdmin || user.GetRole() == "admin"
+}
+
+func (cmd *Command) usage() string {
+	usage := config.AppConfig.MessageTemplate.CommandPrefix + cmd.Name
+	if cmd.Usage != "" {
+		usage = usage + " " + cmd.Usage
+	}
+	return usage
+}
+
+func (cmd *Command) description() string {
+	return config.AppConfig.MessageTemplate.CommandDescriptions[cmd.Name]
+}
+
+func (req *CommandRequest) Reply(ctx context.Context, mc *MessageContext, text string) error {
+	return sendTextMessage(ctx, mc, req.Message.ConversationId, text)
+}
+
+func (req *CommandRequest) ReplyButton(ctx context.Context, mc *MessageContext, label, action string) error {
+	return sendAppButton(ctx, mc, label, req.Message.ConversationId, action)
+}
+
+func parseCommand(text string) (string, []string, bool) {
+	prefix := config.AppConfig.MessageTemplate.CommandPrefix
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, prefix) {
+		return "", nil, false
+	}
+	fields := strings.Fields(strings.TrimPrefix(text, prefix))
+	if len(fields) == 0 {
+		return "", nil, false
+	}
+	return fields[0], fields[1:], true
+}
+
+// handleCommand runs the command in a PLAIN_TEXT message. It reports false
+// when the text is not a registered command, so it is delivered as usual.
+func handleCommand(ctx context.Context, mc *MessageContext, user *models.User, message *MessageView, text string) (bool, error) {
+	if message.Category != models.MessageCategoryPlainText {
+		return false, nil
+	}
+	name, args, ok := parseCommand(text)
+	if !ok {
+		return false, nil
+	}
+	cmd := commands.lookup(name)
+	if cmd == nil {
+		return false, nil
+	}
+	req := &CommandRequest{User: user, Message: message, Command: cmd}
+	if !cmd.allowed(user) {
+		return true, req.Reply(ctx, mc, config.AppConfig.MessageTemplate.MessageCommandsDenied)
+	}
+	if cmd.Parse != nil {
+		v, err := cmd.Parse(args)
+		if err != nil {
+			return true, req.Reply(ctx, mc, fmt.Sprintf(config.AppConfig.MessageTemplate.MessageCommandsUsage, cmd.usage()))
+		}
+		req.Args = v
+	} else if len(args) > 0 {
+		return true, req.Reply(ctx, mc, fmt.Sprintf(config.AppConfig.MessageTemplate.MessageCommandsUsage, cmd.usage()))
+	}
+	return true, cmd.Handle(ctx, mc, req)
+}
+
+func init() {
+	registerCommand(&Command{Name: "help", Aliases: []string{"h", "?"}, Role: CommandRoleMember, Handle: handleHelpCommand})
+	registerCommand(&Command{Name: "info", Role: CommandRoleMember, Handle: handleInfoCommand})
+	registerCommand(&Command{Name: "rules", Role: CommandRoleMember, Handle: handleRulesCommand})
+	registerCommand(&Command{Name: "me", Aliases: []string{"whoami"}, Role: CommandRoleMember, Handle: handleMeCommand})
+	registerCommand(&Command{Name: "pinned", Role: CommandRoleMember, Handle: handlePinnedCommand})
+}
+
+func handleHelpCommand(ctx context.Context, mc *MessageContext, req *CommandRequest) error {
+	lines := []string{config.AppConfig.MessageTemplate.MessageCommandsHelp}
+	for _, cmd := range commands.commands {
+		if !cmd.allowed(req.User) {
+			continue
+		}
+		line := cmd.usage()
+		if desc := cmd.description(); desc != "" {
+			line = line + " - " + desc
+		}
+		lines = append(lines, line)
+	}
+	return req.Reply(ctx, mc, strings.Join(lines, "\n"))
+}
+
+func handleInfoCommand(ctx context.Context, mc *MessageContext, req *CommandRequest) error {
+	count, err := models.SubscribersCount(ctx)
+	if err != nil {
+		return err
+	}
+	return req.Reply(ctx, mc, fmt.Sprintf(config.AppConfig.MessageTemplate.MessageCommandsInfoResp, count))
+}
+
+func handleRulesCommand(ctx context.Context, mc *MessageContext, req *CommandRequest) error {
+	return req.Reply(ctx, mc, config.AppConfig.MessageTemplate.MessageCommandsRules)
+}
+
+func handleMeCommand(ctx context.Context, mc *MessageContext, req *CommandRequest) error {
+	user := req.User
+	text := fmt.Sprintf(config.AppConfig.MessageTemplate.MessageCommandsMeResp, user.GetFullName(), user.IdentityNumber, user.GetRole(), user.SubscribedAt.Format(time.RFC3339))
+	return req.Reply(ctx, mc, text)
+}
+
+func handlePinnedCommand(ctx context.Context, mc *MessageContext, req *CommandRequest) error {
+	count, err := req.User.SendPinnedMessages(ctx)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return req.Reply(ctx, mc, config.AppConfig.MessageTemplate.MessageCommandsNoPins)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+func init() {
+	registerCommand(&Command{Name: "ban", Aliases: []string{"block"}, Role: CommandRoleAdmin, Usage: "<identity_number>", Parse: parseIdentityArgs, Handle: handleBanCommand})
+	registerCommand(&Command{Name: "kick", Aliases: []string{"remove"}, Role: CommandRoleAdmin, Usage: "<identity_number>", Parse: parseIdentityArgs, Handle: handleKickCommand})
+	registerCommand(&Command{Name: "prohibit", Role: CommandRoleAdmin, Usage: "on|off", Parse: parseSwitchArgs, Handle: handleProhibitCommand})
+	registerCommand(&Command{Name: "recall", Role: CommandRoleAdmin, Handle: handleRecallCommand})
+	registerCommand(&Command{Name: "pin", Role: CommandRoleAdmin, Usage: "[text]", Parse: parseTextArgs, Handle: handlePinCommand})
+	registerCommand(&Command{Name: "unpin", Role: CommandRoleAdmin, Handle: handleUnpinCommand})
+}
+
+func parseIdentityArgs(args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errCommandUsage
+	}
+	identity, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || identity <= 0 {
+		return nil, errCommandUsage
+	}
+	return identity, nil
+}
+
+func parseSwitchArgs(args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errCommandUsage
+	}
+	switch strings.ToLower(args[0]) {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	return nil, errCommandUsage
+}
+
+func parseTextArgs(args []string) (interface{}, error) {
+	return strings.Join(args, " "), nil
+}
+
+// findQuotedMessageId maps the quoted copy in the admin's conversation back
+// to the original group message.
+func findQuotedMessageId(ctx context.Context, quoteMessageId string) (string, error) {
+	dm, err := models.FindDistributedMessage(ctx, quoteMessageId)
+	if err != nil || dm == nil {
+		return quoteMessageId, err
+	}
+	return dm.ParentId, nil
+}
+
+// replyQuotedMessageError answers a missing quoted message or one whose
+// category doesn't support the command, other errors are returned.
+func replyQuotedMessageError(ctx context.Context, mc *MessageContext, req *CommandRequest, err error) error {
+	sessionErr, ok := err.(session.Error)
+	if !ok {
+		return err
+	}
+	switch sessionErr.Code {
+	case 404:
+		return req.Reply(ctx, mc, config.AppConfig.MessageTemplate.MessageCommandsNotFound)
+	case 403, 10002:
+		return req.Reply(ctx, mc, config.AppConfig.MessageTemplate.MessageCommandsInvalid)
+	}
+	return err
+}
+
+func findCommandTarget(ctx context.Context, mc *MessageContext, req *CommandRequest) (*models.User, error) {
+	user, err := models.FindUserByIdentityNumber(ctx, req.Args.(int64))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, req.Reply(ctx, mc, config.AppConfig.MessageTemplate.MessageCommandsNotFound)
+	}
+	return user, nil
+}
+
+func handleBanCommand(ctx context.Context, mc *MessageContext, req *CommandRequest) error {
+	target, err := findCommandTarget(ctx, mc, req)
+	if err != nil || target == nil {
+		return err
+	}
+	blacklist, err := req.User.CreateBlacklist(ctx, target.UserId)
+	if err != nil {
+		return err
+	}
+	if blacklist == nil {
+		return req.Reply(ctx, mc, config.AppConfig.MessageTemplate.MessageCommandsNotFound)
+	}
+	return req.Reply(ctx, mc, fmt.Sprintf(config.AppConfig.MessageTemplate.MessageCommandsBanResp, target.GetFullName()))
+}
+
+func handleKickCommand(ctx context.Context, mc *MessageContext, req *CommandRequest) error {
+	target, err := findCommandTarget(ctx, mc, req)
+	if err != nil || target == nil {
+		return err
+	}
+	if err := req.User.DeleteUser(ctx, target.UserId); err != nil {
+		return err
+	}
+	return req.Reply(ctx, mc, fmt.Sprintf(config.AppConfig.MessageTemplate.MessageCommandsKickResp, target.GetFullName()))
+}
+
+func handleProhibitCommand(ctx context.Context, mc *MessageContext, req *CommandRequest) error {
+	property, err := models.CreateProperty(ctx, models.ProhibitedMessage, req.Args.(bool))
+	if err != nil {
+		return err
+	}
+	if property.Value == "true" {
+		return req.Reply(ctx, mc, config.AppConfig.MessageTemplate.MessageProhibit)
+	}
+	return req.Reply(ctx, mc, config.AppConfig.MessageTemplate.MessageAllow)
+}
+
+func handleRecallCommand(ctx context.Context, mc *MessageContext, req *CommandRequest) error {
+	quoteMessageId := req.Message.QuoteMessageId
+	if quoteMessageId == "" {
+		return req.Reply(ctx, mc, fmt.Sprintf(config.AppConfig.MessageTemplate.MessageCommandsUsage, req.Command.usage()))
+	}
+	messageId, err := findQuotedMessageId(ctx, quoteMessageId)
+	if err != nil {
+		return err
+	}
+	_, err = req.User.RecallMessage(ctx, messageId)
+	if err != nil {
+		return replyQuotedMessageError(ctx, mc, req, err)
+	}
+	return req.Reply(ctx, mc, config.AppConfig.MessageTemplate.MessageCommandsRecalled)
+}
+
+func handlePinCommand(ctx context.Context, mc *MessageContext, req *CommandRequest) error {
+	var pin *models.Pin
+	if text := req.Args.(string); text != "" {
+		p, err := req.User.CreateAnnouncement(ctx, text)
+		if err != nil {
+			return err
+		}
+		pin = p
+	} else if req.Message.QuoteMessageId != "" {
+		messageId, err := findQuotedMessageId(ctx, req.Message.QuoteMessageId)
+		if err != nil {
+			return err
+		}
+		p, err := req.User.PinMessage(ctx, messageId)
+		if err != nil {
+			return replyQuotedMessageError(ctx, mc, req, err)
+		}
+		pin = p
+	} else {
+		return req.Reply(ctx, mc, fmt.Sprintf(config.AppConfig.MessageTemplate.MessageCommandsUsage, req.Command.usage()))
+	}
+	if pin == nil {
+		return req.Reply(ctx, mc, config.AppConfig.MessageTemplate.MessageCommandsNotFound)
+	}
+	return req.Reply(ctx, mc, config.AppConfig.MessageTemplate.MessageCommandsPinned)
+}
+
+func handleUnpinCommand(ctx context.Context, mc *MessageContext, req *CommandRequest) error {
+	if req.Message.QuoteMessageId == "" {
+		return req.Reply(ctx, mc, fmt.Sprintf(config.AppConfig.MessageTemplate.MessageCommandsUsage, req.Command.usage()))
+	}
+	messageId, err := findQuotedMessageId(ctx, req.Message.QuoteMessageId)
+	if err != nil {
+		return err
+	}
+	if err := req.User.UnpinMessage(ctx, messageId); err != nil {
+		return err
+	}
+	return req.Reply(ctx, mc, config.AppConfig.MessageTemplate.MessageCommandsUnpinned)
+}
@@ -10,51 +10,113 @@ import (
 
 	bot "github.com/MixinNetwork/bot-api-go-client"
 	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/metrics"
 	"github.com/MixinNetwork/supergroup.mixin.one/models"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 )
 
-func distribute(ctx context.Context) {
+func distribute(ctx context.Context, w *workers) {
 	limit := int64(80)
 	for i := int64(0); i < config.AppConfig.System.MessageShardSize; i++ {
 		shard := shardId(config.AppConfig.System.MessageShardModifier, i)
-		go pendingActiveDistributedMessages(ctx, shard, limit)
+		w.runLocked(ctx, "message:distribute:"+shard, func(ctx context.Context, stop <-chan struct{}) {
+			pendingActiveDistributedMessages(ctx, stop, shard, limit)
+		})
 	}
 }
 
-func pendingActiveDistributedMessages(ctx context.Context, shard string, limit int64) {
-	for {
+func pendingActiveDistributedMessages(ctx context.Context, stop <-chan struct{}, shard string, limit int64) {
+	ctx = session.WithLogger(ctx, session.Logger(ctx).With("shard", shard))
+	for !stopping(stop) {
 		_, err := models.CleanUpExpiredDistributedMessages(ctx, shard)
 		if err != nil {
 			session.Logger(ctx).Errorf("CleanUpExpiredDistributedMessages ERROR: %+v", err)
-			time.Sleep(100 * time.Millisecond)
+			pause(stop, 100*time.Millisecond)
 			continue
 		}
 		messages, err := models.PendingActiveDistributedMessages(ctx, shard, limit)
 		if err != nil {
 			session.Logger(ctx).Errorf("PendingActiveDistributedMessages ERROR: %+v", err)
-			time.Sleep(100 * time.Millisecond)
+			pause(stop, 100*time.Millisecond)
 			continue
 		}
 		if len(messages) < 1 {
-			time.Sleep(500 * time.Millisecond)
+			pause(stop, 500*time.Millisecond)
 			continue
 		}
-		err = sendDistributedMessges(ctx, shard, messages)
-		if err != nil {
-			session.Logger(ctx).Errorf("PendingActiveDistributedMessages sendDistributedMessges ERROR: %+v", err)
-			time.Sleep(100 * time.Millisecond)
-			continue
+		if err := checkLock(ctx); err != nil {
+			session.Logger(ctx).Errorf("lost lock before delivery: %+v", err)
+			return
 		}
-		err = models.UpdateMessagesStatus(ctx, messages)
+		err = deliverDistributedMessages(ctx, shard, messages)
 		if err != nil {
-			session.Logger(ctx).Errorf("PendingActiveDistributedMessages UpdateMessagesStatus ERROR: %+v", err)
-			time.Sleep(100 * time.Millisecond)
+			session.Logger(ctx).Errorf("PendingActiveDistributedMessages deliverDistributedMessages ERROR: %+v", err)
+			pause(stop, 100*time.Millisecond)
 			continue
 		}
 	}
 }
 
+// deliverDistributedMessages bisects a batch rejected by the API until the
+// bad recipients are found, so the rest of the batch is still delivered.
+// Transient errors are not bisected, the whole batch is retried with backoff.
+func deliverDistributedMessages(ctx context.Context, shard string, messages []*models.DistributedMessage) error {
+	startAt := time.Now()
+	err := sendDistributedMessges(ctx, shard, messages)
+	metrics.DeliveryBatchDuration.Observe(time.Now().Sub(startAt).Seconds())
+	if err == nil {
+		return models.UpdateMessagesStatus(ctx, messages)
+	}
+	session.Logger(ctx).Errorf("sendDistributedMessges %d messages ERROR: %+v", len(messages), err)
+	berr, ok := err.(bot.Error)
+	if !ok {
+		metrics.DeliveryBatchErrors.Inc("request")
+		return models.FailDistributedMessages(ctx, messages, err.Error())
+	}
+	if isTransientDeliveryError(berr) {
+		metrics.DeliveryBatchErrors.Inc("transient")
+		return models.FailDistributedMessages(ctx, messages, err.Error())
+	}
+	metrics.DeliveryBatchErrors.Inc("rejected")
+	if len(messages) > 1 {
+		mid := len(messages) / 2
+		if err := deliverDistributedMessages(ctx, shard, messages[:mid]); err != nil {
+			return err
+		}
+		return deliverDistributedMessages(ctx, shard, messages[mid:])
+	}
+	message := messages[0]
+	if !isRecipientGoneError(berr) {
+		return models.FailDistributedMessages(ctx, messages, err.Error())
+	}
+	if err := models.DeadLetterRecipientMessages(ctx, message.RecipientId, err.Error()); err != nil {
+		return err
+	}
+	user, err := models.FindUser(ctx, message.RecipientId)
+	if err != nil || user == nil {
+		return err
+	}
+	session.Logger(ctx).Infof("Unsubscribe unreachable recipient %s", message.RecipientId)
+	return user.Unsubscribe(ctx)
+}
+
+func isTransientDeliveryError(err bot.Error) bool {
+	if err.Status >= 500 {
+		return true
+	}
+	switch err.Code {
+	case 401, 429, 500, 7000:
+		return true
+	}
+	return false
+}
+
+// isRecipientGoneError reports whether the recipient blocked the bot or no
+// longer exists.
+func isRecipientGoneError(err bot.Error) bool {
+	return err.Code == 403 || err.Code == 404
+}
+
 func sendDistributedMessges(ctx context.Context, key string, messages []*models.DistributedMessage) error {
 	var body []map[string]interface{}
 	for _, message := range messages {
@@ -109,7 +171,7 @@ func request(ctx context.Context, key, method, path string, body []byte, accessT
 	if httpPool[key] == nil {
 		httpPool[key] = &http.Client{Timeout: 15 * time.Second}
 	}
-	req, err := http.NewRequest(method, "https://api.mixin.one"+path, bytes.NewReader(body))
+	req, err := http.NewRequest(method, config.AppConfig.Mixin.APIBase+path, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
@@ -9,24 +9,25 @@ import (
 )
 
 type Hub struct {
-	context  context.Context
+	database *durable.Database
 	services map[string]Service
 }
 
 func NewHub(db *durable.Database) *Hub {
-	hub := &Hub{services: make(map[string]Service)}
-	hub.context = session.WithDatabase(context.Background(), db)
+	hub := &Hub{database: db, services: make(map[string]Service)}
 	hub.registerServices()
 	return hub
 }
 
-func (hub *Hub) StartService(name string) error {
+// StartService runs the service until ctx is cancelled.
+func (hub *Hub) StartService(ctx context.Context, name string) error {
 	service := hub.services[name]
 	if service == nil {
 		return fmt.Errorf("no service found: %s", name)
 	}
 
-	ctx := session.WithLogger(hub.context, durable.BuildLogger())
+	ctx = session.WithDatabase(ctx, hub.database)
+	ctx = session.WithLogger(ctx, durable.BuildLogger().With("service", name))
 	return service.Run(ctx)
 }
 
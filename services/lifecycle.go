@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const lockRetryPeriod = 5 * time.Second
+
+// detachedContext keeps the values of the parent but is never cancelled, so
+// the work in flight when the service stops can finish.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// workers runs the background loops of a service, each loop checks stop
+// between two units of work and returns once it is closed.
+type workers struct {
+	stop <-chan struct{}
+	wg   sync.WaitGroup
+}
+
+func (w *workers) run(ctx context.Context, loop func(ctx context.Context, stop <-chan struct{})) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		loop(ctx, w.stop)
+	}()
+}
+
+func (w *workers) wait(timeout time.Duration) error {
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("workers still running after %s", timeout)
+	}
+}
+
+func stopping(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// pause sleeps for d or until the service stops.
+func pause(stop <-chan struct{}, d time.Duration) {
+	select {
+	case <-stop:
+	case <-time.After(d):
+	}
+}
+
+type lockContextKey struct{}
+
+// checkLock returns an error when the loop runs under an advisory lock which
+// is lost. The watcher only notices it on a ticker, so a loop doing work that
+// must not be done twice checks it before each unit of work.
+func checkLock(ctx context.Context) error {
+	lock, _ := ctx.Value(lockContextKey{}).(*durable.AdvisoryLock)
+	if lock == nil {
+		return nil
+	}
+	return lock.Check(ctx)
+}
+
+// runLocked runs the loop only while this process holds the advisory lock
+// named after it, so a single instance works on it at a time and another one
+// takes over when the holder dies.
+func (w *workers) runLocked(ctx context.Context, name string, loop func(ctx context.Context, stop <-chan struct{})) {
+	w.run(ctx, func(ctx context.Context, stop <-chan struct{}) {
+		for !stopping(stop) {
+			lock, err := session.Database(ctx).TryAdvisoryLock(ctx, name)
+			if err != nil {
+				session.Logger(ctx).Errorf("TryAdvisoryLock %s ERROR: %+v", name, err)
+			}
+			if lock == nil {
+				pause(stop, lockRetryPeriod)
+				continue
+			}
+			session.Logger(ctx).Infof("acquired lock %s", name)
+			owned := make(chan struct{})
+			done := make(chan struct{})
+			go watchLock(ctx, name, lock, stop, done, owned)
+			loop(context.WithValue(ctx, lockContextKey{}, lock), owned)
+			close(done)
+			if err := lock.Release(ctx); err != nil {
+				session.Logger(ctx).Errorf("Release lock %s ERROR: %+v", name, err)
+			}
+			session.Logger(ctx).Infof("released lock %s", name)
+		}
+	})
+}
+
+// watchLock closes owned when the service stops or the lock is lost.
+func watchLock(ctx context.Context, name string, lock *durable.AdvisoryLock, stop, done <-chan struct{}, owned chan struct{}) {
+	defer close(owned)
+	ticker := time.NewTicker(lockRetryPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := lock.Check(ctx); err != nil {
+				session.Logger(ctx).Errorf("lost lock %s: %+v", name, err)
+				return
+			}
+		}
+	}
+}
@@ -13,8 +13,9 @@ import (
 	"unicode/utf8"
 
 	bot "github.com/MixinNetwork/bot-api-go-client"
-	number "github.com/MixinNetwork/go-number"
 	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/interceptors"
+	"github.com/MixinNetwork/supergroup.mixin.one/metrics"
 	"github.com/MixinNetwork/supergroup.mixin.one/models"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 	"github.com/gorilla/websocket"
@@ -25,6 +26,9 @@ const (
 	writeWait       = 15 * time.Second
 	pongWait        = 10 * time.Second
 	pingPeriod      = (pongWait * 9) / 10
+
+	receiptBatchLimit  = 500
+	receiptBatchPeriod = time.Second
 )
 
 type BlazeMessage struct {
@@ -66,30 +70,63 @@ type MessageContext struct {
 	ReadDone       chan bool
 	WriteDone      chan bool
 	DistributeDone chan bool
+	ReceiptDone    chan bool
 	ReadBuffer     chan MessageView
 	WriteBuffer    chan []byte
+	ReceiptBuffer  chan *models.MessageReceipt
 	RecipientId    map[string]time.Time
 }
 
+// Run stops pulling new work once ctx is cancelled, and returns when the
+// batches and transfers in flight are finished or the shutdown timeout is
+// reached. Several instances can run at once, each loop below is worked on
+// by the instance holding its lock.
 func (service *MessageService) Run(ctx context.Context) error {
-	go distribute(ctx)
-	go loopPendingMessage(ctx)
-	go handlePendingParticipants(ctx)
-	go handleExpiredPackets(ctx)
+	chain, err := interceptors.NewChain(config.AppConfig.System.Interceptors)
+	if err != nil {
+		return fmt.Errorf("invalid interceptors config: %v", err)
+	}
+	stop := ctx.Done()
+	ctx = detachedContext{ctx}
+	w := &workers{stop: stop}
+	distribute(ctx, w)
+	w.runLocked(ctx, "message:blaze", service.connect)
+	w.runLocked(ctx, "message:pending", func(ctx context.Context, stop <-chan struct{}) {
+		loopPendingMessage(ctx, stop, chain)
+	})
+	w.runLocked(ctx, "message:participants", handlePendingParticipants)
+	w.runLocked(ctx, "message:backfills", handlePendingBackfills)
+	w.runLocked(ctx, "message:expired_packets", handleExpiredPackets)
+	w.runLocked(ctx, "message:expired_receipts", handleExpiredReceipts)
+	w.runLocked(ctx, "message:expired_orders", handleExpiredOrders)
+	w.runLocked(ctx, "message:expired_quotes", handleExpiredQuotes)
+	w.runLocked(ctx, "message:memberships", handleMemberships)
+	w.runLocked(ctx, "message:scheduled", handleScheduledMessages)
+	w.run(ctx, handlePipelineMetrics)
+
+	<-stop
+	session.Logger(ctx).Info("message service stopping")
+	return w.wait(config.AppConfig.Service.ShutdownTimeout)
+}
 
-	for {
-		err := service.loop(ctx)
+func (service *MessageService) connect(ctx context.Context, stop <-chan struct{}) {
+	for !stopping(stop) {
+		err := service.loop(ctx, stop)
 		if err != nil {
 			session.Logger(ctx).Error(err)
 		}
 		session.Logger(ctx).Info("connection loop end")
-		time.Sleep(300 * time.Millisecond)
+		if stopping(stop) {
+			break
+		}
+		metrics.BlazeReconnects.Inc()
+		pause(stop, 300*time.Millisecond)
 	}
-	return nil
 }
 
-func (service *MessageService) loop(ctx context.Context) error {
-	conn, err := ConnectMixinBlaze(config.AppConfig.Mixin.ClientId, config.AppConfig.Mixin.SessionId, config.AppConfig.Mixin.SessionKey)
+func (service *MessageService) loop(ctx context.Context, stop <-chan struct{}) error {
+	mixin := config.AppConfig.Mixin
+	conn, err := ConnectMixinBlaze(mixin.BlazeBase, mixin.ClientId, mixin.SessionId, mixin.SessionKey)
 	if err != nil {
 		return err
 	}
@@ -100,13 +137,16 @@ func (service *MessageService) loop(ctx context.Context) error {
 		ReadDone:       make(chan bool, 1),
 		WriteDone:      make(chan bool, 1),
 		DistributeDone: make(chan bool, 1),
+		ReceiptDone:    make(chan bool, 1),
 		ReadBuffer:     make(chan MessageView, 102400),
 		WriteBuffer:    make(chan []byte, 102400),
+		ReceiptBuffer:  make(chan *models.MessageReceipt, 102400),
 		RecipientId:    make(map[string]time.Time, 0),
 	}
 
 	go writePump(ctx, conn, mc)
 	go readPump(ctx, conn, mc)
+	go receiptPump(ctx, mc)
 
 	err = writeMessageAndWait(ctx, mc, "LIST_PENDING_MESSAGES", nil)
 	if err != nil {
@@ -115,9 +155,14 @@ func (service *MessageService) loop(ctx context.Context) error {
 
 	for {
 		select {
+		case <-stop:
+			deadline := time.Now().Add(writeWait)
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), deadline)
+			return nil
 		case <-mc.ReadDone:
 			return nil
 		case msg := <-mc.ReadBuffer:
+			ctx := session.WithLogger(ctx, session.Logger(ctx).With("message_id", msg.MessageId))
 			if msg.Category == "SYSTEM_ACCOUNT_SNAPSHOT" && msg.UserId != config.AppConfig.Mixin.ClientId {
 				data, err := base64.StdEncoding.DecodeString(msg.Data)
 				if err != nil {
@@ -143,6 +188,7 @@ func (service *MessageService) loop(ctx context.Context) error {
 			if err != nil {
 				return session.BlazeServerError(ctx, err)
 			}
+			metrics.BlazeAcksSent.Inc()
 		}
 	}
 }
@@ -153,6 +199,7 @@ func readPump(ctx context.Context, conn *websocket.Conn, mc *MessageContext) err
 		mc.WriteDone <- true
 		mc.ReadDone <- true
 		mc.DistributeDone <- true
+		mc.ReceiptDone <- true
 	}()
 	conn.SetReadLimit(1024000 * 128)
 	conn.SetReadDeadline(time.Now().Add(pongWait))
@@ -207,6 +254,70 @@ func writePump(ctx context.Context, conn *websocket.Conn, mc *MessageContext) er
 	}
 }
 
+// receiptPump records the acks in batches off the read loop, and pings the
+// recipients who read a message.
+func receiptPump(ctx context.Context, mc *MessageContext) {
+	ticker := time.NewTicker(receiptBatchPeriod)
+	defer ticker.Stop()
+	var batch []*models.MessageReceipt
+	for {
+		select {
+		case r := <-mc.ReceiptBuffer:
+			batch = append(batch, r)
+			if len(batch) < receiptBatchLimit {
+				continue
+			}
+		case <-ticker.C:
+		case <-mc.ReceiptDone:
+			for {
+				for len(batch) < receiptBatchLimit && len(mc.ReceiptBuffer) > 0 {
+					batch = append(batch, <-mc.ReceiptBuffer)
+				}
+				if len(batch) == 0 {
+					return
+				}
+				recordReceipts(ctx, mc, batch)
+				batch = nil
+			}
+		}
+		recordReceipts(ctx, mc, batch)
+		batch = nil
+	}
+}
+
+func recordReceipts(ctx context.Context, mc *MessageContext, batch []*models.MessageReceipt) {
+	if len(batch) == 0 {
+		return
+	}
+	err := models.RecordMessageReceipts(ctx, batch)
+	if err != nil {
+		session.Logger(ctx).Error("ACKNOWLEDGE_MESSAGE_RECEIPT RecordMessageReceipts", err)
+	}
+	var read []string
+	for _, r := range batch {
+		if r.Status == models.MessageReceiptRead {
+			read = append(read, r.MessageId)
+		}
+	}
+	if len(read) == 0 {
+		return
+	}
+	ids, err := models.FindDistributedMessageRecipientIds(ctx, read)
+	if err != nil {
+		session.Logger(ctx).Error("ACKNOWLEDGE_MESSAGE_RECEIPT FindDistributedMessageRecipientIds", err)
+		return
+	}
+	for _, id := range ids {
+		if mc.RecipientId[id].Before(time.Now().Add(-1 * models.UserActivePeriod)) {
+			err = models.PingUserActiveAt(ctx, id)
+			if err != nil {
+				session.Logger(ctx).Error("ACKNOWLEDGE_MESSAGE_RECEIPT PingUserActiveAt", err)
+			}
+			mc.RecipientId[id] = time.Now()
+		}
+	}
+}
+
 func writeMessageAndWait(ctx context.Context, mc *MessageContext, action string, params map[string]interface{}) error {
 	var resp = make(chan BlazeMessage, 1)
 	var id = bot.UuidNewV4().String()
@@ -293,23 +404,11 @@ func parseMessage(ctx context.Context, mc *MessageContext, wsReader io.Reader) e
 			session.Logger(ctx).Error("ACKNOWLEDGE_MESSAGE_RECEIPT json.Unmarshal", err)
 			return nil
 		}
-		if msg.Status != "READ" {
-			return nil
-		}
-		id, err := models.FindDistributedMessageRecipientId(ctx, msg.MessageId)
-		if err != nil {
-			session.Logger(ctx).Error("ACKNOWLEDGE_MESSAGE_RECEIPT FindDistributedMessageRecipientId", err)
-			return nil
-		}
-		if id == "" {
-			return nil
-		}
-		if mc.RecipientId[id].Before(time.Now().Add(-1 * models.UserActivePeriod)) {
-			err = models.PingUserActiveAt(ctx, id)
-			if err != nil {
-				session.Logger(ctx).Error("ACKNOWLEDGE_MESSAGE_RECEIPT PingUserActiveAt", err)
-			}
-			mc.RecipientId[id] = time.Now()
+		metrics.BlazeAcksReceived.Inc(msg.Status)
+		select {
+		case mc.ReceiptBuffer <- &models.MessageReceipt{MessageId: msg.MessageId, Status: msg.Status}:
+		default:
+			session.Logger(ctx).Errorf("ACKNOWLEDGE_MESSAGE_RECEIPT buffer full, dropped %s %s", msg.MessageId, msg.Status)
 		}
 		return nil
 	}
@@ -337,29 +436,54 @@ func parseMessage(ctx context.Context, mc *MessageContext, wsReader io.Reader) e
 }
 
 func handleTransfer(ctx context.Context, mc *MessageContext, transfer TransferView, userId string) error {
-	id, err := bot.UuidFromString(transfer.TraceId)
+	if _, err := bot.UuidFromString(transfer.SnapshotId); err != nil {
+		return nil
+	}
+	t, err := models.CreateTransfer(ctx, transfer.SnapshotId, userId, transfer.AssetId, transfer.Amount, transfer.TraceId, transfer.Memo, transfer.CreatedAt)
 	if err != nil {
+		return err
+	}
+	if t.Category != models.TransferCategoryPending {
 		return nil
 	}
-	user, err := models.FindUser(ctx, userId)
-	if user == nil || err != nil {
+	category, err := processTransfer(ctx, mc, transfer, userId)
+	if err != nil {
 		return err
 	}
-	if user.TraceId == transfer.TraceId {
-		if transfer.Amount == config.AppConfig.System.PaymentAmount && transfer.AssetId == config.AppConfig.System.PaymentAssetId {
-			return user.Payment(ctx)
+	return models.ClassifyTransfer(ctx, transfer.SnapshotId, category)
+}
+
+func processTransfer(ctx context.Context, mc *MessageContext, transfer TransferView, userId string) (string, error) {
+	id, err := bot.UuidFromString(transfer.TraceId)
+	if err != nil {
+		return models.TransferCategoryUnknown, nil
+	}
+	user, err := models.FindUser(ctx, userId)
+	if err != nil {
+		return "", err
+	} else if user == nil {
+		return models.TransferCategoryUnknown, nil
+	}
+	if plan := user.MembershipPlanByTrace(transfer.TraceId); plan != nil {
+		if accepted, err := user.AcceptsPlanPayment(ctx, plan, transfer.AssetId, transfer.Amount, transfer.CreatedAt); err != nil {
+			return "", err
+		} else if !accepted {
+			return models.TransferCategoryUnknown, nil
 		}
-		for _, asset := range config.AppConfig.System.AccpetPaymentAssetList {
-			if number.FromString(transfer.Amount).Equal(number.FromString(asset.Amount).RoundFloor(8)) && transfer.AssetId == asset.AssetId {
-				return user.Payment(ctx)
-			}
+		return models.TransferCategoryMembership, user.PayByTransfer(ctx, transfer.SnapshotId, plan)
+	}
+	packet, err := models.PayPacket(ctx, id.String(), transfer.AssetId, transfer.Amount)
+	if err != nil {
+		return "", err
+	} else if packet == nil {
+		return models.TransferCategoryUnknown, nil
+	}
+	if packet.State == models.PacketStatePaid {
+		if err := sendAppCard(ctx, mc, packet); err != nil {
+			return "", err
 		}
-	} else if packet, err := models.PayPacket(ctx, id.String(), transfer.AssetId, transfer.Amount); err != nil || packet == nil {
-		return err
-	} else if packet.State == models.PacketStatePaid {
-		return sendAppCard(ctx, mc, packet)
 	}
-	return nil
+	return models.TransferCategoryPacket, nil
 }
 
 func sendAppCard(ctx context.Context, mc *MessageContext, packet *models.Packet) error {
@@ -389,17 +513,44 @@ func sendAppCard(ctx context.Context, mc *MessageContext, packet *models.Packet)
 	return nil
 }
 
-func handleExpiredPackets(ctx context.Context) {
+func handleScheduledMessages(ctx context.Context, stop <-chan struct{}) {
+	var limit = int64(100)
+	for !stopping(stop) {
+		schedules, err := models.ListDueScheduledMessages(ctx, limit)
+		if err != nil {
+			session.Logger(ctx).Error(err)
+			pause(stop, 300*time.Millisecond)
+			continue
+		}
+
+		for _, s := range schedules {
+			err = s.Run(ctx)
+			if err != nil {
+				session.Logger(ctx).Error(s.ScheduleId, err)
+				break
+			}
+		}
+
+		if int64(len(schedules)) < limit {
+			pause(stop, 5*time.Second)
+		}
+	}
+}
+
+func handleExpiredPackets(ctx context.Context, stop <-chan struct{}) {
 	var limit = 100
-	for {
+	for !stopping(stop) {
 		packetIds, err := models.ListExpiredPackets(ctx, limit)
 		if err != nil {
 			session.Logger(ctx).Error(err)
-			time.Sleep(300 * time.Millisecond)
+			pause(stop, 300*time.Millisecond)
 			continue
 		}
 
 		for _, id := range packetIds {
+			if stopping(stop) {
+				break
+			}
 			packet, err := models.SendPacketRefundTransfer(ctx, id)
 			if err != nil {
 				session.Logger(ctx).Error(id, err)
@@ -411,23 +562,98 @@ func handleExpiredPackets(ctx context.Context) {
 		}
 
 		if len(packetIds) < limit {
-			time.Sleep(300 * time.Millisecond)
+			pause(stop, 300*time.Millisecond)
+			continue
+		}
+	}
+}
+
+func handleExpiredReceipts(ctx context.Context, stop <-chan struct{}) {
+	var limit = int64(1000)
+	for !stopping(stop) {
+		count, err := models.CleanUpExpiredMessageReceipts(ctx, limit)
+		if err != nil {
+			session.Logger(ctx).Error(err)
+			pause(stop, 300*time.Millisecond)
+			continue
+		}
+		if count < limit {
+			pause(stop, time.Minute)
+		}
+	}
+}
+
+func handleExpiredQuotes(ctx context.Context, stop <-chan struct{}) {
+	var limit = int64(1000)
+	for !stopping(stop) {
+		count, err := models.CleanUpExpiredQuotes(ctx, limit)
+		if err != nil {
+			session.Logger(ctx).Error(err)
+			pause(stop, 300*time.Millisecond)
+			continue
+		}
+		if count < limit {
+			pause(stop, time.Minute)
+		}
+	}
+}
+
+func handleExpiredOrders(ctx context.Context, stop <-chan struct{}) {
+	var limit = int64(100)
+	for !stopping(stop) {
+		count, err := models.ExpireOrders(ctx, limit)
+		if err != nil {
+			session.Logger(ctx).Error(err)
+			pause(stop, 300*time.Millisecond)
+			continue
+		}
+		if count > 0 {
+			session.Logger(ctx).Infof("EXPIRED %d orders", count)
+		}
+		if count < limit {
+			pause(stop, time.Minute)
+		}
+	}
+}
+
+func handleMemberships(ctx context.Context, stop <-chan struct{}) {
+	var limit = int64(100)
+	for !stopping(stop) {
+		reminded, err := models.RemindExpiringMemberships(ctx, limit)
+		if err != nil {
+			session.Logger(ctx).Error(err)
+			pause(stop, 300*time.Millisecond)
 			continue
 		}
+		expired, err := models.ExpireMemberships(ctx, limit)
+		if err != nil {
+			session.Logger(ctx).Error(err)
+			pause(stop, 300*time.Millisecond)
+			continue
+		}
+		if reminded > 0 || expired > 0 {
+			session.Logger(ctx).Infof("MEMBERSHIPS reminded %d expired %d", reminded, expired)
+		}
+		if int64(reminded) < limit && int64(expired) < limit {
+			pause(stop, time.Minute)
+		}
 	}
 }
 
-func handlePendingParticipants(ctx context.Context) {
+func handlePendingParticipants(ctx context.Context, stop <-chan struct{}) {
 	var limit = 100
-	for {
+	for !stopping(stop) {
 		participants, err := models.ListPendingParticipants(ctx, limit)
 		if err != nil {
 			session.Logger(ctx).Error(err)
-			time.Sleep(300 * time.Millisecond)
+			pause(stop, 300*time.Millisecond)
 			continue
 		}
 
 		for _, p := range participants {
+			if stopping(stop) {
+				break
+			}
 			err = models.SendParticipantTransfer(ctx, p.PacketId, p.UserId, p.Amount)
 			if err != nil {
 				session.Logger(ctx).Error(err)
@@ -436,7 +662,35 @@ func handlePendingParticipants(ctx context.Context) {
 		}
 
 		if len(participants) < limit {
-			time.Sleep(300 * time.Millisecond)
+			pause(stop, 300*time.Millisecond)
+			continue
+		}
+	}
+}
+
+func handlePendingBackfills(ctx context.Context, stop <-chan struct{}) {
+	var limit = 100
+	for !stopping(stop) {
+		userIds, err := models.ListPendingBackfills(ctx, limit)
+		if err != nil {
+			session.Logger(ctx).Error(err)
+			pause(stop, 300*time.Millisecond)
+			continue
+		}
+
+		for _, id := range userIds {
+			err = models.ProcessBackfill(ctx, id)
+			if err == nil {
+				continue
+			}
+			session.Logger(ctx).Error(id, err)
+			if err := models.FailBackfill(ctx, id, err.Error()); err != nil {
+				session.Logger(ctx).Error(id, err)
+			}
+		}
+
+		if len(userIds) < limit {
+			pause(stop, 300*time.Millisecond)
 			continue
 		}
 	}
@@ -462,14 +716,9 @@ func handleMessage(ctx context.Context, mc *MessageContext, message *MessageView
 	dataBytes, err := base64.StdEncoding.DecodeString(message.Data)
 	if err != nil {
 		return session.BadDataError(ctx)
-	} else if len(dataBytes) < 10 {
-		if strings.ToUpper(string(dataBytes)) == config.AppConfig.MessageTemplate.MessageCommandsInfo {
-			if count, err := models.SubscribersCount(ctx); err != nil {
-				return err
-			} else {
-				return sendTextMessage(ctx, mc, message.ConversationId, fmt.Sprintf(config.AppConfig.MessageTemplate.MessageCommandsInfoResp, count))
-			}
-		}
+	}
+	if handled, err := handleCommand(ctx, mc, user, message, string(dataBytes)); err != nil || handled {
+		return err
 	}
 	if _, err := models.CreateMessage(ctx, user, message.MessageId, message.Category, message.QuoteMessageId, message.Data, message.CreatedAt, message.UpdatedAt); err != nil {
 		return err
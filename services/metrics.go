@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/metrics"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+func handlePipelineMetrics(ctx context.Context, stop <-chan struct{}) {
+	for !stopping(stop) {
+		err := collectPipelineMetrics(ctx)
+		if err != nil {
+			session.Logger(ctx).Error(err)
+		}
+		pause(stop, 15*time.Second)
+	}
+}
+
+func collectPipelineMetrics(ctx context.Context) error {
+	count, err := models.PendingMessagesCount(ctx)
+	if err != nil {
+		return err
+	}
+	metrics.PendingMessages.Set(float64(count))
+
+	backlogs, err := models.ListShardBacklogs(ctx)
+	if err != nil {
+		return err
+	}
+	metrics.DistributedBacklog.Reset()
+	metrics.DistributedOldestAge.Reset()
+	for _, b := range backlogs {
+		metrics.DistributedBacklog.Set(float64(b.Count), b.Shard)
+		metrics.DistributedOldestAge.Set(time.Now().Sub(b.OldestAt).Seconds(), b.Shard)
+	}
+	return nil
+}
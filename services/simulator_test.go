@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	number "github.com/MixinNetwork/go-number"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/simulator"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupSimulator(t *testing.T) (context.Context, *simulator.Server) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionId := bot.UuidNewV4().String()
+	pinToken, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, &key.PublicKey, make([]byte, 32), []byte(sessionId))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := simulator.NewServer()
+	config.AppConfig = &config.Config{}
+	mixin := &config.AppConfig.Mixin
+	mixin.ClientId = bot.UuidNewV4().String()
+	mixin.SessionId = sessionId
+	mixin.SessionKey = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	mixin.PinToken = base64.StdEncoding.EncodeToString(pinToken)
+	mixin.SessionAssetPIN = "123456"
+	mixin.APIBase = s.URL()
+	mixin.BlazeBase = s.BlazeURL()
+	if err := durable.RouteMixinAPI(mixin.APIBase); err != nil {
+		t.Fatal(err)
+	}
+	return session.WithLogger(context.Background(), durable.BuildLogger()), s
+}
+
+func TestMessageServiceBlaze(t *testing.T) {
+	assert := assert.New(t)
+	ctx, s := setupSimulator(t)
+	defer s.Close()
+
+	pushed := s.Push(simulator.MessageView{
+		ConversationId: bot.UuidNewV4().String(),
+		UserId:         bot.UuidNewV4().String(),
+		Category:       "PLAIN_TEXT",
+		Data:           base64.StdEncoding.EncodeToString([]byte("hello")),
+	})
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	service := &MessageService{}
+	go func() { done <- service.loop(ctx, stop) }()
+
+	assert.True(s.Wait(5*time.Second, func() bool { return len(s.Acknowledged()) == 1 }))
+	assert.Equal([]string{pushed.MessageId}, s.Acknowledged())
+	assert.Equal(1, s.Connected())
+	close(stop)
+	select {
+	case err := <-done:
+		assert.Nil(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("loop did not stop")
+	}
+}
+
+func TestMessageServiceREST(t *testing.T) {
+	assert := assert.New(t)
+	ctx, s := setupSimulator(t)
+	defer s.Close()
+
+	recipientId, goneId := bot.UuidNewV4().String(), bot.UuidNewV4().String()
+	message := &models.DistributedMessage{
+		MessageId:      bot.UuidNewV4().String(),
+		ConversationId: bot.UniqueConversationId(config.AppConfig.Mixin.ClientId, recipientId),
+		RecipientId:    recipientId,
+		UserId:         bot.UuidNewV4().String(),
+		Category:       "PLAIN_TEXT",
+		Data:           base64.StdEncoding.EncodeToString([]byte("hello")),
+		CreatedAt:      time.Now(),
+	}
+	err := sendDistributedMessges(ctx, "test", []*models.DistributedMessage{message})
+	assert.Nil(err)
+	delivered := s.Delivered()
+	assert.Len(delivered, 1)
+	assert.Equal(message.MessageId, delivered[0].MessageId)
+	assert.Equal(recipientId, delivered[0].RecipientId)
+
+	s.FailRecipient(goneId, simulator.Error{Status: 202, Code: 403, Description: "Forbidden."})
+	gone := *message
+	gone.MessageId, gone.RecipientId = bot.UuidNewV4().String(), goneId
+	err = sendDistributedMessges(ctx, "test", []*models.DistributedMessage{&gone})
+	berr, ok := err.(bot.Error)
+	assert.True(ok)
+	assert.True(isRecipientGoneError(berr))
+
+	mixin := config.AppConfig.Mixin
+	traceId := bot.UuidNewV4().String()
+	in := &bot.TransferInput{AssetId: bot.UuidNewV4().String(), RecipientId: recipientId, Amount: number.FromString("0.5"), TraceId: traceId, Memo: "refund"}
+	err = bot.CreateTransfer(ctx, in, mixin.ClientId, mixin.SessionId, mixin.SessionKey, mixin.SessionAssetPIN, mixin.PinToken)
+	assert.Nil(err)
+	transfers := s.Transfers()
+	assert.Len(transfers, 1)
+	assert.Equal(traceId, transfers[0].TraceId)
+	assert.Equal(recipientId, transfers[0].RecipientId)
+
+	conversationId := bot.UniqueConversationId(mixin.ClientId, recipientId)
+	participants := []bot.Participant{{UserId: recipientId, Role: ""}}
+	_, err = bot.CreateConversation(ctx, "CONTACT", conversationId, participants, mixin.ClientId, mixin.SessionId, mixin.SessionKey)
+	assert.Nil(err)
+	conversations := s.Conversations()
+	assert.Len(conversations, 1)
+	assert.Equal(conversationId, conversations[0].ConversationId)
+}
@@ -5,73 +5,65 @@ import (
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
-	"io/ioutil"
 	"math/big"
-	"net/http"
-	"strings"
 	"time"
 
 	bot "github.com/MixinNetwork/bot-api-go-client"
 	"github.com/MixinNetwork/supergroup.mixin.one/config"
 	"github.com/MixinNetwork/supergroup.mixin.one/interceptors"
+	"github.com/MixinNetwork/supergroup.mixin.one/metrics"
 	"github.com/MixinNetwork/supergroup.mixin.one/models"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 	"github.com/gofrs/uuid"
-	"mvdan.cc/xurls"
 )
 
-type Attachment struct {
-	AttachmentId string `json:"attachment_id"`
-}
-
-func loopPendingMessage(ctx context.Context) {
+func loopPendingMessage(ctx context.Context, stop <-chan struct{}, chain *interceptors.Chain) {
 	limit := 5
-	re := xurls.Relaxed()
-	for {
+	for !stopping(stop) {
 		messages, err := models.PendingMessages(ctx, int64(limit))
 		if err != nil {
-			time.Sleep(500 * time.Millisecond)
+			pause(stop, 500*time.Millisecond)
 			session.Logger(ctx).Errorf("PendingMessages ERROR: %+v", err)
 			continue
 		}
 		for _, message := range messages {
-			if !config.AppConfig.System.Operators[message.UserId] {
-				if config.AppConfig.System.DetectLinkEnabled && message.Category == "PLAIN_TEXT" {
-					data, err := base64.StdEncoding.DecodeString(message.Data)
-					if err != nil {
-						session.Logger(ctx).Errorf("DetectLink ERROR: %+v", err)
-					}
-					if re.Match(data) {
-						if err := message.Leapfrog(ctx, "Message contains link"); err != nil {
-							time.Sleep(500 * time.Millisecond)
-							session.Logger(ctx).Errorf("PendingMessages ERROR: %+v", err)
-						}
-						continue
-					}
-				}
-				if config.AppConfig.System.DetectQRCodeEnabled && message.Category == "PLAIN_IMAGE" {
-					if b, reason := validateMessage(ctx, message); !b {
-						if err := message.Leapfrog(ctx, reason); err != nil {
-							time.Sleep(500 * time.Millisecond)
-							session.Logger(ctx).Errorf("PendingMessages ERROR: %+v", err)
-						}
-						continue
-					}
-				}
-			}
-			if err := message.Distribute(ctx); err != nil {
-				time.Sleep(500 * time.Millisecond)
+			if err := interceptMessage(ctx, chain, message); err != nil {
+				pause(stop, 500*time.Millisecond)
 				session.Logger(ctx).Errorf("PendingMessages ERROR: %+v", err)
 				continue
 			}
 		}
 		if len(messages) < limit {
-			time.Sleep(500 * time.Millisecond)
+			pause(stop, 500*time.Millisecond)
 		}
 	}
 }
 
+func interceptMessage(ctx context.Context, chain *interceptors.Chain, message *models.Message) error {
+	ctx = session.WithLogger(ctx, session.Logger(ctx).With("message_id", message.MessageId))
+	role := "user"
+	if config.AppConfig.System.Operators[message.UserId] {
+		role = "admin"
+	}
+	im := &interceptors.Message{
+		MessageId: message.MessageId,
+		UserId:    message.UserId,
+		Category:  message.Category,
+		Data:      message.Data,
+	}
+	result := chain.Run(ctx, im, role)
+	if result.Verdict == interceptors.VerdictReject || result.Verdict == interceptors.VerdictHold {
+		metrics.InterceptorVerdicts.Inc(result.Interceptor, result.Verdict)
+	}
+	switch result.Verdict {
+	case interceptors.VerdictReject:
+		return message.Flag(ctx, result.Interceptor, result.Reason)
+	case interceptors.VerdictHold:
+		return message.Hold(ctx, result.Interceptor, result.Reason)
+	}
+	return message.Distribute(ctx)
+}
+
 func sendTextMessage(ctx context.Context, mc *MessageContext, conversationId, label string) error {
 	params := map[string]interface{}{
 		"conversation_id": conversationId,
@@ -108,60 +100,6 @@ func sendAppButton(ctx context.Context, mc *MessageContext, label, conversationI
 	return nil
 }
 
-func validateMessage(ctx context.Context, message *models.Message) (bool, string) {
-	var a Attachment
-	src, err := base64.StdEncoding.DecodeString(message.Data)
-	if err != nil {
-		return false, "message.Data format error is not Base64"
-	}
-	err = json.Unmarshal(src, &a)
-	if err != nil {
-		session.Logger(ctx).Errorf("validateMessage ERROR: %+v", err)
-		return false, "message.Data Unmarshal error"
-	}
-	attachment, err := bot.AttachemntShow(ctx, config.AppConfig.Mixin.ClientId, config.AppConfig.Mixin.SessionId, config.AppConfig.Mixin.SessionKey, a.AttachmentId)
-	if err != nil {
-		session.Logger(ctx).Errorf("validateMessage ERROR: %+v", err)
-		return false, fmt.Sprintf("bot.AttachemntShow error: %+v, id: %s", err, a.AttachmentId)
-	}
-
-	url := strings.Replace(attachment.ViewURL, "assets.zeromesh.net", "s3.cn-north-1.amazonaws.com.cn", 0)
-	session.Logger(ctx).Infof("validateMessage attachment ViewURL %s", url)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		session.Logger(ctx).Errorf("validateMessage ERROR: %+v", err)
-		return true, ""
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
-	resp, _ := http.DefaultClient.Do(req.WithContext(ctx))
-	if err != nil {
-		session.Logger(ctx).Errorf("validateMessage ERROR: %+v", err)
-		return true, ""
-	}
-	defer resp.Body.Close()
-	if !(resp.StatusCode >= 200 && resp.StatusCode < 300) {
-		session.Logger(ctx).Errorf("validateMessage StatusCode ERROR: %d", resp.StatusCode)
-		return true, ""
-	}
-
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		session.Logger(ctx).Errorf("validateMessage ERROR: %+v", err)
-		return true, ""
-	}
-	if b, err := interceptors.CheckQRCode(ctx, data); b {
-		if err != nil {
-			return true, ""
-		}
-		return false, "Image contains QR Code"
-	}
-	if b, err := interceptors.CheckSex(ctx, data); b {
-		return false, fmt.Sprintf("CheckSex: %+v", err)
-	}
-	return true, ""
-}
-
 func shardId(modifier string, i int64) string {
 	h := md5.New()
 	h.Write([]byte(modifier))
@@ -2,13 +2,13 @@ package services
 
 import (
 	"context"
-	"log"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/objcoding/wxpay"
 
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
 	"github.com/MixinNetwork/supergroup.mixin.one/durable"
 	"github.com/MixinNetwork/supergroup.mixin.one/models"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
@@ -19,24 +19,30 @@ type WxPaymentService struct{}
 func StartWxPaymentWatch(name string, db *durable.Database) {
 	context := session.WithDatabase(context.Background(), db)
 	client := models.CreateWxClient()
-	ctx := session.WithLogger(context, durable.BuildLogger())
+	ctx := session.WithLogger(context, durable.BuildLogger().With("service", name))
 	var orders []*models.Order
 	var err error
 	var params wxpay.Params
+	// orders are normally marked as paid by the notify callback,
+	// polling is only a slow fallback once notify_url is configured.
+	period := 5 * time.Second
+	if config.AppConfig.Wechat.NotifyUrl != "" {
+		period = time.Minute
+	}
 	for {
-		// check orders with state "NOTPAID" in every 5 seconds
-		// the window is 120 min
+		// check orders with state "NOTPAID" in every period
+		// the window is models.OrderExpiration, older orders get expired
 		// @TODO
 		// [x] do not check the orders which of owners who have paid.
-		// [ ] handle notify_url for better performance.
-		orders, err = models.GetNotPaidOrders(ctx, 120)
+		// [x] handle notify_url for better performance.
+		orders, err = models.GetNotPaidOrders(ctx, int64(models.OrderExpiration/time.Minute))
 		if err != nil {
 			time.Sleep(time.Duration(10) * time.Second)
-			log.Printf("Error in StartWxPaymentWatch's Loop: %v\n", err)
+			session.Logger(ctx).Errorf("Error in StartWxPaymentWatch's Loop: %v", err)
 			continue
 		}
 		if len(orders) != 0 {
-			log.Printf("Handle %v orders in StartWxPaymentWatch's Loop\n", len(orders))
+			session.Logger(ctx).Infof("Handle %v orders in StartWxPaymentWatch's Loop", len(orders))
 		}
 		for _, order := range orders {
 			params, err = models.FetchWxPayment(client, order.TraceId)
@@ -54,6 +60,6 @@ func StartWxPaymentWatch(name string, db *durable.Database) {
 				}
 			}
 		}
-		time.Sleep(time.Duration(5) * time.Second)
+		time.Sleep(period)
 	}
 }
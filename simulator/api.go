@@ -0,0 +1,139 @@
+package simulator
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+)
+
+type TransferInput struct {
+	AssetId     string `json:"asset_id"`
+	RecipientId string `json:"opponent_id"`
+	Amount      string `json:"amount"`
+	TraceId     string `json:"trace_id"`
+	Memo        string `json:"memo"`
+}
+
+type ConversationInput struct {
+	Category       string `json:"category"`
+	ConversationId string `json:"conversation_id"`
+	Participants   []struct {
+		UserId string `json:"user_id"`
+		Role   string `json:"role"`
+	} `json:"participants"`
+}
+
+func (s *Server) serveMessages(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.readRequest(w, r)
+	if !ok {
+		return
+	}
+	var messages []MessageView
+	if strings.HasPrefix(strings.TrimSpace(string(body)), "{") {
+		var message MessageView
+		if err := json.Unmarshal(body, &message); err != nil {
+			renderError(w, Error{Status: 202, Code: 10002, Description: err.Error()})
+			return
+		}
+		messages = []MessageView{message}
+	} else if err := json.Unmarshal(body, &messages); err != nil {
+		renderError(w, Error{Status: 202, Code: 10002, Description: err.Error()})
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, m := range messages {
+		if err, found := s.failures[m.RecipientId]; found {
+			renderError(w, err)
+			return
+		}
+	}
+	for i := range messages {
+		messages[i].Status = "SENT"
+	}
+	s.delivered = append(s.delivered, messages...)
+	renderData(w, []interface{}{})
+}
+
+func (s *Server) serveTransfers(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.readRequest(w, r)
+	if !ok {
+		return
+	}
+	var in TransferInput
+	if err := json.Unmarshal(body, &in); err != nil {
+		renderError(w, Error{Status: 202, Code: 10002, Description: err.Error()})
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err, found := s.failures[in.RecipientId]; found {
+		renderError(w, err)
+		return
+	}
+	s.transfers = append(s.transfers, in)
+	renderData(w, Snapshot{
+		Type:          "transfer",
+		SnapshotId:    bot.UuidNewV4().String(),
+		CounterUserId: in.RecipientId,
+		AssetId:       in.AssetId,
+		Amount:        "-" + in.Amount,
+		TraceId:       in.TraceId,
+		Memo:          in.Memo,
+		CreatedAt:     time.Now(),
+	})
+}
+
+func (s *Server) serveConversations(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.readRequest(w, r)
+	if !ok {
+		return
+	}
+	var in ConversationInput
+	if err := json.Unmarshal(body, &in); err != nil {
+		renderError(w, Error{Status: 202, Code: 10002, Description: err.Error()})
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.convs = append(s.convs, in)
+	renderData(w, map[string]interface{}{
+		"conversation_id": in.ConversationId,
+		"category":        in.Category,
+		"participants":    in.Participants,
+		"created_at":      time.Now(),
+	})
+}
+
+func (s *Server) readRequest(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.Method != http.MethodPost {
+		renderError(w, Error{Status: 202, Code: 404, Description: "The endpoint is not found."})
+		return nil, false
+	}
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		renderError(w, Error{Status: 202, Code: 401, Description: "Unauthorized, maybe invalid token."})
+		return nil, false
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		renderError(w, Error{Status: 202, Code: 400, Description: err.Error()})
+		return nil, false
+	}
+	return body, true
+}
+
+func renderData(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func renderError(w http.ResponseWriter, err Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.Status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": err})
+}
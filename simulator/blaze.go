@@ -0,0 +1,222 @@
+package simulator
+
+import (
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/gorilla/websocket"
+)
+
+const writeWait = 5 * time.Second
+
+type Snapshot struct {
+	Type          string    `json:"type"`
+	SnapshotId    string    `json:"snapshot_id"`
+	CounterUserId string    `json:"counter_user_id"`
+	AssetId       string    `json:"asset_id"`
+	Amount        string    `json:"amount"`
+	TraceId       string    `json:"trace_id"`
+	Memo          string    `json:"memo"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Push queues a CREATE_MESSAGE for the bot. Messages are held until a
+// connection has sent LIST_PENDING_MESSAGES, like the real Blaze server.
+func (s *Server) Push(msg MessageView) MessageView {
+	if msg.MessageId == "" {
+		msg.MessageId = bot.UuidNewV4().String()
+	}
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now()
+	}
+	if msg.UpdatedAt.IsZero() {
+		msg.UpdatedAt = msg.CreatedAt
+	}
+	if msg.Status == "" {
+		msg.Status = "SENT"
+	}
+	s.outbox <- BlazeMessage{Id: bot.UuidNewV4().String(), Action: "CREATE_MESSAGE", Data: msg}
+	return msg
+}
+
+// PushText sends a PLAIN_TEXT from userId in the conversation between the user and clientId.
+func (s *Server) PushText(clientId, userId, text string) MessageView {
+	return s.Push(MessageView{
+		ConversationId: bot.UniqueConversationId(clientId, userId),
+		UserId:         userId,
+		Category:       "PLAIN_TEXT",
+		Data:           base64.StdEncoding.EncodeToString([]byte(text)),
+	})
+}
+
+// PushSnapshot sends a SYSTEM_ACCOUNT_SNAPSHOT for a transfer from snapshot.CounterUserId.
+func (s *Server) PushSnapshot(clientId string, snapshot Snapshot) MessageView {
+	if snapshot.Type == "" {
+		snapshot.Type = "transfer"
+	}
+	if snapshot.SnapshotId == "" {
+		snapshot.SnapshotId = bot.UuidNewV4().String()
+	}
+	if snapshot.CreatedAt.IsZero() {
+		snapshot.CreatedAt = time.Now()
+	}
+	data, _ := json.Marshal(snapshot)
+	return s.Push(MessageView{
+		ConversationId: bot.UniqueConversationId(clientId, snapshot.CounterUserId),
+		UserId:         snapshot.CounterUserId,
+		Category:       "SYSTEM_ACCOUNT_SNAPSHOT",
+		Data:           base64.StdEncoding.EncodeToString(data),
+	})
+}
+
+// PushReceipt sends an ACKNOWLEDGE_MESSAGE_RECEIPT for a message the bot delivered.
+func (s *Server) PushReceipt(messageId, status string) {
+	s.outbox <- BlazeMessage{
+		Id:     bot.UuidNewV4().String(),
+		Action: "ACKNOWLEDGE_MESSAGE_RECEIPT",
+		Data:   map[string]string{"message_id": messageId, "status": status},
+	}
+}
+
+func (s *Server) serveBlaze(w http.ResponseWriter, r *http.Request) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		http.NotFound(w, r)
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	s.mutex.Lock()
+	s.conns[conn] = true
+	s.connected += 1
+	s.mutex.Unlock()
+
+	done := make(chan struct{})
+	listing := make(chan struct{})
+	var once sync.Once
+	var writeMutex sync.Mutex
+	write := func(msg BlazeMessage) error {
+		writeMutex.Lock()
+		defer writeMutex.Unlock()
+		return writeGzipToConn(conn, msg)
+	}
+	defer func() {
+		close(done)
+		conn.Close()
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+	}()
+
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-listing:
+		}
+		for {
+			select {
+			case <-done:
+				return
+			case msg := <-s.outbox:
+				if err := write(msg); err != nil {
+					select {
+					case s.outbox <- msg:
+					default:
+					}
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		messageType, reader, err := conn.NextReader()
+		if err != nil {
+			return
+		}
+		if messageType != websocket.BinaryMessage {
+			continue
+		}
+		msg, err := readGzipMessage(reader)
+		if err != nil {
+			return
+		}
+		resp := BlazeMessage{Id: msg.Id, Action: msg.Action}
+		switch msg.Action {
+		case "LIST_PENDING_MESSAGES":
+			once.Do(func() { close(listing) })
+		case "CREATE_MESSAGE":
+			var view MessageView
+			if err := remarshal(msg.Params, &view); err != nil {
+				resp.Error = &Error{Status: 202, Code: 400, Description: err.Error()}
+				break
+			}
+			view.CreatedAt = time.Now()
+			view.Status = "SENT"
+			s.mutex.Lock()
+			s.created = append(s.created, view)
+			s.mutex.Unlock()
+			resp.Data = view
+		case "ACKNOWLEDGE_MESSAGE_RECEIPT":
+			id, _ := msg.Params["message_id"].(string)
+			s.mutex.Lock()
+			s.acks = append(s.acks, id)
+			s.mutex.Unlock()
+		}
+		if err := write(resp); err != nil {
+			return
+		}
+	}
+}
+
+func readGzipMessage(reader io.Reader) (*BlazeMessage, error) {
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	var msg BlazeMessage
+	err = json.NewDecoder(gz).Decode(&msg)
+	return &msg, err
+}
+
+func writeGzipToConn(conn *websocket.Conn, msg BlazeMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	conn.SetWriteDeadline(time.Now().Add(writeWait))
+	wsWriter, err := conn.NextWriter(websocket.BinaryMessage)
+	if err != nil {
+		return err
+	}
+	gzWriter := gzip.NewWriter(wsWriter)
+	if _, err := gzWriter.Write(data); err != nil {
+		return err
+	}
+	if err := gzWriter.Close(); err != nil {
+		return err
+	}
+	return wsWriter.Close()
+}
+
+func remarshal(src, dst interface{}) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
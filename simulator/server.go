@@ -0,0 +1,170 @@
+// Package simulator runs an in-process stand-in for the Mixin Blaze and REST
+// endpoints, so the message service can be driven end to end in tests by
+// pointing mixin.blaze_base and mixin.api_base at Server.BlazeURL and Server.URL.
+package simulator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type Error struct {
+	Status      int    `json:"status"`
+	Code        int    `json:"code"`
+	Description string `json:"description"`
+}
+
+type BlazeMessage struct {
+	Id     string                 `json:"id"`
+	Action string                 `json:"action"`
+	Params map[string]interface{} `json:"params,omitempty"`
+	Data   interface{}            `json:"data,omitempty"`
+	Error  *Error                 `json:"error,omitempty"`
+}
+
+type MessageView struct {
+	ConversationId   string    `json:"conversation_id"`
+	RecipientId      string    `json:"recipient_id,omitempty"`
+	UserId           string    `json:"user_id"`
+	MessageId        string    `json:"message_id"`
+	QuoteMessageId   string    `json:"quote_message_id"`
+	RepresentativeId string    `json:"representative_id,omitempty"`
+	Category         string    `json:"category"`
+	Data             string    `json:"data"`
+	Status           string    `json:"status"`
+	Source           string    `json:"source"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+type Server struct {
+	mutex     sync.Mutex
+	http      *httptest.Server
+	upgrader  websocket.Upgrader
+	outbox    chan BlazeMessage
+	conns     map[*websocket.Conn]bool
+	connected int
+	created   []MessageView
+	acks      []string
+	delivered []MessageView
+	transfers []TransferInput
+	convs     []ConversationInput
+	failures  map[string]Error
+}
+
+func NewServer() *Server {
+	s := &Server{
+		upgrader: websocket.Upgrader{
+			Subprotocols: []string{"Mixin-Blaze-1"},
+			CheckOrigin:  func(r *http.Request) bool { return true },
+		},
+		outbox:   make(chan BlazeMessage, 1024),
+		conns:    make(map[*websocket.Conn]bool),
+		failures: make(map[string]Error),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.serveBlaze)
+	mux.HandleFunc("/messages", s.serveMessages)
+	mux.HandleFunc("/transfers", s.serveTransfers)
+	mux.HandleFunc("/conversations", s.serveConversations)
+	s.http = httptest.NewServer(mux)
+	return s
+}
+
+// URL is the REST base to use as mixin.api_base.
+func (s *Server) URL() string {
+	return s.http.URL
+}
+
+// BlazeURL is the WebSocket base to use as mixin.blaze_base.
+func (s *Server) BlazeURL() string {
+	return "ws" + strings.TrimPrefix(s.http.URL, "http")
+}
+
+func (s *Server) Close() {
+	s.DropConnections()
+	s.http.Close()
+}
+
+// DropConnections closes every open Blaze connection, which makes the
+// message service reconnect.
+func (s *Server) DropConnections() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// Connected reports how many Blaze connections have been accepted so far.
+func (s *Server) Connected() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.connected
+}
+
+// Created returns the messages the bot sent through CREATE_MESSAGE.
+func (s *Server) Created() []MessageView {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]MessageView{}, s.created...)
+}
+
+// Acknowledged returns the message ids the bot sent ACKNOWLEDGE_MESSAGE_RECEIPT for.
+func (s *Server) Acknowledged() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.acks...)
+}
+
+// Delivered returns the messages accepted through POST /messages.
+func (s *Server) Delivered() []MessageView {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]MessageView{}, s.delivered...)
+}
+
+// Transfers returns the transfers accepted through POST /transfers.
+func (s *Server) Transfers() []TransferInput {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]TransferInput{}, s.transfers...)
+}
+
+// Conversations returns the conversations created through POST /conversations.
+func (s *Server) Conversations() []ConversationInput {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]ConversationInput{}, s.convs...)
+}
+
+// FailRecipient makes every POST /messages batch that contains the recipient
+// fail with err, the way the Mixin API rejects a whole batch.
+func (s *Server) FailRecipient(recipientId string, err Error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures[recipientId] = err
+}
+
+func (s *Server) RecoverRecipient(recipientId string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.failures, recipientId)
+}
+
+// Wait polls cond until it returns true or the timeout passes.
+func (s *Server) Wait(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return cond()
+}
@@ -0,0 +1,123 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlazeRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	s := NewServer()
+	defer s.Close()
+
+	clientId, userId := bot.UuidNewV4().String(), bot.UuidNewV4().String()
+	pushed := s.PushText(clientId, userId, "hello")
+
+	header := make(http.Header)
+	header.Add("Authorization", "Bearer token")
+	dialer := &websocket.Dialer{Subprotocols: []string{"Mixin-Blaze-1"}}
+	conn, _, err := dialer.Dial(s.BlazeURL(), header)
+	assert.Nil(err)
+	defer conn.Close()
+	assert.Equal(1, s.Connected())
+
+	list := BlazeMessage{Id: bot.UuidNewV4().String(), Action: "LIST_PENDING_MESSAGES"}
+	assert.Nil(writeGzipToConn(conn, list))
+	resp := testReadBlazeMessage(t, conn)
+	assert.Equal(list.Id, resp.Id)
+	resp = testReadBlazeMessage(t, conn)
+	assert.Equal("CREATE_MESSAGE", resp.Action)
+	var msg MessageView
+	assert.Nil(remarshal(resp.Data, &msg))
+	assert.Equal(pushed.MessageId, msg.MessageId)
+	assert.Equal(bot.UniqueConversationId(clientId, userId), msg.ConversationId)
+	data, _ := base64.StdEncoding.DecodeString(msg.Data)
+	assert.Equal("hello", string(data))
+
+	ack := BlazeMessage{Id: bot.UuidNewV4().String(), Action: "ACKNOWLEDGE_MESSAGE_RECEIPT", Params: map[string]interface{}{"message_id": msg.MessageId, "status": "READ"}}
+	assert.Nil(writeGzipToConn(conn, ack))
+	resp = testReadBlazeMessage(t, conn)
+	assert.Equal(ack.Id, resp.Id)
+	assert.Equal([]string{msg.MessageId}, s.Acknowledged())
+
+	create := BlazeMessage{Id: bot.UuidNewV4().String(), Action: "CREATE_MESSAGE", Params: map[string]interface{}{"conversation_id": msg.ConversationId, "message_id": bot.UuidNewV4().String(), "category": "PLAIN_TEXT", "data": msg.Data}}
+	assert.Nil(writeGzipToConn(conn, create))
+	resp = testReadBlazeMessage(t, conn)
+	assert.Equal(create.Id, resp.Id)
+	assert.Nil(resp.Error)
+	assert.Len(s.Created(), 1)
+
+	s.DropConnections()
+	_, _, err = conn.NextReader()
+	assert.NotNil(err)
+}
+
+func TestMessagesBatch(t *testing.T) {
+	assert := assert.New(t)
+	s := NewServer()
+	defer s.Close()
+
+	good, bad := bot.UuidNewV4().String(), bot.UuidNewV4().String()
+	batch := []MessageView{
+		{RecipientId: good, MessageId: bot.UuidNewV4().String(), Category: "PLAIN_TEXT"},
+		{RecipientId: bad, MessageId: bot.UuidNewV4().String(), Category: "PLAIN_TEXT"},
+	}
+	body, _ := json.Marshal(batch)
+
+	resp := testPost(t, s.URL()+"/messages", body)
+	assert.Nil(resp.Error)
+	assert.Len(s.Delivered(), 2)
+
+	s.FailRecipient(bad, Error{Status: 202, Code: 403, Description: "Forbidden"})
+	resp = testPost(t, s.URL()+"/messages", body)
+	assert.NotNil(resp.Error)
+	assert.Equal(403, resp.Error.Code)
+	assert.Len(s.Delivered(), 2)
+
+	s.RecoverRecipient(bad)
+	resp = testPost(t, s.URL()+"/messages", body)
+	assert.Nil(resp.Error)
+	assert.Len(s.Delivered(), 4)
+
+	body, _ = json.Marshal(TransferInput{AssetId: bot.UuidNewV4().String(), RecipientId: good, Amount: "1", TraceId: bot.UuidNewV4().String()})
+	resp = testPost(t, s.URL()+"/transfers", body)
+	assert.Nil(resp.Error)
+	assert.Len(s.Transfers(), 1)
+	assert.True(s.Wait(time.Second, func() bool { return len(s.Transfers()) == 1 }))
+}
+
+func testReadBlazeMessage(t *testing.T, conn *websocket.Conn) *BlazeMessage {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, reader, err := conn.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := readGzipMessage(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func testPost(t *testing.T, url string, body []byte) *BlazeMessage {
+	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var msg BlazeMessage
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		t.Fatal(err)
+	}
+	return &msg
+}
@@ -0,0 +1,46 @@
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type DeliveryView struct {
+	Type          string    `json:"type"`
+	MessageId     string    `json:"message_id"`
+	ParentId      string    `json:"parent_id"`
+	RecipientId   string    `json:"recipient_id"`
+	UserId        string    `json:"user_id"`
+	Category      string    `json:"category"`
+	Status        string    `json:"status"`
+	Attempts      int64     `json:"attempts"`
+	LastError     string    `json:"last_error"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func buildDeliveryView(dm *models.DistributedMessage) DeliveryView {
+	return DeliveryView{
+		Type:          "delivery",
+		MessageId:     dm.MessageId,
+		ParentId:      dm.ParentId,
+		RecipientId:   dm.RecipientId,
+		UserId:        dm.UserId,
+		Category:      dm.Category,
+		Status:        dm.Status,
+		Attempts:      dm.Attempts,
+		LastError:     dm.LastError,
+		NextAttemptAt: dm.NextAttemptAt,
+		CreatedAt:     dm.CreatedAt,
+	}
+}
+
+func RenderDeliveries(w http.ResponseWriter, r *http.Request, messages []*models.DistributedMessage) {
+	views := make([]DeliveryView, len(messages))
+	for i, dm := range messages {
+		views[i] = buildDeliveryView(dm)
+	}
+	RenderDataResponse(w, r, views)
+}
@@ -10,6 +10,7 @@ import (
 type MessageView struct {
 	Type      string    `json:"type"`
 	MessageId string    `json:"message_id"`
+	UserId    string    `json:"user_id"`
 	Category  string    `json:"category"`
 	Data      string    `json:"data"`
 	FullName  string    `json:"full_name"`
@@ -20,6 +21,7 @@ func buildMessageView(message *models.Message) MessageView {
 	view := MessageView{
 		Type:      "message",
 		MessageId: message.MessageId,
+		UserId:    message.UserId,
 		Category:  message.Category,
 		Data:      message.Data,
 		FullName:  message.FullName.String,
@@ -38,3 +40,43 @@ func RenderMessages(w http.ResponseWriter, r *http.Request, messages []*models.M
 	}
 	RenderDataResponse(w, r, views)
 }
+
+func RenderMessagesPage(w http.ResponseWriter, r *http.Request, messages []*models.Message, prev, next string) {
+	views := make([]MessageView, len(messages))
+	for i, message := range messages {
+		views[i] = buildMessageView(message)
+	}
+	RenderPaginatedResponse(w, r, views, prev, next)
+}
+
+type MessageStatView struct {
+	Type           string    `json:"type"`
+	MessageId      string    `json:"message_id"`
+	UserId         string    `json:"user_id"`
+	FullName       string    `json:"full_name"`
+	Category       string    `json:"category"`
+	Data           string    `json:"data"`
+	SentCount      int64     `json:"sent_count"`
+	DeliveredCount int64     `json:"delivered_count"`
+	ReadCount      int64     `json:"read_count"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func RenderMessageStats(w http.ResponseWriter, r *http.Request, stats []*models.MessageStat) {
+	views := make([]MessageStatView, len(stats))
+	for i, s := range stats {
+		views[i] = MessageStatView{
+			Type:           "message_stat",
+			MessageId:      s.MessageId,
+			UserId:         s.UserId,
+			FullName:       s.FullName.String,
+			Category:       s.Category,
+			Data:           s.Data,
+			SentCount:      s.SentCount,
+			DeliveredCount: s.DeliveredCount,
+			ReadCount:      s.ReadCount,
+			CreatedAt:      s.CreatedAt,
+		}
+	}
+	RenderDataResponse(w, r, views)
+}
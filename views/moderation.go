@@ -0,0 +1,55 @@
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type ModerationView struct {
+	Type        string     `json:"type"`
+	MessageId   string     `json:"message_id"`
+	UserId      string     `json:"user_id"`
+	FullName    string     `json:"full_name"`
+	Category    string     `json:"category"`
+	Interceptor string     `json:"interceptor"`
+	Reason      string     `json:"reason"`
+	State       string     `json:"state"`
+	Action      string     `json:"action"`
+	DecidedBy   string     `json:"decided_by"`
+	DecidedAt   *time.Time `json:"decided_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func buildModerationView(m *models.Moderation) ModerationView {
+	view := ModerationView{
+		Type:        "moderation",
+		MessageId:   m.MessageId,
+		UserId:      m.UserId,
+		FullName:    m.FullName.String,
+		Category:    m.Category,
+		Interceptor: m.Interceptor,
+		Reason:      m.Reason,
+		State:       m.State,
+		Action:      m.Action,
+		DecidedBy:   m.DecidedBy,
+		CreatedAt:   m.CreatedAt,
+	}
+	if m.DecidedAt.Valid {
+		view.DecidedAt = &m.DecidedAt.Time
+	}
+	return view
+}
+
+func RenderModeration(w http.ResponseWriter, r *http.Request, m *models.Moderation) {
+	RenderDataResponse(w, r, buildModerationView(m))
+}
+
+func RenderModerations(w http.ResponseWriter, r *http.Request, moderations []*models.Moderation) {
+	views := make([]ModerationView, len(moderations))
+	for i, m := range moderations {
+		views[i] = buildModerationView(m)
+	}
+	RenderDataResponse(w, r, views)
+}
@@ -0,0 +1,42 @@
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type MuteView struct {
+	Type      string    `json:"type"`
+	UserId    string    `json:"user_id"`
+	FullName  string    `json:"full_name"`
+	MutedBy   string    `json:"muted_by"`
+	Reason    string    `json:"reason"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func buildMuteView(mute *models.Mute) MuteView {
+	return MuteView{
+		Type:      "mute",
+		UserId:    mute.UserId,
+		FullName:  mute.FullName.String,
+		MutedBy:   mute.MutedBy,
+		Reason:    mute.Reason,
+		ExpiresAt: mute.ExpiresAt,
+		CreatedAt: mute.CreatedAt,
+	}
+}
+
+func RenderMute(w http.ResponseWriter, r *http.Request, mute *models.Mute) {
+	RenderDataResponse(w, r, buildMuteView(mute))
+}
+
+func RenderMutes(w http.ResponseWriter, r *http.Request, mutes []*models.Mute) {
+	views := make([]MuteView, len(mutes))
+	for i, mute := range mutes {
+		views[i] = buildMuteView(mute)
+	}
+	RenderDataResponse(w, r, views)
+}
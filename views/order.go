@@ -0,0 +1,53 @@
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type OrderView struct {
+	Type          string     `json:"type"`
+	OrderId       string     `json:"order_id"`
+	UserId        string     `json:"user_id"`
+	TraceId       int64      `json:"trace_id"`
+	State         string     `json:"state"`
+	Amount        string     `json:"amount"`
+	Channel       string     `json:"channel"`
+	TransactionId string     `json:"transaction_id"`
+	Plan          string     `json:"plan"`
+	CreatedAt     time.Time  `json:"created_at"`
+	PaidAt        *time.Time `json:"paid_at"`
+}
+
+func buildOrderView(order *models.Order) OrderView {
+	view := OrderView{
+		Type:          "order",
+		OrderId:       order.OrderId,
+		UserId:        order.UserId,
+		TraceId:       order.TraceId,
+		State:         order.State,
+		Amount:        order.Amount,
+		Channel:       order.Channel,
+		TransactionId: order.TransactionId,
+		Plan:          order.Plan,
+		CreatedAt:     order.CreatedAt,
+	}
+	if order.PaidAt.Valid {
+		view.PaidAt = &order.PaidAt.Time
+	}
+	return view
+}
+
+func RenderOrder(w http.ResponseWriter, r *http.Request, order *models.Order) {
+	RenderDataResponse(w, r, buildOrderView(order))
+}
+
+func RenderOrdersPage(w http.ResponseWriter, r *http.Request, orders []*models.Order, next string) {
+	views := make([]OrderView, len(orders))
+	for i, order := range orders {
+		views[i] = buildOrderView(order)
+	}
+	RenderPaginatedResponse(w, r, views, "", next)
+}
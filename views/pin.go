@@ -0,0 +1,49 @@
+package views
+
+import (
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type PinView struct {
+	Type      string    `json:"type"`
+	MessageId string    `json:"message_id"`
+	UserId    string    `json:"user_id"`
+	FullName  string    `json:"full_name"`
+	Category  string    `json:"category"`
+	Data      string    `json:"data"`
+	PinnedBy  string    `json:"pinned_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func buildPinView(p *models.Pin) PinView {
+	view := PinView{
+		Type:      "pin",
+		MessageId: p.MessageId,
+		UserId:    p.Message.UserId,
+		FullName:  p.Message.FullName.String,
+		Category:  p.Message.Category,
+		PinnedBy:  p.PinnedBy,
+		CreatedAt: p.CreatedAt,
+	}
+	if p.Message.Category == models.MessageCategoryPlainText {
+		data, _ := base64.StdEncoding.DecodeString(p.Message.Data)
+		view.Data = string(data)
+	}
+	return view
+}
+
+func RenderPin(w http.ResponseWriter, r *http.Request, p *models.Pin) {
+	RenderDataResponse(w, r, buildPinView(p))
+}
+
+func RenderPins(w http.ResponseWriter, r *http.Request, pins []*models.Pin) {
+	views := make([]PinView, len(pins))
+	for i, p := range pins {
+		views[i] = buildPinView(p)
+	}
+	RenderDataResponse(w, r, views)
+}
@@ -0,0 +1,34 @@
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type QuoteView struct {
+	Type      string    `json:"type"`
+	QuoteId   string    `json:"quote_id"`
+	Plan      string    `json:"plan"`
+	AssetId   string    `json:"asset_id"`
+	Amount    string    `json:"amount"`
+	PriceUSD  string    `json:"price_usd"`
+	TraceId   string    `json:"trace_id"`
+	Memo      string    `json:"memo"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func RenderQuote(w http.ResponseWriter, r *http.Request, quote *models.Quote) {
+	RenderDataResponse(w, r, QuoteView{
+		Type:      "quote",
+		QuoteId:   quote.QuoteId,
+		Plan:      quote.Plan,
+		AssetId:   quote.AssetId,
+		Amount:    quote.Amount,
+		PriceUSD:  quote.PriceUSD,
+		TraceId:   quote.TraceId,
+		Memo:      "PAY_TO_JOIN:" + quote.Plan,
+		ExpiresAt: quote.ExpiresAt,
+	})
+}
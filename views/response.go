@@ -18,6 +18,10 @@ func RenderDataResponse(w http.ResponseWriter, r *http.Request, view interface{}
 	session.Render(r.Context()).JSON(w, http.StatusOK, ResponseView{Data: view})
 }
 
+func RenderPaginatedResponse(w http.ResponseWriter, r *http.Request, view interface{}, prev, next string) {
+	session.Render(r.Context()).JSON(w, http.StatusOK, ResponseView{Data: view, Prev: prev, Next: next})
+}
+
 func RenderErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	sessionError, ok := err.(session.Error)
 	if !ok {
@@ -0,0 +1,51 @@
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type ScheduledMessageView struct {
+	Type       string     `json:"type"`
+	ScheduleId string     `json:"schedule_id"`
+	UserId     string     `json:"user_id"`
+	Category   string     `json:"category"`
+	Data       string     `json:"data"`
+	Cron       string     `json:"cron"`
+	State      string     `json:"state"`
+	NextRunAt  time.Time  `json:"next_run_at"`
+	LastRunAt  *time.Time `json:"last_run_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func buildScheduledMessageView(s *models.ScheduledMessage) ScheduledMessageView {
+	view := ScheduledMessageView{
+		Type:       "scheduled_message",
+		ScheduleId: s.ScheduleId,
+		UserId:     s.UserId,
+		Category:   s.Category,
+		Data:       s.Data,
+		Cron:       s.Cron,
+		State:      s.State,
+		NextRunAt:  s.NextRunAt,
+		CreatedAt:  s.CreatedAt,
+	}
+	if s.LastRunAt.Valid {
+		view.LastRunAt = &s.LastRunAt.Time
+	}
+	return view
+}
+
+func RenderScheduledMessage(w http.ResponseWriter, r *http.Request, s *models.ScheduledMessage) {
+	RenderDataResponse(w, r, buildScheduledMessageView(s))
+}
+
+func RenderScheduledMessages(w http.ResponseWriter, r *http.Request, schedules []*models.ScheduledMessage) {
+	views := make([]ScheduledMessageView, len(schedules))
+	for i, s := range schedules {
+		views[i] = buildScheduledMessageView(s)
+	}
+	RenderDataResponse(w, r, views)
+}
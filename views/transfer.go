@@ -0,0 +1,44 @@
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type TransferView struct {
+	Type          string    `json:"type"`
+	SnapshotId    string    `json:"snapshot_id"`
+	CounterUserId string    `json:"counter_user_id"`
+	AssetId       string    `json:"asset_id"`
+	Amount        string    `json:"amount"`
+	TraceId       string    `json:"trace_id"`
+	Memo          string    `json:"memo"`
+	Category      string    `json:"category"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func buildTransferView(transfer *models.Transfer) TransferView {
+	return TransferView{
+		Type:          "transfer",
+		SnapshotId:    transfer.SnapshotId,
+		CounterUserId: transfer.CounterUserId,
+		AssetId:       transfer.AssetId,
+		Amount:        transfer.Amount,
+		TraceId:       transfer.TraceId,
+		Memo:          transfer.Memo,
+		Category:      transfer.Category,
+		CreatedAt:     transfer.CreatedAt,
+		UpdatedAt:     transfer.UpdatedAt,
+	}
+}
+
+func RenderTransfersPage(w http.ResponseWriter, r *http.Request, transfers []*models.Transfer, next string) {
+	views := make([]TransferView, len(transfers))
+	for i, transfer := range transfers {
+		views[i] = buildTransferView(transfer)
+	}
+	RenderPaginatedResponse(w, r, views, "", next)
+}
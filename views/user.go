@@ -20,9 +20,11 @@ type UserView struct {
 
 type AccountView struct {
 	UserView
-	AuthenticationToken string `json:"authentication_token"`
-	TraceId             string `json:"trace_id"`
-	State               string `json:"state"`
+	AuthenticationToken string            `json:"authentication_token"`
+	TraceId             string            `json:"trace_id"`
+	PlanTraceIds        map[string]string `json:"plan_trace_ids"`
+	State               string            `json:"state"`
+	ExpiresAt           string            `json:"expires_at"`
 }
 
 func buildUserView(user *models.User) UserView {
@@ -54,7 +56,11 @@ func RenderAccount(w http.ResponseWriter, r *http.Request, user *models.User) {
 		UserView:            buildUserView(user),
 		AuthenticationToken: user.AuthenticationToken,
 		TraceId:             user.TraceId,
+		PlanTraceIds:        user.PlanTraceIds(),
 		State:               user.State,
 	}
+	if user.ExpiresAt.Valid {
+		userView.ExpiresAt = user.ExpiresAt.Time.Format(time.RFC3339Nano)
+	}
 	RenderDataResponse(w, r, userView)
 }